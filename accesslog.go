@@ -0,0 +1,339 @@
+package sha
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// AccessLogEntry is the record of a finished request.
+type AccessLogEntry struct {
+	Time      time.Time // the time of receiving the request
+	Method    string
+	Path      string // the request target, with the query
+	Route     string // the pattern of the matched route, see `RequestCtx.RoutePattern`
+	Proto     string
+	Status    int
+	BytesIn   int64 // the size of the request body
+	BytesOut  int64 // the size of the response body before compression
+	Duration  time.Duration
+	ClientIP  string
+	UserAgent string
+	Referer   string
+	RequestID string
+	Subject   string // the session or auth subject, see `AccessLogger.Subject`
+}
+
+type AccessLogEncoder interface {
+	// Encode appends the entry as a line to buf, with the line break.
+	Encode(buf []byte, entry *AccessLogEntry) []byte
+}
+
+type AccessLogEncoderFunc func(buf []byte, entry *AccessLogEntry) []byte
+
+func (fn AccessLogEncoderFunc) Encode(buf []byte, entry *AccessLogEntry) []byte {
+	return fn(buf, entry)
+}
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+func appendCLFField(buf []byte, v string) []byte {
+	if len(v) < 1 {
+		return append(buf, '-')
+	}
+	return append(buf, v...)
+}
+
+// appendCLFQuoted appends the value in double quotes, the quotes, backslashes and control characters are escaped.
+func appendCLFQuoted(buf []byte, v string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20 || c == 0x7f:
+			buf = append(buf, `\x`...)
+			buf = append(buf, "0123456789abcdef"[c>>4], "0123456789abcdef"[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, '"')
+}
+
+func appendCommon(buf []byte, e *AccessLogEntry) []byte {
+	buf = appendCLFField(buf, e.ClientIP)
+	buf = append(buf, " - "...)
+	buf = appendCLFField(buf, e.Subject)
+	buf = append(buf, " ["...)
+	buf = e.Time.AppendFormat(buf, clfTimeLayout)
+	buf = append(buf, "] "...)
+	buf = appendCLFQuoted(buf, e.Method+" "+e.Path+" "+e.Proto)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(e.Status), 10)
+	buf = append(buf, ' ')
+	if e.BytesOut < 1 {
+		return append(buf, '-')
+	}
+	return strconv.AppendInt(buf, e.BytesOut, 10)
+}
+
+var (
+	// AccessLogCommon is the Common Log Format, `%h %l %u %t "%r" %>s %b`
+	AccessLogCommon = AccessLogEncoderFunc(func(buf []byte, e *AccessLogEntry) []byte {
+		return append(appendCommon(buf, e), '\n')
+	})
+
+	// AccessLogCombined is the Combined Log Format, `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"`
+	AccessLogCombined = AccessLogEncoderFunc(func(buf []byte, e *AccessLogEntry) []byte {
+		buf = appendCommon(buf, e)
+		buf = append(buf, ' ')
+		buf = appendCLFQuoted(buf, e.Referer)
+		buf = append(buf, ' ')
+		buf = appendCLFQuoted(buf, e.UserAgent)
+		return append(buf, '\n')
+	})
+
+	// AccessLogJSON encodes the entry as a json object per line
+	AccessLogJSON = AccessLogEncoderFunc(func(buf []byte, e *AccessLogEntry) []byte {
+		w := _AccessLogFieldWriter{buf: append(buf, '{'), sep: ',', kvSep: ':', quoteKey: true}
+		e.fields(&w, true)
+		return append(w.buf, '}', '\n')
+	})
+
+	// AccessLogLogfmt encodes the entry as `key=value` pairs per line, the values are quoted if necessary
+	AccessLogLogfmt = AccessLogEncoderFunc(func(buf []byte, e *AccessLogEntry) []byte {
+		w := _AccessLogFieldWriter{buf: buf, sep: ' ', kvSep: '='}
+		e.fields(&w, false)
+		return append(w.buf, '\n')
+	})
+)
+
+type _AccessLogFieldWriter struct {
+	buf      []byte
+	sep      byte
+	kvSep    byte
+	quoteKey bool
+	n        int
+}
+
+func (w *_AccessLogFieldWriter) key(k string) {
+	if w.n > 0 {
+		w.buf = append(w.buf, w.sep)
+	}
+	w.n++
+	if w.quoteKey {
+		w.buf = append(w.buf, '"')
+		w.buf = append(w.buf, k...)
+		w.buf = append(w.buf, '"')
+	} else {
+		w.buf = append(w.buf, k...)
+	}
+	w.buf = append(w.buf, w.kvSep)
+}
+
+func (w *_AccessLogFieldWriter) str(k, v string, alwaysQuote bool) {
+	if len(v) < 1 && !alwaysQuote {
+		return
+	}
+	w.key(k)
+	if alwaysQuote || needLogfmtQuote(v) {
+		w.buf = appendJSONString(w.buf, v)
+	} else {
+		w.buf = append(w.buf, v...)
+	}
+}
+
+func (w *_AccessLogFieldWriter) int(k string, v int64) {
+	w.key(k)
+	w.buf = strconv.AppendInt(w.buf, v, 10)
+}
+
+func (e *AccessLogEntry) fields(w *_AccessLogFieldWriter, json bool) {
+	w.str("time", e.Time.Format(time.RFC3339Nano), json)
+	w.str("method", e.Method, json)
+	w.str("path", e.Path, json)
+	w.str("route", e.Route, json)
+	w.str("proto", e.Proto, json)
+	w.int("status", int64(e.Status))
+	w.int("bytes_in", e.BytesIn)
+	w.int("bytes_out", e.BytesOut)
+	w.key("duration_ms")
+	w.buf = strconv.AppendFloat(w.buf, float64(e.Duration)/float64(time.Millisecond), 'f', 3, 64)
+	w.str("client_ip", e.ClientIP, json)
+	w.str("user_agent", e.UserAgent, json)
+	w.str("referer", e.Referer, json)
+	w.str("request_id", e.RequestID, json)
+	w.str("subject", e.Subject, json)
+}
+
+func needLogfmtQuote(v string) bool {
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c <= ' ' || c == '=' || c == '"' || c == '\\' || c >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// appendJSONString appends the json string, the invalid utf8 bytes are replaced by `�`.
+func appendJSONString(buf []byte, v string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(v); {
+		c := v[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, `\n`...)
+			case c == '\r':
+				buf = append(buf, `\r`...)
+			case c == '\t':
+				buf = append(buf, `\t`...)
+			case c < 0x20 || c == 0x7f:
+				buf = append(buf, `\u00`...)
+				buf = append(buf, hex[c>>4], hex[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(v[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, `�`...)
+		} else {
+			buf = append(buf, v[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
+
+// AccessLogger is a middleware which writes an entry for each request after the handler returns, the zero value
+// writes the Combined Log Format to the stdout.
+// use it with `Mux.Use` for the matched routes, or with `WrapHandler` for all requests, including the 404s.
+type AccessLogger struct {
+	// AccessLogCombined by default
+	Encoder AccessLogEncoder
+	// os.Stdout by default, such as `AccessLogFileSink`. each entry is written by a single call.
+	Sink io.Writer
+	// returns the subject of the request, such as the id of `auth.Subject` or the session id
+	Subject func(ctx *RequestCtx) string
+	// the header of the request id, `X-Request-ID` by default. `RequestCtx.RequestID` is preferred, then the response
+	// header.
+	RequestIDHeader string
+	// returns true if the request should not be logged, such as the health checks
+	Skip func(ctx *RequestCtx) bool
+
+	mutex sync.Mutex
+	buf   []byte
+}
+
+var _ Middleware = (*AccessLogger)(nil)
+
+// Process logs the request after it is handled. by `Mux.Use`, the panics and the errors are logged with the status
+// set by the recover of the mux, such as the redirections and `StatusError`.
+func (l *AccessLogger) Process(ctx *RequestCtx, next func()) {
+	// logged in the deferred function, so the panicking requests are logged too
+	defer func() {
+		v := recover()
+		if l.Skip == nil || !l.Skip(ctx) {
+			var entry AccessLogEntry
+			l.fill(ctx, &entry)
+			entry.Status = ctx.responseStatusCode(v)
+			l.Log(&entry)
+		}
+		if v != nil {
+			panic(v)
+		}
+	}()
+	next()
+}
+
+func (l *AccessLogger) fill(ctx *RequestCtx, e *AccessLogEntry) {
+	req := &ctx.Request
+	res := &ctx.Response
+
+	e.Time = time.Unix(0, req.time)
+	e.Method = string(req.Method())
+	e.Path = string(req.RawPath())
+	e.Route = ctx.RoutePattern()
+	e.Proto = string(req.HTTPVersion())
+	e.Status = res.statusCode
+	if e.Status == 0 {
+		e.Status = StatusOK
+	}
+	if req.bodyStream.enabled {
+		e.BytesIn = req.bodyStream.received
+	} else if req.body != nil {
+		e.BytesIn = int64(req.body.Len())
+	}
+	e.BytesOut = res.written
+	e.Duration = time.Since(e.Time)
+	if ip := ctx.ClientIP(); ip != nil {
+		e.ClientIP = ip.String()
+	}
+	if v, ok := req.Header().Get(HeaderUserAgent); ok {
+		e.UserAgent = string(v)
+	}
+	if v, ok := req.Header().Get(HeaderReferer); ok {
+		e.Referer = string(v)
+	}
+
+	idHeader := l.RequestIDHeader
+	if len(idHeader) < 1 {
+		idHeader = HeaderXRequestID
+	}
+	if id := ctx.RequestID(); len(id) > 0 {
+		e.RequestID = id
+	} else if v, ok := res.Header().Get(idHeader); ok {
+		e.RequestID = string(v)
+	} else if v, ok := req.Header().Get(idHeader); ok {
+		e.RequestID = string(v)
+	}
+	if l.Subject != nil {
+		e.Subject = l.Subject(ctx)
+	}
+}
+
+// Log encodes and writes the entry, the write error is ignored.
+func (l *AccessLogger) Log(entry *AccessLogEntry) {
+	encoder := l.Encoder
+	if encoder == nil {
+		encoder = AccessLogCombined
+	}
+	sink := l.Sink
+	if sink == nil {
+		sink = os.Stdout
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.buf = encoder.Encode(l.buf[:0], entry)
+	_, _ = sink.Write(l.buf)
+}
+
+// AccessLogEncoderByName returns the encoder by the name, `common`, `combined`, `json` or `logfmt`, for the config files.
+func AccessLogEncoderByName(name string) AccessLogEncoder {
+	switch strings.ToLower(name) {
+	case "common":
+		return AccessLogCommon
+	case "json":
+		return AccessLogJSON
+	case "logfmt":
+		return AccessLogLogfmt
+	case "combined", "":
+		return AccessLogCombined
+	default:
+		return nil
+	}
+}
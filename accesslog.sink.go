@@ -0,0 +1,248 @@
+package sha
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zzztttkkk/sha/logx"
+	"github.com/zzztttkkk/sha/utils"
+)
+
+var ErrAccessLogSinkClosed = errors.New("sha.accesslog: sink is closed")
+
+const accessLogBackupTimeLayout = "20060102T150405.000000000"
+
+type AccessLogFileOptions struct {
+	Path string `json:"path" toml:"path"`
+	// rotate the file before its size exceeds this, zero means no limit
+	MaxSize int64 `json:"max_size" toml:"max-size"`
+	// rotate the file at the multiples of this interval, such as `24h`, zero means no time based rotation
+	RotateInterval utils.TomlDuration `json:"rotate_interval" toml:"rotate-interval"`
+	// the count of the rotated files to keep, zero means keeping all
+	MaxBackups int `json:"max_backups" toml:"max-backups"`
+	// the count of the queued entries, the entries are dropped if the queue is full, see `AccessLogFileSink.Dropped`
+	QueueSize     int                `json:"queue_size" toml:"queue-size"`
+	BufferSize    int                `json:"buffer_size" toml:"buffer-size"`
+	FlushInterval utils.TomlDuration `json:"flush_interval" toml:"flush-interval"`
+	// the logger of the io errors, nil means `logx.Default()`
+	Logger logx.Logger `json:"-" toml:"-"`
+}
+
+var defaultAccessLogFileOptions = AccessLogFileOptions{
+	QueueSize:     4096,
+	BufferSize:    32 * 1024,
+	FlushInterval: utils.TomlDuration{Duration: time.Second},
+}
+
+// AccessLogFileSink writes the entries to the file in background, so the requests are never blocked by the disk.
+// the rotated files are renamed to `<name>-<time><ext>`, such as `access-20060102T150405.000000000.log`.
+type AccessLogFileSink struct {
+	opt AccessLogFileOptions
+
+	mutex   sync.RWMutex
+	closed  bool
+	queue   chan []byte
+	pool    sync.Pool
+	dropped int64
+	done    chan struct{}
+
+	file     *os.File
+	w        *bufio.Writer
+	size     int64
+	rotateAt time.Time
+}
+
+func NewAccessLogFileSink(opt *AccessLogFileOptions) (*AccessLogFileSink, error) {
+	s := &AccessLogFileSink{opt: *opt}
+	utils.Merge(&s.opt, defaultAccessLogFileOptions)
+	if len(s.opt.Path) < 1 {
+		return nil, errors.New("sha.accesslog: empty path")
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	s.w = bufio.NewWriterSize(s.file, s.opt.BufferSize)
+	s.queue = make(chan []byte, s.opt.QueueSize)
+	s.done = make(chan struct{})
+	go s.run()
+	return s, nil
+}
+
+// Write queues a copy of the entry without blocking.
+func (s *AccessLogFileSink) Write(p []byte) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		return 0, ErrAccessLogSinkClosed
+	}
+
+	var line []byte
+	if v, ok := s.pool.Get().(*[]byte); ok {
+		line = (*v)[:0]
+	}
+	line = append(line, p...)
+	select {
+	case s.queue <- line:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+		s.release(line)
+	}
+	return len(p), nil
+}
+
+func (s *AccessLogFileSink) release(line []byte) {
+	if cap(line) <= 4096 {
+		s.pool.Put(&line)
+	}
+}
+
+// Dropped returns the count of the entries dropped because the queue is full.
+func (s *AccessLogFileSink) Dropped() int64 { return atomic.LoadInt64(&s.dropped) }
+
+// Close writes the queued entries and closes the file.
+func (s *AccessLogFileSink) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return ErrAccessLogSinkClosed
+	}
+	s.closed = true
+	close(s.queue)
+	s.mutex.Unlock()
+
+	<-s.done
+	err := s.w.Flush()
+	if e := s.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (s *AccessLogFileSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opt.FlushInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			s.write(line)
+			s.release(line)
+		case <-ticker.C:
+			if err := s.w.Flush(); err != nil {
+				logx.Or(s.opt.Logger).Error("sha.accesslog: write error", "path", s.opt.Path, "err", err)
+			}
+		}
+	}
+}
+
+func (s *AccessLogFileSink) write(line []byte) {
+	if s.shouldRotate(len(line)) {
+		if err := s.rotate(); err != nil {
+			logx.Or(s.opt.Logger).Error("sha.accesslog: rotate error", "path", s.opt.Path, "err", err)
+		}
+	}
+	n, err := s.w.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		logx.Or(s.opt.Logger).Error("sha.accesslog: write error", "path", s.opt.Path, "err", err)
+	}
+}
+
+func (s *AccessLogFileSink) shouldRotate(n int) bool {
+	if s.opt.MaxSize > 0 && s.size > 0 && s.size+int64(n) > s.opt.MaxSize {
+		return true
+	}
+	return !s.rotateAt.IsZero() && !time.Now().Before(s.rotateAt)
+}
+
+func (s *AccessLogFileSink) open() error {
+	f, err := os.OpenFile(s.opt.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	if interval := s.opt.RotateInterval.Duration; interval > 0 {
+		s.rotateAt = time.Now().Truncate(interval).Add(interval)
+	}
+	return nil
+}
+
+func (s *AccessLogFileSink) splitPath() (string, string) {
+	ext := filepath.Ext(s.opt.Path)
+	return strings.TrimSuffix(s.opt.Path, ext), ext
+}
+
+func (s *AccessLogFileSink) rotate() error {
+	// the next rotation is not attempted for every line if this one fails
+	if interval := s.opt.RotateInterval.Duration; interval > 0 {
+		s.rotateAt = time.Now().Truncate(interval).Add(interval)
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+
+	// the file is renamed before closing, so the entries are still written to it if the new file can not be opened
+	name, ext := s.splitPath()
+	backup := name + "-" + time.Now().Format(accessLogBackupTimeLayout) + ext
+	if err := os.Rename(s.opt.Path, backup); err != nil {
+		s.size = 0
+		return err
+	}
+	file := s.file
+	if err := s.open(); err != nil {
+		_ = os.Rename(backup, s.opt.Path)
+		s.size = 0
+		return err
+	}
+	err := file.Close()
+	s.w.Reset(s.file)
+	s.removeBackups()
+	return err
+}
+
+// removeBackups removes the oldest rotated files, the names are sorted by the time. the files not named by
+// `accessLogBackupTimeLayout` are kept.
+func (s *AccessLogFileSink) removeBackups() {
+	if s.opt.MaxBackups < 1 {
+		return
+	}
+	name, ext := s.splitPath()
+	dir, prefix := filepath.Dir(name), filepath.Base(name)+"-"
+	infos, _ := ioutil.ReadDir(dir)
+	var backups []string
+	for _, info := range infos {
+		v := info.Name()
+		if info.IsDir() || len(v) < len(prefix)+len(ext) || !strings.HasPrefix(v, prefix) || !strings.HasSuffix(v, ext) {
+			continue
+		}
+		if _, err := time.Parse(accessLogBackupTimeLayout, v[len(prefix):len(v)-len(ext)]); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, v))
+	}
+	if len(backups) <= s.opt.MaxBackups {
+		return
+	}
+	sort.Strings(backups)
+	for _, fp := range backups[:len(backups)-s.opt.MaxBackups] {
+		_ = os.Remove(fp)
+	}
+}
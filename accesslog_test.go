@@ -0,0 +1,198 @@
+package sha
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zzztttkkk/sha/logx"
+)
+
+type _SyncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *_SyncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *_SyncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestAccessLogEncoders(t *testing.T) {
+	entry := &AccessLogEntry{
+		Time:      time.Date(2021, 3, 4, 5, 6, 7, 0, time.FixedZone("", 8*3600)),
+		Method:    MethodGet,
+		Path:      "/a?b=c",
+		Route:     "/a",
+		Proto:     "HTTP/1.1",
+		Status:    200,
+		BytesOut:  12,
+		Duration:  time.Millisecond * 1500,
+		ClientIP:  "127.0.0.1",
+		UserAgent: `curl "x"`,
+		RequestID: "id1",
+	}
+	cases := []struct {
+		encoder AccessLogEncoder
+		line    string
+	}{
+		{AccessLogCommon, `127.0.0.1 - - [04/Mar/2021:05:06:07 +0800] "GET /a?b=c HTTP/1.1" 200 12` + "\n"},
+		{AccessLogCombined, `127.0.0.1 - - [04/Mar/2021:05:06:07 +0800] "GET /a?b=c HTTP/1.1" 200 12 "" "curl \"x\""` + "\n"},
+		{
+			AccessLogJSON,
+			`{"time":"2021-03-04T05:06:07+08:00","method":"GET","path":"/a?b=c","route":"/a","proto":"HTTP/1.1",` +
+				`"status":200,"bytes_in":0,"bytes_out":12,"duration_ms":1500.000,"client_ip":"127.0.0.1",` +
+				`"user_agent":"curl \"x\"","referer":"","request_id":"id1","subject":""}` + "\n",
+		},
+		{
+			AccessLogLogfmt,
+			`time=2021-03-04T05:06:07+08:00 method=GET path="/a?b=c" route=/a proto=HTTP/1.1 status=200 bytes_in=0 ` +
+				`bytes_out=12 duration_ms=1500.000 client_ip=127.0.0.1 user_agent="curl \"x\"" request_id=id1` + "\n",
+		},
+	}
+	for _, c := range cases {
+		if line := string(c.encoder.Encode(nil, entry)); line != c.line {
+			t.Fatalf("unexpected line\n%s\n%s", line, c.line)
+		}
+	}
+}
+
+func TestAccessLogger(t *testing.T) {
+	sink := &_SyncBuffer{}
+	logger := &AccessLogger{
+		Encoder: AccessLogLogfmt,
+		Sink:    sink,
+		Subject: func(ctx *RequestCtx) string { return "u1" },
+	}
+	mux := NewMux(&MuxOptions{AutoCompress: true})
+	mux.HTTP(MethodPost, "/users/{id}", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		ctx.Response.Header().SetString(HeaderXRequestID, "rid")
+		_ = ctx.WriteString("hello")
+	}))
+	addr, stop := startHTTP11TestServer(t, WrapHandler(mux, logger), nil)
+	defer stop()
+
+	res, err := http.Post("http://"+addr+"/users/7", MIMEText, strings.NewReader("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res, err = http.Get("http://" + addr + "/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+
+	lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected logs %q", lines)
+	}
+	for i, expected := range []string{
+		"method=POST path=/users/7 route=/users/{id} proto=HTTP/1.1 status=200 bytes_in=3 bytes_out=5 ",
+		"method=GET path=/missing proto=HTTP/1.1 status=404 bytes_in=0 bytes_out=0 ",
+	} {
+		if !strings.Contains(lines[i], expected) || !strings.Contains(lines[i], "client_ip=127.0.0.1 user_agent=Go-http-client/1.1") {
+			t.Fatalf("unexpected log %q", lines[i])
+		}
+	}
+	if !strings.HasSuffix(lines[0], "request_id=rid subject=u1") {
+		t.Fatalf("unexpected log %q", lines[0])
+	}
+}
+
+func TestAccessLogger_Panic(t *testing.T) {
+	sink := &_SyncBuffer{}
+	mux := NewMux(&MuxOptions{Logger: logx.Discard})
+	mux.Use(&AccessLogger{Encoder: AccessLogLogfmt, Sink: sink})
+	mux.HTTP(MethodGet, "/panic", RequestCtxHandlerFunc(func(ctx *RequestCtx) { panic("oops") }))
+	mux.HTTP(MethodGet, "/redirect", RequestCtxHandlerFunc(func(ctx *RequestCtx) { RedirectTemporarily("/") }))
+	mux.HTTP(MethodGet, "/bad", RequestCtxHandlerFunc(func(ctx *RequestCtx) { panic(StatusError(StatusBadRequest)) }))
+	mux.HTTP(MethodGet, "/forbidden", RequestCtxHandlerFunc(func(ctx *RequestCtx) { ctx.SetError(StatusError(StatusForbidden)) }))
+	addr, stop := startHTTP11TestServer(t, mux, nil)
+	defer stop()
+
+	cli := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }}
+	for _, c := range []struct {
+		path   string
+		status int
+	}{
+		{"/panic", StatusInternalServerError},
+		{"/redirect", StatusFound},
+		{"/bad", StatusBadRequest},
+		{"/forbidden", StatusForbidden},
+	} {
+		sink.mutex.Lock()
+		sink.buf.Reset()
+		sink.mutex.Unlock()
+
+		res, err := cli.Get("http://" + addr + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != c.status {
+			t.Fatalf("%s: unexpected status %d", c.path, res.StatusCode)
+		}
+		expected := fmt.Sprintf("method=GET path=%s route=%s proto=HTTP/1.1 status=%d ", c.path, c.path, c.status)
+		if line := sink.String(); !strings.Contains(line, expected) {
+			t.Fatalf("unexpected log %q", line)
+		}
+	}
+}
+
+func TestAccessLogFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sha-accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the files not rotated by the sink are kept
+	for _, name := range []string{"access-old.log", "access-20210304.log", "access-20210304T050607.000000000.log.gz"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink, err := NewAccessLogFileSink(&AccessLogFileOptions{Path: filepath.Join(dir, "access.log"), MaxSize: 100, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		_, _ = fmt.Fprintf(sink, "line %02d %s\n", i, strings.Repeat("x", 30))
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sink.Write([]byte("x\n")); err != ErrAccessLogSinkClosed {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 6 {
+		t.Fatalf("unexpected files %v", files)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "access.log"))
+	if string(data) != fmt.Sprintf("line 18 %s\nline 19 %s\n", strings.Repeat("x", 30), strings.Repeat("x", 30)) {
+		t.Fatalf("unexpected content %q", data)
+	}
+	for _, fp := range files {
+		if info, _ := os.Stat(fp); info.Size() > 100 {
+			t.Fatalf("%s is too large", fp)
+		}
+	}
+}
@@ -0,0 +1,501 @@
+package sha
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	rtrace "runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zzztttkkk/sha/logx"
+	"github.com/zzztttkkk/sha/utils"
+)
+
+// HealthCheck returns nil if the dependency is healthy, ctx is done after `AdminOptions.CheckTimeout`.
+type HealthCheck func(ctx context.Context) error
+
+// RedisHealthCheck pings the redis of the config.
+func RedisHealthCheck(cfg *utils.RedisConfig) HealthCheck {
+	return func(ctx context.Context) error { return cfg.Cli().Ping(ctx).Err() }
+}
+
+type AdminOptions struct {
+	CheckTimeout utils.TomlDuration `json:"check_timeout" toml:"check-timeout"`
+	// keeps the listeners of the watched servers open after the readiness starts failing, so the load balancers
+	// can stop sending the new requests before the connections are closed.
+	DrainDelay   utils.TomlDuration `json:"drain_delay" toml:"drain-delay"`
+	DisablePprof bool               `json:"disable_pprof" toml:"disable-pprof"`
+	// the level changed by `PUT /loglevel`, nil means `logx.DefaultLevel`
+	LogLevel *logx.LevelVar `json:"-" toml:"-"`
+}
+
+type _HealthCheck struct {
+	name string
+	fn   HealthCheck
+}
+
+// Admin serves the health checks, the route tables, the stats of the servers, the runtime stats, the pprof profiles
+// and the log level. mount it to a `Mux` group, or use `Admin.Handler` to serve it on a separate server.
+type Admin struct {
+	Opts AdminOptions
+
+	mutex     sync.RWMutex
+	liveness  []_HealthCheck
+	readiness []_HealthCheck
+	servers   map[string]*Server
+	muxes     map[string]*Mux
+	notReady  int32
+	drainAt   int64
+	begin     time.Time
+}
+
+func NewAdmin(opts *AdminOptions) *Admin {
+	var defaultAdminOptions = AdminOptions{
+		CheckTimeout: utils.TomlDuration{Duration: time.Second * 5},
+	}
+	a := &Admin{servers: map[string]*Server{}, muxes: map[string]*Mux{}, begin: time.Now()}
+	if opts == nil {
+		a.Opts = defaultAdminOptions
+	} else {
+		a.Opts = *opts
+		utils.Merge(&a.Opts, defaultAdminOptions)
+	}
+	if a.Opts.LogLevel == nil {
+		a.Opts.LogLevel = logx.DefaultLevel
+	}
+	return a
+}
+
+// AddLivenessCheck appends a check of `/healthz`, which should fail only if the process needs to be restarted.
+func (a *Admin) AddLivenessCheck(name string, fn HealthCheck) {
+	a.mutex.Lock()
+	a.liveness = append(a.liveness, _HealthCheck{name: name, fn: fn})
+	a.mutex.Unlock()
+}
+
+// AddReadinessCheck appends a check of `/readyz`, such as `RedisHealthCheck`.
+func (a *Admin) AddReadinessCheck(name string, fn HealthCheck) {
+	a.mutex.Lock()
+	a.readiness = append(a.readiness, _HealthCheck{name: name, fn: fn})
+	a.mutex.Unlock()
+}
+
+// SetReady flips the readiness manually, `/readyz` fails if it is false.
+func (a *Admin) SetReady(ready bool) {
+	if ready {
+		atomic.StoreInt32(&a.notReady, 0)
+	} else {
+		atomic.StoreInt32(&a.notReady, 1)
+	}
+}
+
+func (a *Admin) IsReady() bool { return atomic.LoadInt32(&a.notReady) == 0 }
+
+// WatchServer exposes the stats and the routes of the server. the readiness fails when `Server.Shutdown` starts,
+// and the listeners are closed after `AdminOptions.DrainDelay`, or when the ctx of `Shutdown` is done.
+// the delay starts once for all the watched servers, so shutting down them one by one does not wait again.
+func (a *Admin) WatchServer(name string, s *Server) {
+	a.mutex.Lock()
+	a.servers[name] = s
+	a.mutex.Unlock()
+
+	s.BeforeDrain(func(ctx context.Context, s *Server) {
+		a.SetReady(false)
+		delay := a.Opts.DrainDelay.Duration
+		if delay <= 0 {
+			return
+		}
+		atomic.CompareAndSwapInt64(&a.drainAt, 0, time.Now().Add(delay).UnixNano())
+		wait := time.Until(time.Unix(0, atomic.LoadInt64(&a.drainAt)))
+		if wait <= 0 {
+			return
+		}
+
+		s.logger().Info("sha.admin: draining", "server", name, "delay", wait.String(), "pid", os.Getpid())
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	})
+}
+
+// WatchMux exposes the routes of the mux, the muxes of the watched servers are exposed by default.
+func (a *Admin) WatchMux(name string, m *Mux) {
+	a.mutex.Lock()
+	a.muxes[name] = m
+	a.mutex.Unlock()
+}
+
+type HealthCheckResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type HealthResult struct {
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks,omitempty"`
+}
+
+func (a *Admin) runChecks(ctx context.Context, checks []_HealthCheck, res *HealthResult) bool {
+	if len(checks) < 1 {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.Opts.CheckTimeout.Duration)
+	defer cancel()
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, fn HealthCheck) {
+			defer wg.Done()
+			defer func() {
+				if v := recover(); v != nil {
+					errs[i] = fmt.Errorf("sha.admin: check panic: %v", v)
+				}
+			}()
+			errs[i] = fn(ctx)
+		}(i, c.fn)
+	}
+	wg.Wait()
+
+	ok := true
+	res.Checks = make([]HealthCheckResult, len(checks))
+	for i, c := range checks {
+		res.Checks[i] = HealthCheckResult{Name: c.name, OK: errs[i] == nil}
+		if errs[i] != nil {
+			ok = false
+			res.Checks[i].Error = errs[i].Error()
+		}
+	}
+	return ok
+}
+
+// Liveness runs the liveness checks.
+func (a *Admin) Liveness(ctx context.Context) (HealthResult, bool) {
+	a.mutex.RLock()
+	checks := a.liveness
+	a.mutex.RUnlock()
+
+	var res HealthResult
+	ok := a.runChecks(ctx, checks, &res)
+	res.Status = healthStatus(ok)
+	return res, ok
+}
+
+// Readiness runs the readiness checks, it fails without running the checks if a watched server is shutting down
+// or `SetReady(false)` is called.
+func (a *Admin) Readiness(ctx context.Context) (HealthResult, bool) {
+	a.mutex.RLock()
+	checks := a.readiness
+	shuttingDown := false
+	for _, s := range a.servers {
+		if s.ShuttingDown() {
+			shuttingDown = true
+			break
+		}
+	}
+	a.mutex.RUnlock()
+
+	if shuttingDown {
+		return HealthResult{Status: "shutting_down"}, false
+	}
+	if !a.IsReady() {
+		return HealthResult{Status: "not_ready"}, false
+	}
+	var res HealthResult
+	ok := a.runChecks(ctx, checks, &res)
+	res.Status = healthStatus(ok)
+	return res, ok
+}
+
+func healthStatus(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "failing"
+}
+
+func writeHealth(ctx *RequestCtx, res HealthResult, ok bool) {
+	ctx.Response.Header().SetString(HeaderCacheControl, "no-store")
+	if !ok {
+		ctx.Response.SetStatusCode(StatusServiceUnavailable)
+	}
+	_ = ctx.WriteJSON(res)
+}
+
+type RouteTable struct {
+	Name   string     `json:"name"`
+	Routes []MuxRoute `json:"routes"`
+}
+
+// Routes returns the routes of the watched muxes sorted by the names.
+func (a *Admin) Routes() []RouteTable {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	muxes := map[string]*Mux{}
+	for name, s := range a.servers {
+		if m, ok := unwrapHandler(s.Handler).(*Mux); ok {
+			muxes[name] = m
+		}
+	}
+	for name, m := range a.muxes {
+		muxes[name] = m
+	}
+	var v []RouteTable
+	for _, name := range sortedNames(muxes) {
+		v = append(v, RouteTable{Name: name, Routes: muxes[name].Routes()})
+	}
+	return v
+}
+
+type NamedServerStats struct {
+	Name  string      `json:"name"`
+	Stats ServerStats `json:"stats"`
+}
+
+// Conns returns the stats of the watched servers sorted by the names.
+func (a *Admin) Conns() []NamedServerStats {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	var v []NamedServerStats
+	for _, name := range sortedNames(a.servers) {
+		v = append(v, NamedServerStats{Name: name, Stats: a.servers[name].Stats()})
+	}
+	return v
+}
+
+type RuntimeStats struct {
+	GoVersion  string  `json:"go_version"`
+	Pid        int     `json:"pid"`
+	Uptime     float64 `json:"uptime_seconds"`
+	NumCPU     int     `json:"num_cpu"`
+	GOMAXPROCS int     `json:"gomaxprocs"`
+	Goroutines int     `json:"goroutines"`
+	Memory     struct {
+		Alloc        uint64 `json:"alloc"`
+		TotalAlloc   uint64 `json:"total_alloc"`
+		Sys          uint64 `json:"sys"`
+		HeapAlloc    uint64 `json:"heap_alloc"`
+		HeapInuse    uint64 `json:"heap_inuse"`
+		HeapIdle     uint64 `json:"heap_idle"`
+		HeapReleased uint64 `json:"heap_released"`
+		HeapObjects  uint64 `json:"heap_objects"`
+		StackInuse   uint64 `json:"stack_inuse"`
+		NumGC        uint32 `json:"num_gc"`
+		PauseTotalNs uint64 `json:"pause_total_ns"`
+		LastGC       int64  `json:"last_gc_unix_nano"`
+	} `json:"memory"`
+}
+
+// Runtime returns the goroutine and heap stats, it stops the world to read the memory stats.
+func (a *Admin) Runtime() RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	v := RuntimeStats{
+		GoVersion:  runtime.Version(),
+		Pid:        os.Getpid(),
+		Uptime:     time.Since(a.begin).Seconds(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+	}
+	mem := &v.Memory
+	mem.Alloc = ms.Alloc
+	mem.TotalAlloc = ms.TotalAlloc
+	mem.Sys = ms.Sys
+	mem.HeapAlloc = ms.HeapAlloc
+	mem.HeapInuse = ms.HeapInuse
+	mem.HeapIdle = ms.HeapIdle
+	mem.HeapReleased = ms.HeapReleased
+	mem.HeapObjects = ms.HeapObjects
+	mem.StackInuse = ms.StackInuse
+	mem.NumGC = ms.NumGC
+	mem.PauseTotalNs = ms.PauseTotalNs
+	mem.LastGC = int64(ms.LastGC)
+	return v
+}
+
+// Mount registers the handlers to the router:
+//
+//	GET /healthz, GET /readyz: the health checks, 503 if failing
+//	GET /routes: the route tables
+//	GET /conns: the stats of the servers
+//	GET /runtime: the goroutine and heap stats
+//	GET /loglevel, PUT /loglevel: reads or changes the log level, the new level is the `level` form value
+//	GET /debug/pprof/...: the pprof profiles, the same paths as `net/http/pprof`
+func (a *Admin) Mount(r Router) {
+	r.HTTP(MethodGet, "/healthz", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		res, ok := a.Liveness(ctx)
+		writeHealth(ctx, res, ok)
+	}))
+	r.HTTP(MethodGet, "/readyz", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		res, ok := a.Readiness(ctx)
+		writeHealth(ctx, res, ok)
+	}))
+	r.HTTP(MethodGet, "/routes", RequestCtxHandlerFunc(func(ctx *RequestCtx) { _ = ctx.WriteJSON(a.Routes()) }))
+	r.HTTP(MethodGet, "/conns", RequestCtxHandlerFunc(func(ctx *RequestCtx) { _ = ctx.WriteJSON(a.Conns()) }))
+	r.HTTP(MethodGet, "/runtime", RequestCtxHandlerFunc(func(ctx *RequestCtx) { _ = ctx.WriteJSON(a.Runtime()) }))
+	r.HTTP(MethodGet, "/loglevel", RequestCtxHandlerFunc(a.getLogLevel))
+	r.HTTP(MethodPut, "/loglevel", RequestCtxHandlerFunc(a.setLogLevel))
+
+	if !a.Opts.DisablePprof {
+		r.HTTP(MethodGet, "/debug/pprof/", RequestCtxHandlerFunc(pprofIndex))
+		r.HTTP(MethodGet, "/debug/pprof/cmdline", RequestCtxHandlerFunc(pprofCmdline))
+		r.HTTP(MethodGet, "/debug/pprof/profile", RequestCtxHandlerFunc(pprofProfile))
+		r.HTTP(MethodGet, "/debug/pprof/trace", RequestCtxHandlerFunc(pprofTrace))
+		r.HTTP(MethodGet, "/debug/pprof/{name}", RequestCtxHandlerFunc(pprofLookup))
+	}
+}
+
+// Handler returns a new mux which mounts the admin handlers, such as serving them on a separate listener.
+func (a *Admin) Handler() *Mux {
+	mux := NewMux(nil)
+	a.Mount(mux)
+	return mux
+}
+
+type _LogLevelResult struct {
+	Level string `json:"level,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (a *Admin) getLogLevel(ctx *RequestCtx) {
+	_ = ctx.WriteJSON(_LogLevelResult{Level: a.Opts.LogLevel.String()})
+}
+
+func (a *Admin) setLogLevel(ctx *RequestCtx) {
+	v, _ := ctx.Request.FormValue("level")
+	level, err := logx.ParseLevel(string(v))
+	if err != nil {
+		ctx.Response.SetStatusCode(StatusBadRequest)
+		_ = ctx.WriteJSON(_LogLevelResult{Error: err.Error()})
+		return
+	}
+	prev := a.Opts.LogLevel.Level()
+	a.Opts.LogLevel.Set(level)
+	ctx.Logger().Info("sha.admin: log level changed", "from", prev.String(), "to", level.String())
+	a.getLogLevel(ctx)
+}
+
+func pprofIndex(ctx *RequestCtx) {
+	profiles := pprof.Profiles()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+
+	var buf strings.Builder
+	buf.WriteString("profile\tcount\n")
+	for _, p := range profiles {
+		buf.WriteString(p.Name())
+		buf.WriteByte('\t')
+		buf.WriteString(strconv.Itoa(p.Count()))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("cmdline\nprofile\ntrace\n")
+	ctx.Response.Header().SetContentType(MIMEText)
+	_ = ctx.WriteString(buf.String())
+}
+
+func pprofCmdline(ctx *RequestCtx) {
+	ctx.Response.Header().SetContentType(MIMEText)
+	_ = ctx.WriteString(strings.Join(os.Args, "\x00"))
+}
+
+// pprofSeconds returns the `seconds` query value, 30 by default.
+func pprofSeconds(ctx *RequestCtx) (time.Duration, bool) {
+	v, ok := ctx.Request.QueryValue("seconds")
+	if !ok {
+		return time.Second * 30, true
+	}
+	n, err := strconv.ParseFloat(string(v), 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n * float64(time.Second)), true
+}
+
+// pprofWait waits for the duration or the request is done.
+func pprofWait(ctx *RequestCtx, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+func pprofError(ctx *RequestCtx, status int, msg string) {
+	ctx.Response.SetStatusCode(status)
+	ctx.Response.Header().SetContentType(MIMEText)
+	_ = ctx.WriteString(msg)
+}
+
+func pprofProfile(ctx *RequestCtx) {
+	d, ok := pprofSeconds(ctx)
+	if !ok {
+		pprofError(ctx, StatusBadRequest, "bad seconds")
+		return
+	}
+	if err := pprof.StartCPUProfile(ctx); err != nil {
+		pprofError(ctx, StatusInternalServerError, err.Error())
+		return
+	}
+	pprofWait(ctx, d)
+	pprof.StopCPUProfile()
+	ctx.Response.Header().SetContentType(MIMEUnknown)
+	ctx.Response.Header().SetString(HeaderContentDisposition, `attachment; filename="profile"`)
+}
+
+func pprofTrace(ctx *RequestCtx) {
+	d, ok := pprofSeconds(ctx)
+	if !ok {
+		pprofError(ctx, StatusBadRequest, "bad seconds")
+		return
+	}
+	if err := rtrace.Start(ctx); err != nil {
+		pprofError(ctx, StatusInternalServerError, err.Error())
+		return
+	}
+	pprofWait(ctx, d)
+	rtrace.Stop()
+	ctx.Response.Header().SetContentType(MIMEUnknown)
+	ctx.Response.Header().SetString(HeaderContentDisposition, `attachment; filename="trace"`)
+}
+
+// pprofLookup writes the named profile, such as `heap` and `goroutine`, `?debug=1` writes the text format.
+func pprofLookup(ctx *RequestCtx) {
+	name, _ := ctx.Request.URL.Params.Get("name")
+	p := pprof.Lookup(string(name))
+	if p == nil {
+		pprofError(ctx, StatusNotFound, "unknown profile")
+		return
+	}
+	debug := 0
+	if v, ok := ctx.Request.QueryValue("debug"); ok {
+		debug, _ = strconv.Atoi(string(v))
+	}
+	if string(name) == "heap" {
+		if v, ok := ctx.Request.QueryValue("gc"); ok && string(v) != "0" {
+			runtime.GC()
+		}
+	}
+	if debug > 0 {
+		ctx.Response.Header().SetContentType(MIMEText)
+	} else {
+		ctx.Response.Header().SetContentType(MIMEUnknown)
+		ctx.Response.Header().SetString(HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, name))
+	}
+	if err := p.WriteTo(ctx, debug); err != nil {
+		pprofError(ctx, StatusInternalServerError, err.Error())
+	}
+}
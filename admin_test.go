@@ -0,0 +1,159 @@
+package sha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zzztttkkk/sha/logx"
+	"github.com/zzztttkkk/sha/utils"
+)
+
+func TestAdmin(t *testing.T) {
+	var redisDown int32
+	level := &logx.LevelVar{}
+	admin := NewAdmin(&AdminOptions{
+		DrainDelay: utils.TomlDuration{Duration: time.Millisecond * 500},
+		LogLevel:   level,
+	})
+	admin.AddLivenessCheck("self", func(ctx context.Context) error { return nil })
+	admin.AddReadinessCheck("redis", func(ctx context.Context) error {
+		if atomic.LoadInt32(&redisDown) == 1 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	mux := NewMux(&MuxOptions{Logger: logx.Discard})
+	mux.HTTP(MethodGet, "/users/{id}", RequestCtxHandlerFunc(func(ctx *RequestCtx) {}))
+	admin.Mount(mux.NewGroup("/admin"))
+
+	var server *Server
+	addr, stop := startHTTP11TestServer(t, mux, func(s *Server) {
+		s.Logger = logx.Discard
+		server = s
+		admin.WatchServer("api", s)
+	})
+	defer stop()
+
+	do := func(method, path, body string) (int, string) {
+		req, _ := http.NewRequest(method, "http://"+addr+path, strings.NewReader(body))
+		if len(body) > 0 {
+			req.Header.Set(HeaderContentType, MIMEForm)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		v, _ := ioutil.ReadAll(res.Body)
+		return res.StatusCode, strings.TrimSpace(string(v))
+	}
+
+	if sc, body := do(MethodGet, "/admin/healthz", ""); sc != 200 || body != `{"status":"ok","checks":[{"name":"self","ok":true}]}` {
+		t.Fatalf("unexpected liveness %d %s", sc, body)
+	}
+	if sc, body := do(MethodGet, "/admin/readyz", ""); sc != 200 || body != `{"status":"ok","checks":[{"name":"redis","ok":true}]}` {
+		t.Fatalf("unexpected readiness %d %s", sc, body)
+	}
+	atomic.StoreInt32(&redisDown, 1)
+	if sc, body := do(MethodGet, "/admin/readyz", ""); sc != 503 || body != `{"status":"failing","checks":[{"name":"redis","ok":false,"error":"connection refused"}]}` {
+		t.Fatalf("unexpected readiness %d %s", sc, body)
+	}
+	atomic.StoreInt32(&redisDown, 0)
+
+	var routes []RouteTable
+	if _, body := do(MethodGet, "/admin/routes", ""); json.Unmarshal([]byte(body), &routes) != nil || len(routes) != 1 || routes[0].Name != "api" {
+		t.Fatalf("unexpected routes %s", body)
+	}
+	found := map[string]bool{}
+	for _, r := range routes[0].Routes {
+		found[r.Method+" "+r.Path] = true
+	}
+	if !found["GET /users/{id}"] || !found["GET /admin/healthz"] || !found["PUT /admin/loglevel"] {
+		t.Fatalf("unexpected routes %v", routes)
+	}
+
+	var conns []NamedServerStats
+	if _, body := do(MethodGet, "/admin/conns", ""); json.Unmarshal([]byte(body), &conns) != nil || len(conns) != 1 || conns[0].Stats.AcceptedConnections < 1 {
+		t.Fatalf("unexpected conns %v", conns)
+	}
+
+	var rt RuntimeStats
+	if _, body := do(MethodGet, "/admin/runtime", ""); json.Unmarshal([]byte(body), &rt) != nil || rt.Goroutines < 1 || rt.Memory.HeapAlloc < 1 {
+		t.Fatalf("unexpected runtime %+v", rt)
+	}
+
+	if sc, body := do(MethodPut, "/admin/loglevel", "level=debug"); sc != 200 || body != `{"level":"DEBUG"}` || level.Level() != logx.LevelDebug {
+		t.Fatalf("unexpected log level %d %s", sc, body)
+	}
+	if sc, _ := do(MethodPut, "/admin/loglevel", "level=verbose"); sc != 400 || level.Level() != logx.LevelDebug {
+		t.Fatalf("unexpected log level %d", sc)
+	}
+	if _, body := do(MethodGet, "/admin/loglevel", ""); body != `{"level":"DEBUG"}` {
+		t.Fatalf("unexpected log level %s", body)
+	}
+
+	if _, body := do(MethodGet, "/admin/debug/pprof/", ""); !strings.Contains(body, "goroutine\t") || !strings.Contains(body, "heap\t") {
+		t.Fatalf("unexpected pprof index %s", body)
+	}
+	if sc, body := do(MethodGet, "/admin/debug/pprof/goroutine?debug=1", ""); sc != 200 || !strings.Contains(body, "goroutine profile:") {
+		t.Fatalf("unexpected goroutine profile %d %s", sc, body)
+	}
+	if sc, body := do(MethodGet, "/admin/debug/pprof/heap", ""); sc != 200 || len(body) < 1 {
+		t.Fatalf("unexpected heap profile %d", sc)
+	}
+	if sc, _ := do(MethodGet, "/admin/debug/pprof/nothing", ""); sc != 404 {
+		t.Fatalf("unexpected status %d", sc)
+	}
+
+	// the listeners are kept open for `DrainDelay` after the shutdown starts
+	go func() { _ = server.Shutdown(context.Background()) }()
+	time.Sleep(time.Millisecond * 100)
+	if sc, body := do(MethodGet, "/admin/readyz", ""); sc != 503 || body != `{"status":"shutting_down"}` {
+		t.Fatalf("unexpected readiness %d %s", sc, body)
+	}
+}
+
+func TestAdmin_DrainDelay(t *testing.T) {
+	handler := RequestCtxHandlerFunc(func(ctx *RequestCtx) {})
+	start := func(admin *Admin, name string) *Server {
+		var server *Server
+		_, stop := startHTTP11TestServer(t, handler, func(s *Server) {
+			s.Logger = logx.Discard
+			server = s
+			admin.WatchServer(name, s)
+		})
+		t.Cleanup(stop)
+		return server
+	}
+
+	// the delay is shared by the servers shut down one by one
+	admin := NewAdmin(&AdminOptions{DrainDelay: utils.TomlDuration{Duration: time.Millisecond * 300}})
+	a, b := start(admin, "a"), start(admin, "b")
+	time.Sleep(time.Millisecond * 50)
+	begin := time.Now()
+	_ = a.Shutdown(context.Background())
+	_ = b.Shutdown(context.Background())
+	if v := time.Since(begin); v < time.Millisecond*250 || v > time.Millisecond*550 {
+		t.Fatalf("unexpected drain duration %s", v)
+	}
+
+	// the delay is cut by the ctx of the shutdown
+	admin = NewAdmin(&AdminOptions{DrainDelay: utils.TomlDuration{Duration: time.Second * 10}})
+	c := start(admin, "c")
+	time.Sleep(time.Millisecond * 50)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	begin = time.Now()
+	_ = c.Shutdown(ctx)
+	if v := time.Since(begin); v > time.Second*2 || admin.IsReady() {
+		t.Fatalf("unexpected drain duration %s", v)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/zzztttkkk/sha/logx"
 	"github.com/zzztttkkk/sha/utils"
 )
 
@@ -26,6 +27,8 @@ type CliOptions struct {
 	KeepRedirectHistory bool
 	EnableCookie        bool
 	CookieStoragePath   string
+	// nil means `logx.Default()`
+	Logger logx.Logger
 }
 
 type Cli struct {
@@ -47,6 +50,7 @@ func NewCli(opt *CliOptions) *Cli {
 		false,
 		true,
 		"",
+		nil,
 	}
 
 	cp := &Cli{
@@ -62,12 +66,16 @@ func NewCli(opt *CliOptions) *Cli {
 	if cp.Opts.EnableCookie {
 		cp.jar = NewCookieJar()
 		if cp.Opts.CookieStoragePath != "" {
-			_ = cp.jar.LoadIfExists(cp.Opts.CookieStoragePath)
+			if err := cp.jar.LoadIfExists(cp.Opts.CookieStoragePath); err != nil {
+				cp.logger().Warn("sha.cli: load cookies failed", "path", cp.Opts.CookieStoragePath, "err", err)
+			}
 		}
 	}
 	return cp
 }
 
+func (cli *Cli) logger() logx.Logger { return logx.Or(cli.Opts.Logger) }
+
 var ErrClosedCli = errors.New("sha.cli: closed")
 
 func (cli *Cli) _get(ctx context.Context, addr string, isTLS bool) (*CliConnection, error) {
@@ -158,6 +166,24 @@ func (cli *Cli) put(s *CliConnection) {
 	_ = s.Close()
 }
 
+// CliStats is a snapshot of the connection pool of the client.
+type CliStats struct {
+	InUse int64 `json:"in_use"`
+	// the count of the idle connections by the pool key, `<address>:<is tls>`, such as `example.com:443:true`
+	Idle map[string]int `json:"idle"`
+}
+
+// Stats returns the usage of the connection pool, it is safe to call concurrently.
+func (cli *Cli) Stats() CliStats {
+	stats := CliStats{InUse: atomic.LoadInt64(&cli.using), Idle: map[string]int{}}
+	cli.mutex.Lock()
+	for k, c := range cli.idling {
+		stats.Idle[k] = len(c)
+	}
+	cli.mutex.Unlock()
+	return stats
+}
+
 var ErrMaxRedirect = errors.New("sha.client: reach the redirect limit")
 
 func (cli *Cli) doSend(ctx *RequestCtx, addr string, isTLS bool, redirectCount int, session *CliConnection) error {
@@ -243,6 +269,10 @@ func (cli *Cli) doSend(ctx *RequestCtx, addr string, isTLS bool, redirectCount i
 			}
 		}
 
+		cli.logger().Debug(
+			"sha.cli: redirect",
+			"from", addr, "to", redirectLocationAddr, "location", utils.S(location), "count", redirectCount+1,
+		)
 		ctx.Response.reset(cli.Opts.HTTPOptions.BufferPoolSizeLimit)
 
 		if redirectLocationAddr == addr && redirectLocationIsTLS == isTLS { // redirect to same host
@@ -18,9 +18,10 @@ type CliConnection struct {
 
 	created int64
 
-	conn net.Conn
-	r    *bufio.Reader
-	w    *bufio.Writer
+	conn  net.Conn
+	guard *_ReadGuard
+	r     *bufio.Reader
+	w     *bufio.Writer
 
 	isTLS bool
 	opt   *CliConnectionOptions
@@ -200,10 +201,11 @@ func (conn *CliConnection) openConn(ctx context.Context) error {
 		return e
 	}
 	conn.conn = c
+	conn.guard = &_ReadGuard{Conn: c, opt: conn.opt.h2tpOpts()}
 	if r == nil {
-		r = bufio.NewReader(c)
+		r = bufio.NewReader(conn.guard)
 	} else {
-		r.Reset(c)
+		r.Reset(conn.guard)
 	}
 	if w == nil {
 		w = bufio.NewWriter(c)
@@ -216,6 +218,7 @@ func (conn *CliConnection) openConn(ctx context.Context) error {
 }
 
 func (conn *CliConnection) Send(ctx *RequestCtx) error {
+	ctx.forwardRequestID()
 	for _, fn := range conn.opt.BeforeSendRequest {
 		if err := fn(ctx, conn.host); err != nil {
 			return err
@@ -241,7 +244,16 @@ func (conn *CliConnection) Send(ctx *RequestCtx) error {
 	if err := sendRequest(conn.w, &ctx.Request); err != nil {
 		return err
 	}
-	err := parseResponse(ctx, conn.r, ctx.readBuf, &ctx.Response, conn.opt.h2tpOpts())
+	// the response header and body are guarded by `HTTPOptions.MaxHeaderReadDuration`, `MaxBodyReadDuration`
+	// and `MinTransferRate`
+	opt := conn.opt.h2tpOpts()
+	conn.guard.beginHeader(time.Time{})
+	err := parseResponseHeader(ctx, conn.r, &ctx.Response, opt)
+	if err == nil {
+		conn.guard.beginBody()
+		err = parsePocketBody(ctx, conn.r, ctx.readBuf, &ctx.Response._HTTPPocket, opt)
+	}
+	conn.guard.end()
 	if conn.jar != nil && err == nil {
 		for _, v := range ctx.Response.Header().GetAll(HeaderSetCookie) {
 			_ = conn.jar.Update(conn.host, utils.S(v))
@@ -0,0 +1,205 @@
+package sha
+
+import (
+	"bytes"
+	"net"
+	"strings"
+
+	"github.com/zzztttkkk/sha/utils"
+)
+
+type _ForwardedHop struct {
+	ip    net.IP
+	proto string
+	host  string
+}
+
+type _ClientInfo struct {
+	ok     bool
+	ip     net.IP
+	scheme string
+	host   string
+}
+
+func (ci *_ClientInfo) reset() {
+	ci.ok = false
+	ci.ip = nil
+	ci.scheme = ""
+	ci.host = ""
+}
+
+func (ctx *RequestCtx) trustedProxies() []*net.IPNet {
+	if ctx.ctx == nil {
+		return nil
+	}
+	s, ok := ctx.ctx.Value(CtxKeyServer).(*Server)
+	if !ok {
+		return nil
+	}
+	return s.trustedProxies
+}
+
+func addrToIP(addr net.Addr) net.IP {
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		return v.IP
+	case *net.UDPAddr:
+		return v.IP
+	}
+	return nil
+}
+
+func unquote(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > 1 && v[0] == '"' && v[len(v)-1] == '"' {
+		v = strings.Replace(v[1:len(v)-1], "\\", "", -1)
+	}
+	return v
+}
+
+// parseNodeIP parses the node of `Forwarded` and `X-Forwarded-For`, such as `192.0.2.43`, `192.0.2.43:47011`,
+// `[2001:db8:cafe::17]:4711` or `2001:db8:cafe::17`. the obfuscated identifiers and `unknown` return nil.
+func parseNodeIP(v string) net.IP {
+	v = unquote(v)
+	if len(v) > 0 && v[0] == '[' {
+		ind := strings.IndexByte(v, ']')
+		if ind < 0 {
+			return nil
+		}
+		v = v[1:ind]
+	} else if strings.Count(v, ":") == 1 {
+		v = v[:strings.IndexByte(v, ':')]
+	}
+	return net.ParseIP(v)
+}
+
+// parseForwarded parses RFC 7239 `Forwarded` headers, hops are ordered from the client to the nearest proxy.
+func parseForwarded(values [][]byte) []_ForwardedHop {
+	var hops []_ForwardedHop
+	for _, value := range values {
+		for _, element := range strings.Split(utils.S(value), ",") {
+			var hop _ForwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				ind := strings.IndexByte(pair, '=')
+				if ind < 0 {
+					continue
+				}
+				val := pair[ind+1:]
+				switch strings.ToLower(strings.TrimSpace(pair[:ind])) {
+				case "for":
+					hop.ip = parseNodeIP(val)
+				case "proto":
+					hop.proto = strings.ToLower(unquote(val))
+				case "host":
+					hop.host = unquote(val)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+func splitHeaderValues(values [][]byte) []string {
+	var rv []string
+	for _, value := range values {
+		for _, v := range bytes.Split(value, []byte(",")) {
+			rv = append(rv, strings.TrimSpace(string(v)))
+		}
+	}
+	return rv
+}
+
+// xForwardedHops builds hops from `X-Forwarded-For`, `X-Forwarded-Proto` and `X-Forwarded-Host`.
+// if the count of proto or host values does not match the count of `X-Forwarded-For`, the rightmost one is used,
+// which is set by the nearest proxy.
+func xForwardedHops(header *Header) []_ForwardedHop {
+	ips := splitHeaderValues(header.GetAll(HeaderXForwardedFor))
+	protos := splitHeaderValues(header.GetAll(HeaderXForwardedProto))
+	hosts := splitHeaderValues(header.GetAll(HeaderXForwardedHost))
+
+	hops := make([]_ForwardedHop, len(ips))
+	for i, v := range ips {
+		hop := &hops[i]
+		hop.ip = parseNodeIP(v)
+		if len(protos) == len(ips) {
+			hop.proto = strings.ToLower(protos[i])
+		} else if len(protos) > 0 {
+			hop.proto = strings.ToLower(protos[len(protos)-1])
+		}
+		if len(hosts) == len(ips) {
+			hop.host = hosts[i]
+		} else if len(hosts) > 0 {
+			hop.host = hosts[len(hosts)-1]
+		}
+	}
+	return hops
+}
+
+func (ctx *RequestCtx) resolveClientInfo() *_ClientInfo {
+	ci := &ctx.clientInfo
+	if ci.ok {
+		return ci
+	}
+	ci.ok = true
+
+	if ctx.conn != nil {
+		ci.ip = addrToIP(ctx.conn.RemoteAddr())
+	}
+	ci.scheme = "http"
+	if ctx.IsTLS() {
+		ci.scheme = "https"
+	}
+	if host, ok := ctx.Request.Header().Get(HeaderHost); ok {
+		ci.host = string(host)
+	} else {
+		ci.host = string(ctx.Request.URL.Host)
+	}
+
+	trusted := ctx.trustedProxies()
+	if ci.ip == nil || !ipInNets(ci.ip, trusted) {
+		return ci
+	}
+
+	header := ctx.Request.Header()
+	var hops []_ForwardedHop
+	if values := header.GetAll(HeaderForwarded); len(values) > 0 {
+		hops = parseForwarded(values)
+	} else if values := header.GetAll(HeaderXForwardedFor); len(values) > 0 {
+		hops = xForwardedHops(header)
+	} else if v, ok := header.Get(HeaderXRealIP); ok {
+		if ip := parseNodeIP(utils.S(v)); ip != nil {
+			ci.ip = ip
+		}
+		return ci
+	}
+
+	// right-to-left, the first untrusted hop is the client
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := &hops[i]
+		if hop.ip == nil { // unknown or obfuscated, the hops on the left can not be trusted
+			break
+		}
+		ci.ip = hop.ip
+		if hop.proto == "http" || hop.proto == "https" {
+			ci.scheme = hop.proto
+		}
+		if len(hop.host) > 0 {
+			ci.host = hop.host
+		}
+		if !ipInNets(hop.ip, trusted) {
+			break
+		}
+	}
+	return ci
+}
+
+// ClientIP returns the ip of the client. if the peer is a trusted proxy(`ServerOptions.TrustedProxies`),
+// `Forwarded`, `X-Forwarded-For` or `X-Real-IP` is read from right to left, skipping the trusted hops.
+func (ctx *RequestCtx) ClientIP() net.IP { return ctx.resolveClientInfo().ip }
+
+// Scheme returns the scheme of the original request, `http` or `https`.
+func (ctx *RequestCtx) Scheme() string { return ctx.resolveClientInfo().scheme }
+
+// OriginalHost returns the host of the original request.
+func (ctx *RequestCtx) OriginalHost() string { return ctx.resolveClientInfo().host }
@@ -0,0 +1,67 @@
+package sha
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+type _AddrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *_AddrConn) RemoteAddr() net.Addr { return c.remote }
+
+func TestRequestCtx_ClientIP(t *testing.T) {
+	s := &Server{trustedProxies: parseCIDRs([]string{"10.0.0.0/8", "2001:db8::1"})}
+	baseCtx := context.WithValue(context.Background(), CtxKeyServer, s)
+
+	cases := []struct {
+		peer    string
+		headers [][2]string
+		ip      string
+		scheme  string
+		host    string
+	}{
+		{peer: "192.168.0.1", headers: [][2]string{{HeaderXForwardedFor, "1.1.1.1"}}, ip: "192.168.0.1", scheme: "http", host: "sha.local"},
+		{peer: "10.0.0.1", headers: [][2]string{{HeaderXRealIP, "1.1.1.1"}}, ip: "1.1.1.1", scheme: "http", host: "sha.local"},
+		{
+			peer: "10.0.0.1",
+			headers: [][2]string{
+				{HeaderXForwardedFor, "6.6.6.6, 1.1.1.1"},
+				{HeaderXForwardedFor, "10.0.0.2"},
+				{HeaderXForwardedProto, "https"},
+				{HeaderXForwardedHost, "example.com"},
+			},
+			ip: "1.1.1.1", scheme: "https", host: "example.com",
+		},
+		{peer: "10.0.0.1", headers: [][2]string{{HeaderXForwardedFor, "10.0.0.3, 10.0.0.2"}}, ip: "10.0.0.3", scheme: "http", host: "sha.local"},
+		{peer: "10.0.0.1", headers: [][2]string{{HeaderXForwardedFor, "1.1.1.1, unknown, 10.0.0.2"}}, ip: "10.0.0.2", scheme: "http", host: "sha.local"},
+		{
+			peer: "10.0.0.1",
+			headers: [][2]string{
+				{HeaderForwarded, `for=6.6.6.6;proto=http, for="[2001:db8:cafe::17]:4711";proto=https;host=example.com`},
+				{HeaderForwarded, `for=10.0.0.2:8080;proto=http;host=internal`},
+				{HeaderXForwardedFor, "3.3.3.3"},
+			},
+			ip: "2001:db8:cafe::17", scheme: "https", host: "example.com",
+		},
+		{peer: "10.0.0.1", headers: [][2]string{{HeaderForwarded, `for=_hidden, for=10.0.0.2`}}, ip: "10.0.0.2", scheme: "http", host: "sha.local"},
+		{peer: "2001:db8::1", headers: [][2]string{{HeaderForwarded, `for=1.1.1.1;proto=https`}}, ip: "1.1.1.1", scheme: "https", host: "sha.local"},
+	}
+
+	for i, c := range cases {
+		ctx := &RequestCtx{}
+		ctx.ctx = baseCtx
+		ctx.conn = &_AddrConn{remote: &net.TCPAddr{IP: net.ParseIP(c.peer), Port: 1234}}
+		ctx.Request.Header().SetString(HeaderHost, "sha.local")
+		for _, kv := range c.headers {
+			ctx.Request.Header().AppendString(kv[0], kv[1])
+		}
+
+		if ip := ctx.ClientIP(); !ip.Equal(net.ParseIP(c.ip)) || ctx.Scheme() != c.scheme || ctx.OriginalHost() != c.host {
+			t.Fatalf("case %d: unexpected result %s %s %s", i, ip, ctx.Scheme(), ctx.OriginalHost())
+		}
+	}
+}
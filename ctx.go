@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/zzztttkkk/sha/jsonx"
+	"github.com/zzztttkkk/sha/logx"
 	"github.com/zzztttkkk/sha/utils"
 )
 
@@ -26,12 +27,24 @@ type RequestCtx struct {
 	r          *bufio.Reader
 	w          *bufio.Writer
 	connTime   time.Time
+	h2         *_Http2Stream
+	clientInfo _ClientInfo
+	sw         _StreamWriter
+	watcher    *_ConnWatcher
+	route      *RouteOptions // the options of the matched route
+	pattern    string        // the pattern of the matched route
+	logger     logx.Logger
+	// the request id and its header, see `RequestID`
+	requestID       string
+	requestIDHeader string
 
 	Request  Request
 	Response Response
 
 	UserData userData
 	err      interface{}
+	// the panic or the error is handled by the recover of `Mux`
+	recovered bool
 }
 
 func (ctx *RequestCtx) TimeSpent() time.Duration {
@@ -50,6 +63,19 @@ func (ctx *RequestCtx) Err() error { return ctx.ctx.Err() }
 
 func (ctx *RequestCtx) Value(key interface{}) interface{} { return ctx.ctx.Value(key) }
 
+// Logger returns `MuxOptions.Logger` of the mux which is handling the request, or `Server.Logger`.
+func (ctx *RequestCtx) Logger() logx.Logger {
+	if ctx.logger != nil {
+		return ctx.logger
+	}
+	if ctx.ctx != nil {
+		if s, ok := ctx.ctx.Value(CtxKeyServer).(*Server); ok {
+			return s.logger()
+		}
+	}
+	return logx.Default()
+}
+
 type WrappedError struct {
 	A interface{}
 	B interface{}
@@ -87,16 +113,29 @@ func Unwrap(ctx context.Context) *RequestCtx {
 
 func (ctx *RequestCtx) Close() { ctx.Response.Header().SetString(HeaderConnection, headerValClose) }
 
+// RoutePattern returns the pattern of the route matched by `Mux`, such as `/users/{id}`, or empty if not matched.
+func (ctx *RequestCtx) RoutePattern() string { return ctx.pattern }
+
+// RouteName returns the name of the route matched by `Mux`, see `RouteOptions.Name`.
+func (ctx *RequestCtx) RouteName() string {
+	if ctx.route == nil {
+		return ""
+	}
+	return ctx.route.Name
+}
+
 func (ctx *RequestCtx) IsTLS() bool { return ctx.Request.flags.Has(_ReqFlagIsTLS) }
 
 func (ctx *RequestCtx) Conn() net.Conn { return ctx.conn }
 
+// RemoteAddr returns the client address, which is read from the proxy protocol header if `ServerOptions.ProxyProtocol` is enabled.
 func (ctx *RequestCtx) RemoteAddr() net.Addr { return ctx.conn.RemoteAddr() }
 
 func (ctx *RequestCtx) LocalAddr() net.Addr { return ctx.conn.LocalAddr() }
 
 func (ctx *RequestCtx) Hijack() net.Conn {
 	ctx.Request.hijack()
+	ctx.watcher.stop()
 	return ctx.conn
 }
 
@@ -121,7 +160,15 @@ func (ctx *RequestCtx) prepareForNextRequest(maxCap int) {
 	ctx.Request.Reset(maxCap)
 	ctx.Response.reset(maxCap)
 	ctx.UserData.Reset()
+	ctx.clientInfo.reset()
+	ctx.sw.reset()
+	ctx.route = nil
+	ctx.pattern = ""
+	ctx.logger = nil
+	ctx.requestID = ""
+	ctx.requestIDHeader = ""
 	ctx.err = nil
+	ctx.recovered = false
 }
 
 func (ctx *RequestCtx) resetConn() {
@@ -129,6 +176,8 @@ func (ctx *RequestCtx) resetConn() {
 	ctx.cancelFunc = nil
 	ctx.conn = nil
 	ctx.connTime = time.Time{}
+	ctx.h2 = nil
+	ctx.watcher = nil
 	ctx.r.Reset(nil)
 	ctx.w.Reset(nil)
 	ctx.Response.header.fromOutSide = false
@@ -173,8 +222,29 @@ func (ctx *RequestCtx) WriteHTML(v []byte) error {
 	return e
 }
 
+type _CountingReader struct {
+	io.Reader
+	n *int64
+}
+
+func (r *_CountingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
+
 func (ctx *RequestCtx) WriteStream(stream io.Reader) error {
-	return sendChunkedStreamResponse(ctx.w, ctx, stream)
+	stream = &_CountingReader{Reader: stream, n: &ctx.Response.written}
+	if ctx.h2 != nil {
+		return ctx.h2.writeStream(stream)
+	}
+	err := sendChunkedStreamResponse(ctx.w, ctx, stream)
+	if err != ErrChunkedResponseRequireHTTP11OrHigher { // the response is sent, or the connection is broken
+		ctx.sw.started = true
+		ctx.sw.finished = true
+		ctx.sw.err = err
+	}
+	return err
 }
 
 func (ctx *RequestCtx) WriteFile(f io.Reader, ext string) error {
@@ -0,0 +1,152 @@
+package sha
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+var ErrStreamWriterClosed = errors.New("sha: stream writer is closed")
+
+// StreamWriter writes the response incrementally, see `RequestCtx.StreamWriter`.
+type StreamWriter interface {
+	io.Writer
+	// Flush sends the status line and the headers on the first call, and then sends the buffered data.
+	Flush() error
+}
+
+// the buffered data of the stream writer is sent automatically if it is larger than this size
+const streamWriterBufferSize = 16 * 1024
+
+type _StreamWriter struct {
+	ctx      *RequestCtx
+	started  bool // the status line and the headers are sent
+	finished bool
+	chunked  bool
+	err      error
+}
+
+// StreamWriter returns a writer which sends the response incrementally, the data is buffered until `Flush`.
+// the status line and the headers are sent on the first flush, so they can not be changed after that.
+// the response is finished after the handler returns, the trailer is sent at that time.
+//
+// http1.1 response is chunked, http1.0 response is delimited by closing the connection.
+// `ServerOptions.WriteTimeout` or `RouteOptions.WriteTimeout` is applied to each flush of the http1.x response.
+// the write errors, such as the client is disconnected, are returned by `Write` and `Flush`.
+func (ctx *RequestCtx) StreamWriter() StreamWriter {
+	sw := &ctx.sw
+	sw.ctx = ctx
+	return sw
+}
+
+func (sw *_StreamWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	if sw.finished {
+		return 0, ErrStreamWriterClosed
+	}
+	res := &sw.ctx.Response
+	n, err := res.Write(p)
+	if err != nil {
+		sw.err = err
+		return n, err
+	}
+	if res.body != nil && res.body.Len() >= streamWriterBufferSize {
+		return n, sw.send(false)
+	}
+	return n, nil
+}
+
+func (sw *_StreamWriter) Flush() error {
+	if sw.err != nil {
+		return sw.err
+	}
+	if sw.finished {
+		return ErrStreamWriterClosed
+	}
+	if cw := sw.ctx.Response.cw; cw != nil {
+		if err := cw.Flush(); err != nil {
+			sw.err = err
+			return err
+		}
+	}
+	return sw.send(false)
+}
+
+// finish ends the compressed data and sends the rest of the response, it is called after the handler returns.
+func (sw *_StreamWriter) finish() error {
+	if sw.ctx == nil || sw.finished {
+		return sw.err
+	}
+	sw.finished = true
+	if sw.err != nil {
+		return sw.err
+	}
+	if cw := sw.ctx.Response.cw; cw != nil {
+		var err error
+		if c, ok := cw.(io.Closer); ok {
+			err = c.Close()
+		} else {
+			err = cw.Flush()
+		}
+		if err != nil {
+			sw.err = err
+			return err
+		}
+	}
+	return sw.send(true)
+}
+
+func (sw *_StreamWriter) send(last bool) error {
+	var err error
+	if sw.ctx.h2 != nil {
+		err = sw.ctx.h2.sendStream(last)
+	} else {
+		err = sw.sendHTTP11(last)
+	}
+	sw.started = true
+	if err != nil {
+		sw.err = err
+	}
+	return err
+}
+
+func (sw *_StreamWriter) sendHTTP11(last bool) error {
+	const endLine = "\r\n"
+
+	ctx := sw.ctx
+	res := &ctx.Response
+	w := ctx.w
+	if timeout := writeTimeout(ctx); timeout > 0 {
+		_ = ctx.conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+
+	if !sw.started {
+		sw.chunked = ctx.Request.isHTTP11()
+		writeStreamHeader(w, res, sw.chunked)
+	}
+	if res.body != nil && res.body.Len() > 0 {
+		if sw.chunked {
+			_, _ = w.WriteString(strconv.FormatInt(int64(res.body.Len()), 16))
+			_, _ = w.WriteString(endLine)
+			_, _ = w.Write(res.body.Bytes())
+			_, _ = w.WriteString(endLine)
+		} else {
+			_, _ = w.Write(res.body.Bytes())
+		}
+		res.body.Reset()
+	}
+	if last && sw.chunked {
+		writeLastChunk(w, &res.trailer)
+	}
+	return w.Flush()
+}
+
+func (sw *_StreamWriter) reset() { *sw = _StreamWriter{} }
+
+// responseStarted returns true if the status line and the headers are sent, or the connection is hijacked.
+func (ctx *RequestCtx) responseStarted() bool {
+	return ctx.sw.started || (ctx.h2 != nil && ctx.h2.headersSent) || ctx.Request.flags.Has(_ReqFlagHijacked)
+}
@@ -0,0 +1,121 @@
+package sha
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// streamWriterTestHandler writes the rows one by one, the next row is written after the client has received the previous.
+func streamWriterTestHandler(received chan struct{}) RequestCtxHandler {
+	return RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		if ctx.Request.Path() == "/gzip" {
+			ctx.CompressGzip()
+		}
+		ctx.Response.Trailer().SetString("X-Rows", "")
+		w := ctx.StreamWriter()
+		for i := 0; i < 3; i++ {
+			_, _ = fmt.Fprintf(w, "row %d\n", i)
+			if err := w.Flush(); err != nil {
+				return
+			}
+			select {
+			case <-received:
+			case <-time.After(time.Second * 3):
+				return
+			}
+		}
+		ctx.Response.Trailer().SetString("X-Rows", "3")
+	})
+}
+
+func checkStreamWriterTestResponse(t *testing.T, cli *http.Client, url string, received chan struct{}) {
+	res, err := cli.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	r := bufio.NewReader(res.Body)
+	for i := 0; i < 3; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil || line != fmt.Sprintf("row %d\n", i) {
+			t.Fatalf("unexpected line %q %v", line, err)
+		}
+		received <- struct{}{}
+	}
+	if rest, _ := ioutil.ReadAll(r); len(rest) != 0 || res.Trailer.Get("X-Rows") != "3" {
+		t.Fatalf("unexpected response %q %v", rest, res.Trailer)
+	}
+}
+
+func TestRequestCtx_StreamWriter(t *testing.T) {
+	received := make(chan struct{})
+	addr, stop := startHTTP11TestServer(t, streamWriterTestHandler(received), nil)
+	defer stop()
+
+	cli := &http.Client{}
+	checkStreamWriterTestResponse(t, cli, "http://"+addr+"/", received)
+	checkStreamWriterTestResponse(t, cli, "http://"+addr+"/", received) // keep-alive
+
+	// the rows are flushed through the compression writer, and the compressed stream is completed after the handler
+	res, err := cli.Get("http://" + addr + "/gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Uncompressed { // the transport requests gzip and decompresses it
+		t.Fatal("the response is not compressed")
+	}
+	r := bufio.NewReader(res.Body)
+	for i := 0; i < 3; i++ {
+		if line, _ := r.ReadString('\n'); line != fmt.Sprintf("row %d\n", i) {
+			t.Fatalf("unexpected line %q", line)
+		}
+		received <- struct{}{}
+	}
+	if rest, err := ioutil.ReadAll(r); err != nil || len(rest) != 0 {
+		t.Fatalf("unexpected rest %q %v", rest, err)
+	}
+	_ = res.Body.Close()
+
+	// http1.0 response is delimited by closing the connection
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	go func() {
+		for i := 0; i < 3; i++ {
+			received <- struct{}{}
+		}
+	}()
+	data, _ := ioutil.ReadAll(conn)
+	if !strings.HasSuffix(string(data), "\r\n\r\nrow 0\nrow 1\nrow 2\n") || strings.Contains(string(data), "Transfer-Encoding") {
+		t.Fatalf("unexpected response %q", data)
+	}
+}
+
+func TestHTTP2Protocol_StreamWriter(t *testing.T) {
+	received := make(chan struct{})
+	addr, stop := startHTTP2TestServer(t, streamWriterTestHandler(received))
+	defer stop()
+
+	cli := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+	checkStreamWriterTestResponse(t, cli, "http://"+addr+"/", received)
+}
@@ -16,6 +16,11 @@ func (ctx *RequestCtx) MustValidateForm(dist interface{}) {
 
 // ValidateForm error pointer ->  error interface
 func (ctx *RequestCtx) ValidateForm(dist interface{}) HTTPError {
+	if ctx.Request.BodyForm() == nil {
+		if err, ok := ctx.Request.bodyErr.(HTTPError); ok {
+			return err
+		}
+	}
 	if err := validator.BindAndValidateForm(_Former{&ctx.Request}, dist); err != nil {
 		return err
 	}
@@ -2,7 +2,10 @@ package sha
 
 import "github.com/zzztttkkk/sha/validator"
 
-var _ validator.Former = _Former{}
+var (
+	_ validator.Former     = _Former{}
+	_ validator.FileFormer = _Former{}
+)
 
 type _Former struct{ *Request }
 
@@ -33,3 +36,19 @@ func (f _Former) FormValues(name string) [][]byte {
 }
 
 func (f _Former) HeaderValues(name string) [][]byte { return f.Request.Header().GetAll(name) }
+
+func (f _Former) FileValue(name string) (validator.FormFile, bool) {
+	file := f.Request.Files().Get(name)
+	if file == nil {
+		return nil, false
+	}
+	return file, true
+}
+
+func (f _Former) FileValues(name string) []validator.FormFile {
+	var rv []validator.FormFile
+	for _, file := range f.Request.Files().GetAll(name) {
+		rv = append(rv, file)
+	}
+	return rv
+}
@@ -47,6 +47,7 @@ func (p *RequestCtxPool) Acquire() *RequestCtx {
 	if ctx.w == nil {
 		ctx.w = bufio.NewWriterSize(nil, p.opt.ReadBufferSize)
 	}
+	ctx.Request.multipart = &p.opt.Multipart
 	return ctx
 }
 
@@ -66,7 +66,12 @@ type FormFile struct {
 	Header   Header
 
 	buf    []byte
+	size   int64
 	cursor int64
+
+	// the file content is spilled to a temp file, if it is larger than `MultipartOptions.MemoryThreshold`
+	f       *os.File
+	tmpName string
 }
 
 func (file *FormFile) meta() {
@@ -90,27 +95,35 @@ func (file *FormFile) reset(maxCap int) {
 	if maxCap > 0 && cap(file.buf) > maxCap {
 		file.buf = nil
 	}
+	file.size = 0
 	file.cursor = 0
+	if file.f != nil {
+		_ = file.f.Close()
+		file.f = nil
+	}
+	if len(file.tmpName) > 0 {
+		_ = os.Remove(file.tmpName)
+		file.tmpName = ""
+	}
 }
 
 func (file *FormFile) Read(p []byte) (int, error) {
-	var (
-		fileSize = int64(len(file.buf))
-		bufSize  = int64(len(p))
-	)
-
-	if file.cursor >= fileSize {
+	if file.cursor >= file.size {
 		return 0, io.EOF
 	}
 
-	if file.cursor+bufSize <= fileSize {
-		file.cursor += bufSize
-		copy(p, file.buf[file.cursor:file.cursor+bufSize-1])
-		return len(p), nil
+	var n int
+	if file.f != nil {
+		var err error
+		n, err = file.f.ReadAt(p, file.cursor)
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+	} else {
+		n = copy(p, file.buf[file.cursor:])
 	}
-	file.cursor = fileSize
-	copy(p, file.buf[file.cursor:])
-	return int(fileSize - file.cursor), nil
+	file.cursor += int64(n)
+	return n, nil
 }
 
 func (file *FormFile) Seek(offset int64, whence int) (int64, error) {
@@ -120,7 +133,7 @@ func (file *FormFile) Seek(offset int64, whence int) (int64, error) {
 	case io.SeekStart:
 		file.cursor = offset
 	case io.SeekEnd:
-		file.cursor = int64(len(file.buf)) - offset
+		file.cursor = file.size + offset
 	}
 	if file.cursor < 0 {
 		file.cursor = 0
@@ -132,14 +145,40 @@ var _ io.ReadSeeker = (*FormFile)(nil)
 
 var formFilePool = sync.Pool{New: func() interface{} { return &FormFile{} }}
 
-func (file *FormFile) Data() []byte { return file.buf }
+func (file *FormFile) Size() int64 { return file.size }
+
+// IsSpilled returns true, if the file content is stored in a temp file.
+func (file *FormFile) IsSpilled() bool { return file.f != nil }
 
+// Data returns the file content. the spilled file will be read into memory.
+func (file *FormFile) Data() []byte {
+	if file.f != nil && int64(len(file.buf)) != file.size {
+		buf := bytes.NewBuffer(file.buf[:0])
+		_, _ = buf.ReadFrom(io.NewSectionReader(file.f, 0, file.size))
+		file.buf = buf.Bytes()
+	}
+	return file.buf
+}
+
+// Save the spilled file is moved by `os.Rename`, the in-memory file is written.
 func (file *FormFile) Save(name string) error {
-	f, e := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0644)
+	if len(file.tmpName) > 0 {
+		if e := os.Rename(file.tmpName, name); e == nil {
+			file.tmpName = ""
+			return nil
+		}
+		// rename across devices, fallback to copy
+	}
+
+	f, e := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if e != nil {
 		return e
 	}
 	defer f.Close()
+	if file.f != nil {
+		_, e = io.Copy(f, io.NewSectionReader(file.f, 0, file.size))
+		return e
+	}
 	_, e = f.Write(file.buf)
 	return e
 }
@@ -196,143 +235,6 @@ func (req *Request) QueryValues(name string) [][]byte {
 	return nil
 }
 
-func (req *Request) parseMultiPartForm() bool {
-	var (
-		status  int
-		begin   int
-		current *FormFile
-		hItem   *utils.KvItem
-		keyDone bool
-		skipSp  bool
-		skipNL  bool
-		end     bool
-		data    = req.body.Bytes()
-	)
-
-	for ind, b := range data {
-		switch status {
-		case 0:
-			req.boundaryLine = append(req.boundaryLine, b)
-			if b == '\n' {
-				if !bytes.Equal(req.boundaryLine, req.boundaryBegin) {
-					return false
-				}
-				status++
-				req.boundaryLine = req.boundaryLine[:0]
-				continue
-			}
-			if len(req.boundaryLine) > len(req.boundaryBegin) {
-				return false
-			}
-			continue
-		case 1:
-			if b == ':' {
-				keyDone = true
-				skipSp = true
-				continue
-			}
-
-			if skipSp {
-				if b == ' ' {
-					skipSp = false
-					continue
-				}
-				return false
-			}
-
-			if skipNL {
-				if b == '\n' {
-					skipNL = false
-					continue
-				}
-				return false
-			}
-
-			if b == '\r' {
-				keyDone = false
-				skipNL = true
-				if hItem == nil {
-					status++
-					begin = ind + 2
-					continue
-				}
-				hItem = nil
-				continue
-			}
-
-			if hItem == nil {
-				if current == nil {
-					current = formFilePool.Get().(*FormFile)
-					current.Header.fromOutSide = true
-				}
-
-				hItem = current.Header.AppendBytes(nil, nil)
-			}
-
-			if keyDone {
-				hItem.Val = append(hItem.Val, b)
-			} else {
-				if b > 127 {
-					return false
-				}
-				hItem.Key = append(hItem.Key, toLowerTable[b])
-			}
-		case 2:
-			if skipNL {
-				if b == '\n' {
-					skipNL = false
-					continue
-				}
-				return false
-			}
-
-			if b == '\n' {
-				req.boundaryLine = append(req.boundaryLine, b)
-
-				end = bytes.Equal(req.boundaryLine, req.boundaryEnd)
-				if end || bytes.Equal(req.boundaryLine, req.boundaryBegin) {
-					if current == nil {
-						return false
-					}
-					current.buf = data[begin : ind-len(req.boundaryLine)-1]
-					current.meta()
-
-					if len(current.Name) < 1 {
-						current.reset(0)
-						formFilePool.Put(current)
-					} else {
-						if len(current.FileName) > 0 {
-							req.files = append(req.files, current)
-						} else {
-							item := req.bodyForm.AppendBytes(nil, nil)
-							item.Key = append(item.Key, current.Name...)
-							item.Val = append(item.Val, current.buf...)
-							current.reset(0)
-							formFilePool.Put(current)
-						}
-					}
-
-					status = 1
-					current = nil
-				}
-
-				if end {
-					return true
-				}
-				req.boundaryLine = req.boundaryLine[:0]
-				continue
-			}
-			if len(req.boundaryLine) >= len(req.boundaryEnd) {
-				continue
-			}
-			req.boundaryLine = append(req.boundaryLine, b)
-		}
-	}
-	return false
-}
-
-var boundaryBytes = []byte("boundary=")
-
 const (
 	_BodyUnParsed = iota
 	_BodyUnsupportedType
@@ -340,42 +242,42 @@ const (
 )
 
 func (req *Request) parseBodyBuf() {
-	buf := req._HTTPPocket.body
-	if buf == nil || buf.Len() < 1 {
-		req.bodyStatus = _BodyUnsupportedType
-		return
-	}
-
 	typeValue := req.Header().ContentType()
 	if len(typeValue) < 1 {
 		req.bodyStatus = _BodyUnsupportedType
 		return
 	}
 
-	if bytes.HasPrefix(typeValue, utils.B(MIMEForm)) {
-		req.bodyForm.FromURLEncoded(buf.Bytes())
-		req.bodyStatus = _BodyOK
-		return
-	}
-
 	if bytes.HasPrefix(typeValue, utils.B(MIMEMultiPart)) {
-		ind := bytes.Index(typeValue, boundaryBytes)
-		if ind < 1 {
+		_, params, err := mime.ParseMediaType(utils.S(typeValue))
+		boundary := params["boundary"]
+		if err != nil || len(boundary) < 1 {
 			req.bodyStatus = _BodyUnsupportedType
 			return
 		}
 
-		req.boundaryBegin = append(req.boundaryBegin, "--"...)
-		req.boundaryBegin = append(req.boundaryBegin, typeValue[ind+9:]...)
-
-		req.boundaryEnd = append(req.boundaryEnd, req.boundaryBegin...)
-		req.boundaryEnd = append(req.boundaryEnd, "--\r\n"...)
-		req.boundaryBegin = append(req.boundaryBegin, "\r\n"...)
-		if req.parseMultiPartForm() {
+		// the multipart body is parsed from the connection directly, if it is streaming
+		if req.bodyErr = req.parseMultiPartForm(req.BodyStream(), boundary); req.bodyErr == nil {
 			req.bodyStatus = _BodyOK
 		} else {
 			req.bodyStatus = _BodyUnsupportedType
 		}
+		return
+	}
+
+	if req.bodyStream.enabled && !req.readBodyStream() {
+		req.bodyStatus = _BodyUnsupportedType
+		return
+	}
+
+	buf := req._HTTPPocket.body
+	if buf == nil || buf.Len() < 1 {
+		req.bodyStatus = _BodyUnsupportedType
+		return
+	}
+
+	if bytes.HasPrefix(typeValue, utils.B(MIMEForm)) {
+		req.bodyForm.FromURLEncoded(buf.Bytes())
 		req.bodyStatus = _BodyOK
 		return
 	}
@@ -0,0 +1,168 @@
+package sha
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+)
+
+type MultipartOptions struct {
+	MaxFileSize int64 `json:"max_file_size" toml:"max-file-size"` // <1 means no limit
+	// zero means 32MB, negative means no limit
+	MaxTotalSize int64 `json:"max_total_size" toml:"max-total-size"`
+	// the non-file fields are kept in memory, zero means 1MB, negative means no limit
+	MaxFieldSize    int64  `json:"max_field_size" toml:"max-field-size"`
+	MemoryThreshold int64  `json:"memory_threshold" toml:"memory-threshold"` // files larger than this will be spilled to disk
+	TempDir         string `json:"temp_dir" toml:"temp-dir"`
+}
+
+var defaultMultipartOption = MultipartOptions{
+	MaxTotalSize:    1024 * 1024 * 32,
+	MaxFieldSize:    1024 * 1024,
+	MemoryThreshold: 1024 * 64,
+}
+
+// multipartSizeLimit returns the limit of the option, zero means the default and negative means no limit.
+func multipartSizeLimit(v, defaultV int64) int64 {
+	if v == 0 {
+		v = defaultV
+	}
+	if v < 0 {
+		return 1<<63 - 2
+	}
+	return v
+}
+
+type _FormSizeError string
+
+func (err _FormSizeError) Error() string { return string(err) }
+
+func (err _FormSizeError) StatusCode() int { return StatusRequestEntityTooLarge }
+
+var (
+	ErrFormFileTooLarge      HTTPError = _FormSizeError("sha: multipart form file is too large")
+	ErrFormFieldTooLarge     HTTPError = _FormSizeError("sha: multipart form field is too large")
+	ErrMultipartFormTooLarge HTTPError = _FormSizeError("sha: multipart form is too large")
+)
+
+func (req *Request) multipartOptions() *MultipartOptions {
+	if req.multipart != nil {
+		return req.multipart
+	}
+	return &defaultRCtxPool.opt.Multipart
+}
+
+// readFrom reads at most `limit` bytes of part, the rest part will be spilled to a temp file if it is larger than
+// the memory threshold. a negative `threshold` means never spilled.
+func (file *FormFile) readFrom(r io.Reader, limit, threshold int64, tempDir string) (int64, error) {
+	lr := &io.LimitedReader{R: r, N: limit + 1}
+	buf := bytes.NewBuffer(file.buf[:0])
+
+	var n int64
+	var err error
+	if threshold < 0 {
+		n, err = buf.ReadFrom(lr)
+	} else {
+		n, err = io.CopyN(buf, lr, threshold+1)
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	file.buf = buf.Bytes()
+	file.size = n
+	if err != nil || threshold < 0 || n <= threshold {
+		return n, err
+	}
+
+	file.f, err = ioutil.TempFile(tempDir, "sha.multipart.")
+	if err != nil {
+		return n, err
+	}
+	file.tmpName = file.f.Name()
+	if _, err = file.f.Write(file.buf); err != nil {
+		return n, err
+	}
+	file.buf = file.buf[:0]
+
+	m, err := io.Copy(file.f, lr)
+	file.size += m
+	return file.size, err
+}
+
+func (req *Request) parseMultiPartForm(r io.Reader, boundary string) error {
+	opt := req.multipartOptions()
+	mr := multipart.NewReader(r, boundary)
+
+	maxTotal := multipartSizeLimit(opt.MaxTotalSize, defaultMultipartOption.MaxTotalSize)
+	maxField := multipartSizeLimit(opt.MaxFieldSize, defaultMultipartOption.MaxFieldSize)
+
+	var total int64
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		current := formFilePool.Get().(*FormFile)
+		current.Header.fromOutSide = true
+		for k, vl := range part.Header {
+			for _, v := range vl {
+				item := current.Header.AppendBytes(nil, nil)
+				for i := 0; i < len(k); i++ {
+					item.Key = append(item.Key, toLowerTable[k[i]])
+				}
+				item.Val = append(item.Val, v...)
+			}
+		}
+		current.meta()
+
+		if len(current.Name) < 1 {
+			current.reset(0)
+			formFilePool.Put(current)
+			continue
+		}
+
+		limit := maxTotal - total
+		isFile := len(current.FileName) > 0
+		var limitErr HTTPError = ErrMultipartFormTooLarge
+		if isFile && opt.MaxFileSize > 0 && opt.MaxFileSize < limit {
+			limit = opt.MaxFileSize
+			limitErr = ErrFormFileTooLarge
+		}
+		if !isFile && maxField < limit {
+			limit = maxField
+			limitErr = ErrFormFieldTooLarge
+		}
+
+		threshold := int64(-1)
+		if isFile {
+			threshold = opt.MemoryThreshold
+		}
+
+		n, err := current.readFrom(part, limit, threshold, opt.TempDir)
+		if err == nil && n > limit {
+			err = limitErr
+		}
+		if err != nil {
+			current.reset(0)
+			formFilePool.Put(current)
+			return err
+		}
+		total += n
+
+		if isFile {
+			req.files = append(req.files, current)
+			continue
+		}
+
+		item := req.bodyForm.AppendBytes(nil, nil)
+		item.Key = append(item.Key, current.Name...)
+		item.Val = append(item.Val, current.buf...)
+		current.reset(0)
+		formFilePool.Put(current)
+	}
+}
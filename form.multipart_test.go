@@ -0,0 +1,141 @@
+package sha
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeMultipartRequest(t *testing.T, req *Request, opt *MultipartOptions, files map[string][]byte) *Request {
+	buf := bytes.NewBuffer(nil)
+	w := multipart.NewWriter(buf)
+	_ = w.WriteField("name", "sha")
+	for name, data := range files {
+		fw, err := w.CreateFormFile(name, name+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fw.Write(data)
+	}
+	_ = w.Close()
+
+	req.multipart = opt
+	req.Header().SetContentType(w.FormDataContentType())
+	_, _ = req.Write(buf.Bytes())
+	return req
+}
+
+func TestMultipartForm_Spill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sha.multipart.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	small := []byte("small")
+	large := bytes.Repeat([]byte("large"), 1000)
+	req := makeMultipartRequest(
+		t, &Request{},
+		&MultipartOptions{MemoryThreshold: 1024, TempDir: dir},
+		map[string][]byte{"small": small, "large": large},
+	)
+	defer req.Reset(0)
+
+	if v, _ := req.BodyFormValue("name"); string(v) != "sha" {
+		t.Fatalf("unexpected form value %q", v)
+	}
+
+	sf := req.Files().Get("small")
+	if sf == nil || sf.IsSpilled() || !bytes.Equal(sf.Data(), small) {
+		t.Fatalf("bad small file")
+	}
+
+	lf := req.Files().Get("large")
+	if lf == nil || !lf.IsSpilled() || lf.Size() != int64(len(large)) {
+		t.Fatalf("bad large file")
+	}
+	data, _ := ioutil.ReadAll(lf)
+	if !bytes.Equal(data, large) {
+		t.Fatalf("bad large file content")
+	}
+
+	tmpName := lf.tmpName
+	dist := filepath.Join(dir, "saved.txt")
+	if err = lf.Save(dist); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(tmpName); !os.IsNotExist(err) {
+		t.Fatalf("temp file should be renamed")
+	}
+	saved, _ := ioutil.ReadFile(dist)
+	if !bytes.Equal(saved, large) {
+		t.Fatalf("bad saved file content")
+	}
+}
+
+func TestMultipartForm_Limits(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 2048)
+
+	req := makeMultipartRequest(t, &Request{}, &MultipartOptions{MaxFileSize: 1024}, map[string][]byte{"a": data})
+	if req.Files() != nil || req.bodyErr != ErrFormFileTooLarge {
+		t.Fatalf("unexpected error %v", req.bodyErr)
+	}
+	req.Reset(0)
+
+	req = makeMultipartRequest(t, &Request{}, &MultipartOptions{MaxTotalSize: 3000}, map[string][]byte{"a": data, "b": data})
+	if req.Files() != nil || req.bodyErr != ErrMultipartFormTooLarge {
+		t.Fatalf("unexpected error %v", req.bodyErr)
+	}
+	req.Reset(0)
+
+	// the field `name` is `sha`, larger than the limit
+	req = makeMultipartRequest(t, &Request{}, &MultipartOptions{MaxFieldSize: 2}, map[string][]byte{"a": data})
+	if req.Files() != nil || req.bodyErr != ErrFormFieldTooLarge {
+		t.Fatalf("unexpected error %v", req.bodyErr)
+	}
+	req.Reset(0)
+
+	req = makeMultipartRequest(t, &Request{}, &MultipartOptions{MaxFieldSize: -1, MaxTotalSize: -1}, map[string][]byte{"a": data})
+	if v, _ := req.BodyFormValue("name"); string(v) != "sha" || req.Files().Get("a") == nil {
+		t.Fatalf("unexpected error %v", req.bodyErr)
+	}
+	req.Reset(0)
+
+	if v := multipartSizeLimit(0, defaultMultipartOption.MaxTotalSize); v != 1024*1024*32 {
+		t.Fatalf("unexpected default limit %d", v)
+	}
+}
+
+func TestMultipartForm_Validate(t *testing.T) {
+	type Form struct {
+		Name   string      `vld:"name"`
+		Small  *FormFile   `vld:"small,filesize=-10"`
+		Others []*FormFile `vld:"large,optional"`
+	}
+
+	ctx := &RequestCtx{}
+	makeMultipartRequest(
+		t, &ctx.Request, nil,
+		map[string][]byte{"small": []byte("small"), "large": bytes.Repeat([]byte("large"), 10)},
+	)
+	defer ctx.Request.Reset(0)
+
+	var form Form
+	if err := ctx.ValidateForm(&form); err != nil {
+		t.Fatal(err)
+	}
+	if form.Name != "sha" || form.Small.FileName != "small.txt" || len(form.Others) != 1 || form.Others[0].Size() != 50 {
+		t.Fatalf("unexpected form %v", form)
+	}
+
+	type BadForm struct {
+		Large *FormFile `vld:"large,filesize=-10"`
+	}
+	var badForm BadForm
+	if err := ctx.ValidateForm(&badForm); err == nil || err.StatusCode() != StatusBadRequest {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
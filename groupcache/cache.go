@@ -8,6 +8,7 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/zzztttkkk/sha/internal"
 	"github.com/zzztttkkk/sha/jsonx"
+	"github.com/zzztttkkk/sha/trace"
 	"github.com/zzztttkkk/sha/utils"
 	"math/rand"
 	"reflect"
@@ -126,7 +127,9 @@ func (g *Group) do(ctx context.Context, loaderName string, dist interface{}, arg
 			key := g.MakeKey(loaderName, args)
 			_bytes, found := g.storage.Get(ctx, key)
 
+			trace.SpanFromContext(ctx).SetAttributes("groupcache.hit", found)
 			if found {
+				metricHits.With(g.name, loaderName).Inc()
 				if len(_bytes) == 0 { // empty cache
 					return nil, ErrNotFound
 				}
@@ -139,9 +142,18 @@ func (g *Group) do(ctx context.Context, loaderName string, dist interface{}, arg
 				return dist, nil
 			}
 
-			_val, e := loader(ctx, args)
+			metricMisses.With(g.name, loaderName).Inc()
+			begin := time.Now()
+			loadCtx, span := trace.Start(ctx, "groupcache.load "+loaderName, trace.SpanKindInternal)
+			_val, e := loader(loadCtx, args)
+			if e != nil && e != sql.ErrNoRows && e != ErrNotFound {
+				span.SetError(e)
+			}
+			span.End()
+			metricLoadDuration.With(g.name, loaderName).Observe(time.Since(begin).Seconds())
 			if e != nil {
 				if e != sql.ErrNoRows && e != ErrNotFound {
+					metricLoadErrors.With(g.name, loaderName).Inc()
 					return nil, e
 				}
 				_val = nil
@@ -164,8 +176,17 @@ func (g *Group) do(ctx context.Context, loaderName string, dist interface{}, arg
 	return e
 }
 
-func (g *Group) Do(ctx context.Context, loader string, dist interface{}, args NamedArgs) error {
-	var err error
+// Do loads the value to dist, the span `groupcache <group>.<loader>` is recorded if ctx is traced, see `trace.Start`.
+func (g *Group) Do(ctx context.Context, loader string, dist interface{}, args NamedArgs) (err error) {
+	ctx, span := trace.Start(ctx, "groupcache "+g.name+"."+loader, trace.SpanKindInternal)
+	span.SetAttributes("groupcache.group", g.name, "groupcache.loader", loader, "groupcache.key", args.Name())
+	defer func() {
+		if err != nil && err != ErrNotFound {
+			span.SetError(err)
+		}
+		span.End()
+	}()
+
 	var retry int
 	opts := &g.Opts
 	for {
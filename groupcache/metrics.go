@@ -0,0 +1,30 @@
+package groupcache
+
+import "github.com/zzztttkkk/sha/metrics"
+
+var (
+	metricHits = metrics.NewCounterVec(
+		"sha_groupcache_hits_total", "The count of the values found in the storage.",
+		"group", "loader",
+	)
+	metricMisses = metrics.NewCounterVec(
+		"sha_groupcache_misses_total", "The count of the values not found in the storage.",
+		"group", "loader",
+	)
+	metricLoadErrors = metrics.NewCounterVec(
+		"sha_groupcache_load_errors_total", "The count of the loader errors, excluding the not found ones.",
+		"group", "loader",
+	)
+	metricLoadDuration = metrics.NewHistogramVec(
+		"sha_groupcache_load_duration_seconds", "The latency of the loaders.",
+		nil, "group", "loader",
+	)
+)
+
+// RegisterMetrics registers the collectors of all the groups to reg, nil means `metrics.Default`.
+func RegisterMetrics(reg *metrics.Registry) {
+	if reg == nil {
+		reg = metrics.Default
+	}
+	reg.MustRegister(metricHits, metricMisses, metricLoadErrors, metricLoadDuration)
+}
@@ -7,3 +7,28 @@ type RequestCtxHandler interface {
 type RequestCtxHandlerFunc func(ctx *RequestCtx)
 
 func (fn RequestCtxHandlerFunc) Handle(ctx *RequestCtx) { fn(ctx) }
+
+type _WrappedHandler struct {
+	RequestCtxHandler
+	raw RequestCtxHandler
+}
+
+// WrapHandler applies the middlewares to all requests of the handler, including the requests which are not matched by
+// `Mux`, such as `server.Handler = WrapHandler(mux, accessLogger)`.
+func WrapHandler(h RequestCtxHandler, middlewares ...Middleware) RequestCtxHandler {
+	return &_WrappedHandler{RequestCtxHandler: middlewaresWrap(middlewares, h), raw: h}
+}
+
+func (wh *_WrappedHandler) routeOptions(ctx *RequestCtx) *RouteOptions {
+	return routeOptionsOf(wh.raw, ctx)
+}
+
+func unwrapHandler(h RequestCtxHandler) RequestCtxHandler {
+	for {
+		wh, ok := h.(*_WrappedHandler)
+		if !ok {
+			return h
+		}
+		h = wh.raw
+	}
+}
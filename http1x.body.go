@@ -0,0 +1,286 @@
+package sha
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/zzztttkkk/sha/internal"
+	"github.com/zzztttkkk/sha/utils"
+)
+
+const (
+	expectContinue   = "100-continue"
+	continueResponse = "HTTP/1.1 100 Continue\r\n\r\n"
+)
+
+var (
+	ErrBodyStreamRequireHTTP11 = errors.New("sha: body stream is only supported by http1.x")
+	ErrBodyTooLarge            = errors.New("sha.http: body too large")
+)
+
+func init() { internal.ErrorStatusByValue[ErrBodyTooLarge] = StatusRequestEntityTooLarge }
+
+// _BodyStream reads the request body from the connection on demand, instead of buffering the whole body before handling.
+type _BodyStream struct {
+	enabled         bool
+	r               *bufio.Reader
+	w               *bufio.Writer
+	conn            net.Conn
+	opt             *HTTPOptions
+	trailer         *Header
+	readTimeout     time.Duration
+	maxSize         int
+	maxDuration     time.Duration
+	minRate         int
+	start           time.Time
+	received        int64
+	strict          bool
+	chunked         bool
+	remain          int
+	chunkEnd        bool // the CRLF after the chunk data is not read
+	extSize         int
+	eof             bool
+	waitForContinue bool
+}
+
+func (req *Request) isHTTP11() bool {
+	version := req.HTTPVersion()
+	return len(version) == 8 && version[5] >= '1' && version[7] >= '1'
+}
+
+func (req *Request) expectContinue() bool {
+	v, _ := req.Header().Get(HeaderExpect)
+	return strings.EqualFold(utils.S(v), expectContinue) && req.isHTTP11()
+}
+
+func writeContinue(w *bufio.Writer) error {
+	if _, err := w.WriteString(continueResponse); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func (bs *_BodyStream) init(ctx *RequestCtx, readTimeout time.Duration, opt *HTTPOptions) {
+	req := &ctx.Request
+	bs.enabled = true
+	bs.r = ctx.r
+	bs.w = ctx.w
+	bs.conn = ctx.conn
+	bs.opt = opt
+	bs.trailer = &req.trailer
+	bs.readTimeout = readTimeout
+	bs.maxSize = opt.MaxBodySize
+	bs.maxDuration = opt.MaxBodyReadDuration.Duration
+	bs.minRate = opt.MinTransferRate
+	bs.start = time.Time{}
+	bs.received = 0
+	bs.strict = !opt.LaxParsing
+	bs.chunkEnd = false
+	bs.extSize = 0
+	bs.chunked, bs.remain = req.bodyFraming()
+	if !bs.chunked && bs.remain < 1 {
+		bs.eof = true
+		return
+	}
+	bs.waitForContinue = req.expectContinue()
+}
+
+func (bs *_BodyStream) reset() {
+	bs.enabled = false
+	bs.r = nil
+	bs.w = nil
+	bs.conn = nil
+	bs.opt = nil
+	bs.trailer = nil
+	bs.chunked = false
+	bs.remain = 0
+	bs.eof = false
+	bs.waitForContinue = false
+}
+
+func (bs *_BodyStream) sendContinue() error {
+	bs.waitForContinue = false
+	return writeContinue(bs.w)
+}
+
+func (bs *_BodyStream) readChunkSize() error {
+	if bs.chunkEnd {
+		line, err := readChunkLine(bs.r, bs.strict)
+		if err != nil {
+			return err
+		}
+		if len(line) != 0 {
+			return ErrBadChunk
+		}
+		bs.chunkEnd = false
+	}
+	line, err := readChunkLine(bs.r, bs.strict)
+	if err != nil {
+		return err
+	}
+	size, ext, err := parseChunkSize(line, bs.strict)
+	if err != nil {
+		return err
+	}
+	if bs.extSize += ext; bs.strict && bs.extSize > maxChunkExtSize {
+		return ErrBadChunk
+	}
+	bs.remain = size
+	return nil
+}
+
+func (bs *_BodyStream) Read(p []byte) (int, error) {
+	if bs.eof {
+		return 0, io.EOF
+	}
+	if !bs.enabled {
+		return 0, ErrBodyStreamRequireHTTP11
+	}
+	if bs.waitForContinue {
+		if err := bs.sendContinue(); err != nil {
+			return 0, err
+		}
+	}
+	now := time.Now()
+	if bs.start.IsZero() { // the handler may not read the body immediately
+		bs.start = now
+	}
+	var deadline time.Time
+	var cause error
+	if bs.readTimeout > 0 {
+		deadline = now.Add(bs.readTimeout)
+	}
+	if bs.maxDuration > 0 {
+		if v := bs.start.Add(bs.maxDuration); deadline.IsZero() || v.Before(deadline) {
+			deadline, cause = v, ErrBodyReadTimeout
+		}
+	}
+	if bs.minRate > 0 {
+		if v := transferRateDeadline(bs.start, bs.received, bs.minRate); deadline.IsZero() || v.Before(deadline) {
+			deadline, cause = v, ErrTransferRateTooLow
+		}
+	}
+	if !deadline.IsZero() {
+		_ = bs.conn.SetReadDeadline(deadline)
+	}
+	n, err := bs.readLimited(p)
+	bs.received += int64(n)
+	if err != nil && cause != nil && isTimeoutError(err) {
+		err = cause
+	}
+	return n, err
+}
+
+// readLimited returns `ErrBodyTooLarge` if the body is larger than `HTTPOptions.MaxBodySize`.
+func (bs *_BodyStream) readLimited(p []byte) (int, error) {
+	if bs.maxSize < 1 {
+		return bs.read(p)
+	}
+	left := int64(bs.maxSize) - bs.received
+	if left < 1 { // only the end of the body is allowed, such as the last chunk
+		if _, err := bs.read(p[:0]); err != nil {
+			return 0, err
+		}
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	return bs.read(p)
+}
+
+func (bs *_BodyStream) read(p []byte) (int, error) {
+	if bs.chunked && bs.remain < 1 {
+		if err := bs.readChunkSize(); err != nil {
+			return 0, err
+		}
+		if bs.remain == 0 { // last chunk
+			if err := parseTrailer(bs.r, bs.trailer, bs.opt); err != nil {
+				return 0, err
+			}
+			bs.eof = true
+			return 0, io.EOF
+		}
+	}
+
+	if len(p) > bs.remain {
+		p = p[:bs.remain]
+	}
+	n, err := bs.r.Read(p)
+	bs.remain -= n
+	if bs.remain == 0 {
+		if bs.chunked {
+			bs.chunkEnd = true
+		} else {
+			bs.eof = true
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// maxBodyDrainSize is the max size of the unread body discarded for reusing the connection,
+// a larger body is not read, and the connection is closed after the response.
+const maxBodyDrainSize = 256 << 10
+
+// drain discards the unread body, so that the connection can be reused.
+func (bs *_BodyStream) drain() bool {
+	if bs.eof {
+		return true
+	}
+	if bs.waitForContinue { // the client is still waiting, do not let it send the body
+		return false
+	}
+	if !bs.chunked && bs.remain > maxBodyDrainSize {
+		return false
+	}
+
+	var limit int64 = maxBodyDrainSize + 1 // reads the eof of a body of exactly `maxBodyDrainSize` bytes
+	if bs.maxSize > 0 && int64(bs.maxSize) < limit {
+		limit = int64(bs.maxSize)
+	}
+	_, _ = io.CopyN(ioutil.Discard, bs, limit)
+	return bs.eof
+}
+
+// _RouteOptionsResolver matches the route of the request before reading the body, such as `Mux`.
+type _RouteOptionsResolver interface {
+	routeOptions(ctx *RequestCtx) *RouteOptions
+}
+
+func routeOptionsOf(h RequestCtxHandler, ctx *RequestCtx) *RouteOptions {
+	if r, ok := h.(_RouteOptionsResolver); ok {
+		return r.routeOptions(ctx)
+	}
+	return nil
+}
+
+// BodyStream returns a reader of the request body.
+// if the route is registered with `RouteOptions.StreamBody`, the body is read from the connection on demand.
+func (req *Request) BodyStream() io.Reader {
+	if req.bodyStream.enabled {
+		return &req.bodyStream
+	}
+	return bytes.NewReader(req.BodyRaw())
+}
+
+func (req *Request) IsBodyStreaming() bool { return req.bodyStream.enabled }
+
+// readBodyStream read the rest of the body stream into the pocket
+func (req *Request) readBodyStream() bool {
+	bs := &req.bodyStream
+	if bs.maxSize > 0 {
+		_, _ = io.CopyN(&req._HTTPPocket, bs, int64(bs.maxSize))
+	} else {
+		_, _ = io.Copy(&req._HTTPPocket, bs)
+	}
+	return bs.eof
+}
@@ -0,0 +1,266 @@
+package sha
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startBodyStreamTestServer(t *testing.T) (string, func()) {
+	mux := NewMux(&MuxOptions{AutoHandleDocs: false, AutoCompress: false})
+	streamOpt := &RouteOptions{StreamBody: true}
+
+	mux.HTTPWithOptions(streamOpt, MethodPost, "/md5", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		if !ctx.Request.IsBodyStreaming() {
+			ctx.Response.SetStatusCode(StatusBadRequest)
+			return
+		}
+		h := md5.New()
+		n, err := io.Copy(h, ctx.Request.BodyStream())
+		if err != nil {
+			ctx.SetError(err)
+			return
+		}
+		_ = ctx.WriteString(fmt.Sprintf("%d %x", n, h.Sum(nil)))
+	}))
+	mux.HTTPWithOptions(&RouteOptions{StreamBody: true, MaxBodySize: 10}, MethodPost, "/limited", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		data, err := ioutil.ReadAll(ctx.Request.BodyStream())
+		if err != nil {
+			ctx.SetError(err)
+			return
+		}
+		_, _ = ctx.Write(data)
+	}))
+	mux.HTTPWithOptions(streamOpt, MethodPost, "/ignore", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_ = ctx.WriteString("ignored")
+	}))
+	mux.HTTPWithOptions(streamOpt, MethodPost, "/form", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		name, _ := ctx.Request.BodyFormValue("name")
+		file := ctx.Request.Files().Get("file")
+		if file == nil {
+			ctx.Response.SetStatusCode(StatusBadRequest)
+			return
+		}
+		_ = ctx.WriteString(fmt.Sprintf("%s %s %d", name, file.FileName, len(file.Data())))
+	}))
+	mux.HTTP(MethodPost, "/buffered", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		data, _ := ioutil.ReadAll(ctx.Request.BodyStream())
+		_ = ctx.WriteString(fmt.Sprintf("%v %d", ctx.Request.IsBodyStreaming(), len(data)))
+	}))
+
+	return startHTTP2TestServer(t, mux)
+}
+
+func TestBodyStream(t *testing.T) {
+	addr, stop := startBodyStreamTestServer(t)
+	defer stop()
+
+	payload := bytes.Repeat([]byte("0123456789"), 100000)
+
+	t.Run("content-length", func(t *testing.T) {
+		res, err := http.Post(fmt.Sprintf("http://%s/md5", addr), MIMEText, bytes.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if string(body) != fmt.Sprintf("%d %x", len(payload), md5.Sum(payload)) {
+			t.Fatalf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("chunked", func(t *testing.T) {
+		// io.MultiReader hides the length, so the client uses chunked encoding
+		res, err := http.Post(fmt.Sprintf("http://%s/md5", addr), MIMEText, io.MultiReader(bytes.NewReader(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if string(body) != fmt.Sprintf("%d %x", len(payload), md5.Sum(payload)) {
+			t.Fatalf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		w := multipart.NewWriter(buf)
+		_ = w.WriteField("name", "sha")
+		fw, _ := w.CreateFormFile("file", "a.txt")
+		_, _ = fw.Write(payload)
+		_ = w.Close()
+
+		res, err := http.Post(fmt.Sprintf("http://%s/form", addr), w.FormDataContentType(), buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if string(body) != fmt.Sprintf("sha a.txt %d", len(payload)) {
+			t.Fatalf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("buffered", func(t *testing.T) {
+		res, err := http.Post(fmt.Sprintf("http://%s/buffered", addr), MIMEText, bytes.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if string(body) != fmt.Sprintf("false %d", len(payload)) {
+			t.Fatalf("unexpected body %q", body)
+		}
+	})
+}
+
+func TestBodyStream_ExpectContinue(t *testing.T) {
+	addr, stop := startBodyStreamTestServer(t)
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// the handler does not read the body, so no `100 Continue` and the connection will be closed.
+	_, _ = conn.Write([]byte("POST /ignore HTTP/1.1\r\nHost: sha.local\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = ioutil.ReadAll(res.Body)
+	if res.StatusCode != StatusOK || !res.Close {
+		t.Fatalf("unexpected response %d close=%v", res.StatusCode, res.Close)
+	}
+
+	conn2, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	r = bufio.NewReader(conn2)
+
+	_, _ = conn2.Write([]byte("POST /md5 HTTP/1.1\r\nHost: sha.local\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+	line, _ := r.ReadString('\n')
+	if !strings.HasPrefix(line, "HTTP/1.1 100 ") {
+		t.Fatalf("unexpected line %q", line)
+	}
+	_, _ = r.ReadString('\n')
+	_, _ = conn2.Write([]byte("hello"))
+	res, err = http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != fmt.Sprintf("5 %x", md5.Sum([]byte("hello"))) {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	// unread body is drained, the connection is reused.
+	_, _ = conn2.Write([]byte("POST /ignore HTTP/1.1\r\nHost: sha.local\r\nContent-Length: 5\r\n\r\nhelloPOST /md5 HTTP/1.1\r\nHost: sha.local\r\nContent-Length: 2\r\n\r\nok"))
+	for _, expected := range []string{"ignored", fmt.Sprintf("2 %x", md5.Sum([]byte("ok")))} {
+		res, err = http.ReadResponse(r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ = ioutil.ReadAll(res.Body)
+		if string(body) != expected {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+}
+
+func TestBodyStream_DrainLimit(t *testing.T) {
+	addr, stop := startBodyStreamTestServer(t)
+	defer stop()
+
+	chunk := strings.Repeat("a", 64<<10)
+	for _, header := range []string{
+		fmt.Sprintf("Content-Length: %d\r\n\r\n", 1<<20),
+		"Transfer-Encoding: chunked\r\n\r\n",
+	} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunked := strings.HasPrefix(header, "Transfer-Encoding")
+		_, _ = conn.Write([]byte("POST /ignore HTTP/1.1\r\nHost: sha.local\r\n" + header))
+		go func() {
+			for i := 0; i < 16; i++ {
+				data := chunk
+				if chunked {
+					data = fmt.Sprintf("%x\r\n%s\r\n", len(chunk), chunk)
+				}
+				if _, err := conn.Write([]byte(data)); err != nil {
+					return
+				}
+			}
+			if chunked {
+				_, _ = conn.Write([]byte("0\r\n\r\n"))
+			}
+		}()
+
+		// the oversized unread body is not drained, the connection is closed after the response.
+		r := bufio.NewReader(conn)
+		res, err := http.ReadResponse(r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = ioutil.ReadAll(res.Body)
+		if res.StatusCode != StatusOK || !res.Close {
+			t.Fatalf("%q: unexpected response %d close=%v", header, res.StatusCode, res.Close)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err = r.ReadByte(); err == nil {
+			t.Fatalf("%q: the connection is not closed", header)
+		} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatalf("%q: the connection is not closed: %v", header, err)
+		}
+		_ = conn.Close()
+	}
+}
+
+func TestBodyStream_MaxBodySize(t *testing.T) {
+	addr, stop := startBodyStreamTestServer(t)
+	defer stop()
+
+	for _, c := range []struct {
+		request string
+		status  int
+		body    string
+	}{
+		{"Content-Length: 10\r\n\r\n0123456789", StatusOK, "0123456789"},
+		{"Content-Length: 11\r\n\r\n0123456789a", StatusRequestEntityTooLarge, ""},
+		{"Content-Length: 11\r\nExpect: 100-continue\r\n\r\n", StatusRequestEntityTooLarge, ""},
+		{"Transfer-Encoding: chunked\r\n\r\n5\r\n01234\r\n5\r\n56789\r\n0\r\n\r\n", StatusOK, "0123456789"},
+		{"Transfer-Encoding: chunked\r\n\r\n5\r\n01234\r\n6\r\n56789a\r\n0\r\n\r\n", StatusRequestEntityTooLarge, ""},
+		{"Transfer-Encoding: chunked\r\n\r\na\r\n0123456789\r\n1\r\na\r\n0\r\n\r\n", StatusRequestEntityTooLarge, ""},
+	} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = conn.Write([]byte("POST /limited HTTP/1.1\r\nHost: sha.local\r\n" + c.request))
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		_ = conn.Close()
+		if res.StatusCode != c.status || (c.status == StatusOK && string(body) != c.body) {
+			t.Fatalf("%q: unexpected response %d %q", c.request, res.StatusCode, body)
+		}
+	}
+}
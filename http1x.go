@@ -1,29 +1,51 @@
 package sha
 
 import (
+	"bufio"
 	"context"
 	"net"
+	"strings"
 	"time"
 
+	"github.com/zzztttkkk/sha/internal"
 	"github.com/zzztttkkk/sha/utils"
 )
 
 type HTTPOptions struct {
 	MaxFirstLineSize  int `json:"max_first_line_size" toml:"max-first-line-size"`
 	MaxHeaderPartSize int `json:"max_header_part_size" toml:"max-header-part-size"`
+	MaxHeaderCount    int `json:"max_header_count" toml:"max-header-count"`
 	MaxBodySize       int `json:"max_body_size" toml:"max-body-size"`
 
+	// the first line and the headers must be read in this duration
+	MaxHeaderReadDuration utils.TomlDuration `json:"max_header_read_duration" toml:"max-header-read-duration"`
+	// the body must be read in this duration, the streaming body is checked on each read
+	MaxBodyReadDuration utils.TomlDuration `json:"max_body_read_duration" toml:"max-body-read-duration"`
+	// bytes per second, averaged since the start of reading the pocket and checked after the first second.
+	// zero means no limit.
+	MinTransferRate int `json:"min_transfer_rate" toml:"min-transfer-rate"`
+
 	ReadBufferSize      int `json:"read_buffer_size" toml:"read-buffer-size"`
 	SendBufferSize      int `json:"send_buffer_size" toml:"send-buffer-size"`
 	BufferPoolSizeLimit int `json:"buffer_pool_size_limit" toml:"buffer-pool-size-limit"`
+
+	// accept the malformed pockets as the older versions did, such as obs-fold, bare LF and ambiguous framing.
+	// by default, the pockets are parsed strictly as RFC 9112 and the malformed ones are rejected with 400, so the
+	// proxies in front of the server can not desync the connection.
+	LaxParsing bool `json:"lax_parsing" toml:"lax-parsing"`
+
+	Multipart MultipartOptions `json:"multipart" toml:"multipart"`
 }
 
 var defaultHTTPOption = HTTPOptions{
-	MaxFirstLineSize:    4096,
-	MaxHeaderPartSize:   1024 * 16,
-	MaxBodySize:         1024 * 1024 * 10,
-	ReadBufferSize:      2048,
-	BufferPoolSizeLimit: 4096,
+	MaxFirstLineSize:      4096,
+	MaxHeaderPartSize:     1024 * 16,
+	MaxHeaderCount:        128,
+	MaxBodySize:           1024 * 1024 * 10,
+	MaxHeaderReadDuration: utils.TomlDuration{Duration: time.Second * 10},
+	ReadBufferSize:        2048,
+	BufferPoolSizeLimit:   4096,
+	Multipart:             defaultMultipartOption,
 }
 
 type _Http11Protocol struct {
@@ -36,6 +58,7 @@ type _Http11Protocol struct {
 	WriteBufferSize int
 
 	pool *RequestCtxPool
+	h2c  *_Http2Protocol
 }
 
 func newHTTP11Protocol(pool *RequestCtxPool) HTTPServerProtocol {
@@ -57,7 +80,7 @@ const (
 )
 
 func (protocol *_Http11Protocol) keepalive(ctx *RequestCtx, s *Server) bool {
-	if !s.runningFlag {
+	if !s.isRunning() {
 		return false
 	}
 	timeout := s.Options.MaxConnectionKeepAlive.Duration
@@ -75,26 +98,180 @@ func (protocol *_Http11Protocol) keepalive(ctx *RequestCtx, s *Server) bool {
 		return false
 	}
 
-	v := ctx.Request.HTTPVersion()
-	return v[5] >= '1' && v[7] >= '1'
+	return ctx.Request.isHTTP11()
+}
+
+// checkExpectation returns a non-zero status code if the request should be rejected before reading the body.
+func (protocol *_Http11Protocol) checkExpectation(ctx *RequestCtx, server *Server, opt *HTTPOptions) int {
+	req := &ctx.Request
+	v, ok := req.header.Get(HeaderExpect)
+	if !ok || !req.isHTTP11() { // http1.0 clients do not wait for `100 Continue`
+		return 0
+	}
+	if !strings.EqualFold(utils.S(v), expectContinue) {
+		return StatusExpectationFailed
+	}
+	if opt.MaxBodySize > 0 {
+		if _, contentLength := req.bodyFraming(); contentLength > opt.MaxBodySize {
+			return StatusRequestEntityTooLarge
+		}
+	}
+	if server.OnExpectContinue != nil {
+		if sc := server.OnExpectContinue(ctx); sc != 0 && sc != StatusContinue {
+			return sc
+		}
+	}
+	return 0
+}
+
+// parseErrorStatus returns the status code of the response to the malformed request, zero means closing the
+// connection silently, such as io errors.
+func parseErrorStatus(err error) int {
+	if he, ok := err.(HTTPError); ok {
+		return he.StatusCode()
+	}
+	return internal.ErrorStatusByValue[err]
+}
+
+// writeTimeout returns `RouteOptions.WriteTimeout` of the matched route, or `ServerOptions.WriteTimeout`.
+func writeTimeout(ctx *RequestCtx) time.Duration {
+	if ctx.route != nil && ctx.route.WriteTimeout > 0 {
+		return ctx.route.WriteTimeout
+	}
+	if s, ok := ctx.Value(CtxKeyServer).(*Server); ok {
+		return s.Options.WriteTimeout.Duration
+	}
+	return 0
+}
+
+// bodyOptions returns the options for reading the body of the matched route.
+func (protocol *_Http11Protocol) bodyOptions(route *RouteOptions) *HTTPOptions {
+	if route == nil || route.MaxBodySize == 0 {
+		return protocol.HTTPOptions
+	}
+	opt := *protocol.HTTPOptions
+	opt.MaxBodySize = route.MaxBodySize
+	if opt.MaxBodySize < 0 {
+		opt.MaxBodySize = 0
+	}
+	return &opt
 }
 
-func (protocol *_Http11Protocol) handle(ctx *RequestCtx, server *Server) bool {
+// sendResponse write the response; the buffered data will not be flushed if the next pipelined request is already
+// in the read buffer, it will be flushed before reading from the connection.
+func (protocol *_Http11Protocol) sendResponse(ctx *RequestCtx, server *Server, keepalive bool) bool {
+	if !keepalive { // let the pipelining client know that the rest requests will not be processed
+		ctx.Response.Header().SetString(HeaderConnection, headerValClose)
+	}
+
+	writeTimeout := writeTimeout(ctx)
+	if writeTimeout > 0 {
+		_ = ctx.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	}
+	// the trailer of the buffered response is sent by the chunked encoding
+	var err error
+	res := &ctx.Response
+	if res.trailer.Size() > 0 && ctx.Request.isHTTP11() && ctx.Request._method != _MHead &&
+		res.statusCode != StatusNoContent && res.statusCode != StatusNotModified {
+		err = writeChunkedResponse(ctx.w, res)
+	} else {
+		err = writeResponse(ctx.w, res)
+	}
+	if err == nil && (!keepalive || ctx.r.Buffered() < 1) {
+		err = ctx.w.Flush()
+	}
+	if err != nil {
+		if protocol.OnWriteError != nil {
+			protocol.OnWriteError(ctx.conn, ctx, err)
+		}
+		return false
+	}
+	if writeTimeout > 0 {
+		_ = ctx.conn.SetWriteDeadline(time.Time{})
+	}
+	return keepalive
+}
+
+func (protocol *_Http11Protocol) handle(ctx *RequestCtx, server *Server, guard *_ReadGuard) bool {
 	defer func() {
+		ctx.watcher.stop()
 		ctx.cancelFunc()
 		ctx.prepareForNextRequest(protocol.BufferPoolSizeLimit)
 	}()
 
 	readTimeout := server.Options.ReadTimeout.Duration
+	var deadline time.Time
 	if readTimeout > 0 {
-		_ = ctx.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		deadline = time.Now().Add(readTimeout)
+		_ = ctx.conn.SetReadDeadline(deadline)
 	}
+	guard.beginHeader(deadline)
+	defer guard.end()
 
-	err := parseRequest(ctx, ctx.r, ctx.readBuf, &ctx.Request, protocol.HTTPOptions)
+	req := &ctx.Request
+	err := parseRequestHeader(ctx, ctx.r, req, protocol.HTTPOptions)
+	// the upgraded request is served as the stream 1 of the http2 connection, which takes its own in-flight slot,
+	// so the connection does not hold one for its whole life.
+	h2cUpgrade := err == nil && protocol.h2c != nil && !ctx.IsTLS() && isH2CUpgrade(req)
+	if err == nil && !h2cUpgrade {
+		if !server.acquireRequest() {
+			if server.Options.Limits.CloseOnOverload {
+				return false
+			}
+			server.setOverloadResponse(ctx)
+			return protocol.sendResponse(ctx, server, false)
+		}
+		defer server.releaseRequest()
+	}
+	if err == nil {
+		ctx.route = routeOptionsOf(server.Handler, ctx)
+	}
+	if err == nil && req.hasBody() {
+		route := ctx.route
+		opt := protocol.bodyOptions(route)
+		streaming := route != nil && route.StreamBody
+		if route != nil && route.ReadTimeout > 0 {
+			readTimeout = route.ReadTimeout
+			guard.setBase(time.Now().Add(readTimeout))
+		}
+		if sc := protocol.checkExpectation(ctx, server, opt); sc != 0 {
+			ctx.Response.SetStatusCode(sc)
+			return protocol.sendResponse(ctx, server, false)
+		}
+
+		if streaming {
+			if _, contentLength := req.bodyFraming(); opt.MaxBodySize > 0 && contentLength > opt.MaxBodySize {
+				ctx.Response.SetStatusCode(StatusRequestEntityTooLarge)
+				return protocol.sendResponse(ctx, server, false)
+			}
+			guard.end()
+			req.bodyStream.init(ctx, readTimeout, opt)
+		} else {
+			if req.expectContinue() {
+				err = writeContinue(ctx.w)
+			}
+			if err == nil {
+				guard.beginBody()
+				err = parsePocketBody(ctx, ctx.r, ctx.readBuf, &req._HTTPPocket, opt)
+			}
+		}
+	}
+	guard.end()
 	if err != nil {
+		if parseErrorStatus(err) != 0 {
+			server.parseError()
+		}
 		if protocol.OnParseError != nil {
 			return protocol.OnParseError(ctx.conn, err)
 		}
+		if server.OnParseError != nil {
+			server.OnParseError(ctx.conn, err)
+		}
+		if sc := parseErrorStatus(err); sc != 0 {
+			ctx.Response.ResetBody()
+			ctx.Response.SetStatusCode(sc)
+			protocol.sendResponse(ctx, server, false)
+		}
 		return false
 	}
 
@@ -102,56 +279,97 @@ func (protocol *_Http11Protocol) handle(ctx *RequestCtx, server *Server) bool {
 		return false
 	}
 
+	if h2cUpgrade {
+		ctx.Request.hijack()
+		protocol.h2c.serveUpgrade(ctx)
+		return false
+	}
+
+	// the connection is watched for disconnection, unless the next pipelined request is pending, or the connection
+	// will be read by the handler
+	if !req.bodyStream.enabled && ctx.r.Buffered() < 1 && len(ctx.UpgradeProtocol()) < 1 {
+		ctx.watcher.start(ctx.conn, ctx.cancelFunc)
+	}
 	server.Handler.Handle(ctx)
-	req := &ctx.Request
 	if req.flags.Has(_ReqFlagHijacked) { // another protocol process has been completed
 		return false
 	}
+	if err := ctx.sw.finish(); err != nil {
+		return false
+	}
 	shouldKeepAlive := protocol.keepalive(ctx, server)
+	if req.bodyStream.enabled && !req.bodyStream.drain() { // the rest of the body can not be skipped
+		shouldKeepAlive = false
+	}
+	if ctx.sw.started { // the response is sent by the stream
+		return shouldKeepAlive
+	}
+	return protocol.sendResponse(ctx, server, shouldKeepAlive)
+}
 
-	writeTimeout := server.Options.WriteTimeout.Duration
-	if writeTimeout > 0 {
-		_ = ctx.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+// _PipelineReader flushes the pending responses before blocking on the connection.
+type _PipelineReader struct {
+	net.Conn
+	w            *bufio.Writer
+	writeTimeout time.Duration
+	watcher      _ConnWatcher
+}
+
+func (r *_PipelineReader) Read(p []byte) (int, error) {
+	if len(r.watcher.pending) > 0 {
+		return r.watcher.read(p), nil
 	}
-	if err := sendResponse(ctx.w, &ctx.Response); err != nil {
-		if protocol.OnWriteError != nil {
-			protocol.OnWriteError(ctx.conn, ctx, err)
+	if r.w.Buffered() > 0 {
+		if r.writeTimeout > 0 {
+			_ = r.Conn.SetWriteDeadline(time.Now().Add(r.writeTimeout))
+		}
+		if err := r.w.Flush(); err != nil {
+			return 0, err
 		}
-		return false
-	}
-	if writeTimeout > 0 {
-		_ = ctx.conn.SetWriteDeadline(time.Time{})
 	}
-	return shouldKeepAlive
+	return r.Conn.Read(p)
 }
 
 func (protocol *_Http11Protocol) ServeConn(ctx context.Context, conn net.Conn) {
-	var shouldKeepAlive = true
 	server := ctx.Value(CtxKeyServer).(*Server)
+	tracker := connTrackerFrom(ctx)
 
 	rctx := protocol.pool.Acquire()
-	if server.isTLS {
+	if isTLSConn(conn) {
 		rctx.Request.flags.Add(_ReqFlagIsTLS)
 	}
 	defer protocol.pool.release(rctx, false)
 
 	rctx.setConnection(conn)
+	guard := &_ReadGuard{Conn: conn, opt: protocol.HTTPOptions}
+	pr := &_PipelineReader{Conn: guard, w: rctx.w, writeTimeout: server.Options.WriteTimeout.Duration}
+	rctx.r.Reset(pr)
+	rctx.watcher = &pr.watcher
+	readTimeout := server.Options.ReadTimeout.Duration
 	idleTimeout := server.Options.IdleTimeout.Duration
 
-	for shouldKeepAlive {
-		rctx.ctx, rctx.cancelFunc = context.WithCancel(ctx)
-		shouldKeepAlive = protocol.handle(rctx, server)
-		if !shouldKeepAlive {
+	for first := true; ; first = false {
+		// the connection is idle until the next request arrives, it will be closed by `Server.Shutdown`
+		if !tracker.setIdle(true) {
 			return
 		}
-
-		if idleTimeout > 0 {
-			_ = conn.SetReadDeadline(time.Now().Add(idleTimeout))
-			if _, err := rctx.r.Peek(4); err != nil {
-				return
-			}
+		timeout := idleTimeout
+		if first || timeout <= 0 {
+			timeout = readTimeout
+		}
+		if timeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(timeout))
 		}
+		if _, err := rctx.r.Peek(1); err != nil {
+			return
+		}
+		tracker.setIdle(false)
 		_ = conn.SetReadDeadline(time.Time{})
 		_ = conn.SetWriteDeadline(time.Time{})
+
+		rctx.ctx, rctx.cancelFunc = context.WithCancel(ctx)
+		if !protocol.handle(rctx, server, guard) {
+			return
+		}
 	}
 }
@@ -0,0 +1,110 @@
+package sha
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/zzztttkkk/sha/internal"
+)
+
+var (
+	ErrHeaderReadTimeout  = errors.New("sha.http: header read timeout")
+	ErrBodyReadTimeout    = errors.New("sha.http: body read timeout")
+	ErrTransferRateTooLow = errors.New("sha.http: transfer rate too low")
+	ErrTooManyHeaders     = errors.New("sha.http: too many headers")
+)
+
+func init() {
+	internal.ErrorStatusByValue[ErrHeaderReadTimeout] = StatusRequestTimeout
+	internal.ErrorStatusByValue[ErrBodyReadTimeout] = StatusRequestTimeout
+	internal.ErrorStatusByValue[ErrTransferRateTooLow] = StatusRequestTimeout
+	internal.ErrorStatusByValue[ErrTooManyHeaders] = StatusRequestHeaderFieldsTooLarge
+}
+
+// the transfer rate is checked after this duration, so the slow start of the connection is allowed
+const minTransferRateGrace = time.Second
+
+// transferRateDeadline returns the time when the next byte must be received.
+func transferRateDeadline(start time.Time, received int64, minRate int) time.Time {
+	return start.Add(minTransferRateGrace + time.Duration((received+1)*int64(time.Second)/int64(minRate)))
+}
+
+func isTimeoutError(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// _ReadGuard limits the duration and the transfer rate of reading the header and the body, against the slowloris
+// attack. it sets the read deadline before each read, and translates the timeout to a distinct error.
+type _ReadGuard struct {
+	net.Conn
+	opt *HTTPOptions
+
+	active   bool
+	start    time.Time
+	received int64
+	base     time.Time
+	limit    time.Time
+	limitErr error
+}
+
+// beginHeader starts guarding, base is the deadline of the whole request, such as `ServerOptions.ReadTimeout`.
+func (g *_ReadGuard) beginHeader(base time.Time) {
+	g.active = true
+	g.start = time.Now()
+	g.received = 0
+	g.base = base
+	g.limit = time.Time{}
+	if d := g.opt.MaxHeaderReadDuration.Duration; d > 0 {
+		g.limit = g.start.Add(d)
+	}
+	g.limitErr = ErrHeaderReadTimeout
+}
+
+// setBase replaces the deadline of the whole request, such as `RouteOptions.ReadTimeout` of the matched route.
+func (g *_ReadGuard) setBase(base time.Time) {
+	g.base = base
+	_ = g.Conn.SetReadDeadline(base)
+}
+
+func (g *_ReadGuard) beginBody() {
+	g.limit = time.Time{}
+	if d := g.opt.MaxBodyReadDuration.Duration; d > 0 {
+		g.limit = time.Now().Add(d)
+	}
+	g.limitErr = ErrBodyReadTimeout
+}
+
+func (g *_ReadGuard) end() {
+	if !g.active {
+		return
+	}
+	g.active = false
+	_ = g.Conn.SetReadDeadline(g.base)
+}
+
+func (g *_ReadGuard) Read(p []byte) (int, error) {
+	if !g.active {
+		return g.Conn.Read(p)
+	}
+
+	deadline := g.base
+	var cause error
+	if !g.limit.IsZero() && (deadline.IsZero() || g.limit.Before(deadline)) {
+		deadline, cause = g.limit, g.limitErr
+	}
+	if g.opt.MinTransferRate > 0 {
+		if v := transferRateDeadline(g.start, g.received, g.opt.MinTransferRate); deadline.IsZero() || v.Before(deadline) {
+			deadline, cause = v, ErrTransferRateTooLow
+		}
+	}
+	_ = g.Conn.SetReadDeadline(deadline)
+
+	n, err := g.Conn.Read(p)
+	g.received += int64(n)
+	if err != nil && cause != nil && isTimeoutError(err) {
+		return n, cause
+	}
+	return n, err
+}
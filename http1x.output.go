@@ -9,7 +9,7 @@ import (
 	"strconv"
 )
 
-func sendPocket(buf *bufio.Writer, pocket *_HTTPPocket) error {
+func writePocket(buf *bufio.Writer, pocket *_HTTPPocket) {
 	const (
 		endLine     = "\r\n"
 		headerKVSep = ": "
@@ -34,13 +34,16 @@ func sendPocket(buf *bufio.Writer, pocket *_HTTPPocket) error {
 	if contentLength > 0 {
 		_, _ = buf.Write(pocket.body.Bytes())
 	}
+}
+
+func sendPocket(buf *bufio.Writer, pocket *_HTTPPocket) error {
+	writePocket(buf, pocket)
 	return buf.Flush()
 }
 
 func sendCompressedChunkedStream(buf *bufio.Writer, ctx *RequestCtx, stream io.Reader, cw _CompressionWriter) error {
 	const (
-		endLine   = "\r\n"
-		lastChunk = "0\r\n\r\n"
+		endLine = "\r\n"
 	)
 	res := &ctx.Response
 	rBuf := ctx.readBuf
@@ -84,33 +87,26 @@ func sendCompressedChunkedStream(buf *bufio.Writer, ctx *RequestCtx, stream io.R
 		buf.Write(res.body.Bytes())
 		buf.WriteString(endLine)
 	}
-	buf.WriteString(lastChunk)
+	writeLastChunk(buf, &res.trailer)
 	return buf.Flush()
 }
 
-var ErrChunkedResponseRequireHTTP11OrHigher = errors.New("sha: chunked response require HTTP11 or higher")
-
-//sendChunkedStreamResponse
-//https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Transfer-Encoding
-func sendChunkedStreamResponse(buf *bufio.Writer, ctx *RequestCtx, stream io.Reader) error {
-	version := ctx.Request.HTTPVersion()
-	isGet11 := version[5] >= '1' && version[7] >= '1'
-	if !isGet11 {
-		return ErrChunkedResponseRequireHTTP11OrHigher
-	}
-
-	res := &ctx.Response
-	if err := sendResponseFirstLine(buf, res); err != nil {
-		return err
-	}
-
+// writeStreamHeader writes the status line and the headers of the response whose length is unknown, the response is
+// delimited by closing the connection if it is not chunked.
+func writeStreamHeader(buf *bufio.Writer, res *Response, isChunked bool) {
 	const (
 		chunked     = "chunked"
 		endLine     = "\r\n"
 		headerKVSep = ": "
-		lastChunk   = "0\r\n\r\n"
 	)
-	res.Header().SetString(HeaderTransferEncoding, chunked)
+	_ = sendResponseFirstLine(buf, res)
+	res.header.Del(HeaderContentLength)
+	if isChunked {
+		res.Header().SetString(HeaderTransferEncoding, chunked)
+		res.announceTrailer()
+	} else {
+		res.Header().SetString(HeaderConnection, headerValClose)
+	}
 	res.header.EachItem(
 		func(item *utils.KvItem) bool {
 			buf.Write(item.Key)
@@ -121,7 +117,23 @@ func sendChunkedStreamResponse(buf *bufio.Writer, ctx *RequestCtx, stream io.Rea
 		},
 	)
 	_, _ = buf.WriteString(endLine)
+}
+
+var ErrChunkedResponseRequireHTTP11OrHigher = errors.New("sha: chunked response require HTTP11 or higher")
 
+//sendChunkedStreamResponse
+//https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Transfer-Encoding
+func sendChunkedStreamResponse(buf *bufio.Writer, ctx *RequestCtx, stream io.Reader) error {
+	version := ctx.Request.HTTPVersion()
+	isGet11 := version[5] >= '1' && version[7] >= '1'
+	if !isGet11 {
+		return ErrChunkedResponseRequireHTTP11OrHigher
+	}
+
+	res := &ctx.Response
+	writeStreamHeader(buf, res, true)
+
+	const endLine = "\r\n"
 	if res.cw != nil {
 		return sendCompressedChunkedStream(buf, ctx, stream, res.cw)
 	}
@@ -143,7 +155,7 @@ func sendChunkedStreamResponse(buf *bufio.Writer, ctx *RequestCtx, stream io.Rea
 		buf.Write(rBuf[:l])
 		buf.WriteString(endLine)
 	}
-	buf.WriteString(lastChunk)
+	writeLastChunk(buf, &res.trailer)
 	return buf.Flush()
 }
 
@@ -194,7 +206,8 @@ func sendResponseFirstLine(w *bufio.Writer, res *Response) error {
 	return nil
 }
 
-func sendResponse(w *bufio.Writer, res *Response) error {
+// writeResponse writes the response to `w` without flushing
+func writeResponse(w *bufio.Writer, res *Response) error {
 	if err := sendResponseFirstLine(w, res); err != nil {
 		return err
 	}
@@ -203,7 +216,37 @@ func sendResponse(w *bufio.Writer, res *Response) error {
 			return err
 		}
 	}
-	return sendPocket(w, &res._HTTPPocket)
+	writePocket(w, &res._HTTPPocket)
+	return nil
+}
+
+// writeChunkedResponse writes the buffered response as a single chunk to `w` without flushing, so that the trailer
+// can be sent.
+func writeChunkedResponse(w *bufio.Writer, res *Response) error {
+	const (
+		endLine = "\r\n"
+	)
+	if res.cw != nil { // flush compress writer
+		if err := res.cw.Flush(); err != nil {
+			return err
+		}
+	}
+	writeStreamHeader(w, res, true)
+	if res.body != nil && res.body.Len() > 0 {
+		w.WriteString(strconv.FormatInt(int64(res.body.Len()), 16))
+		w.WriteString(endLine)
+		w.Write(res.body.Bytes())
+		w.WriteString(endLine)
+	}
+	writeLastChunk(w, &res.trailer)
+	return nil
+}
+
+func sendResponse(w *bufio.Writer, res *Response) error {
+	if err := writeResponse(w, res); err != nil {
+		return err
+	}
+	return w.Flush()
 }
 
 func sendRequest(w *bufio.Writer, req *Request) error {
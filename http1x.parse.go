@@ -26,76 +26,73 @@ func init() {
 	internal.ErrorStatusByValue[ErrBadHTTPPocketData] = StatusBadRequest
 }
 
-/* parsePocket read http pocket from `reader`, use fixed-size buffer `readBuf`
+/* parsePocketHeader read the first line and the header lines of http pocket from `reader`
 parseStatus:
 0  --  first line first part
 1  --  first line second part
 2  --  first line third part
 3  --  header lines
-4  --  read fixed size body, `content-length`
-5  --  read chunked body
 */
-func parsePocket(ctx context.Context, reader *bufio.Reader, readBuf []byte, pocket *_HTTPPocket, opt *HTTPOptions) error {
-	const (
-		chunked = "chunked"
-	)
-
+func parsePocketHeader(ctx context.Context, reader *bufio.Reader, pocket *_HTTPPocket, opt *HTTPOptions) error {
 	var (
 		skipNewLine bool
 		skipSpace   bool
 		headerItem  *utils.KvItem
 		keySep      bool
 		keyDone     bool
-		bodyRemain  = -1
 		parseStatus int
 
 		firstLineSize int
 		headerSize    int
+		headerCount   int
 		b             byte
 		e             error
+		strict        = !opt.LaxParsing
 	)
 	pocket.header.fromOutSide = true
 
 	for {
-		if parseStatus < 4 {
-			b, e = reader.ReadByte()
-			if e != nil {
-				return e
-			}
+		b, e = reader.ReadByte()
+		if e != nil {
+			return e
+		}
 
-			if skipNewLine {
-				if b != '\n' {
-					return ErrBadHTTPPocketData
-				}
-				skipNewLine = false
-				continue
-			}
-			if skipSpace {
-				if b != ' ' {
-					return ErrBadHTTPPocketData
-				}
-				skipSpace = false
-				continue
+		if skipNewLine {
+			if b != '\n' {
+				return ErrBadHTTPPocketData
 			}
+			skipNewLine = false
+			continue
 		}
-
 		switch parseStatus {
 		// req method or res version
 		case 0:
 			firstLineSize++
 			if b == ' ' {
+				if strict && len(pocket.fl1) < 1 {
+					return ErrBadHTTPPocketData
+				}
 				parseStatus++
 				goto checkCtxAndFirstLineSize
 			}
+			if strict && (isCTL(b) || b == ' ') {
+				return ErrBadHTTPPocketData
+			}
 			pocket.fl1 = append(pocket.fl1, toUpperTable[b])
 			goto checkCtxAndFirstLineSize
 		// req path or res status code
 		case 1:
 			firstLineSize++
 			if b == ' ' {
+				if strict && len(pocket.fl2) < 1 {
+					return ErrBadHTTPPocketData
+				}
 				parseStatus++
 				goto checkCtxAndFirstLineSize
 			}
+			if strict && isCTL(b) {
+				return ErrBadHTTPPocketData
+			}
 			pocket.fl2 = append(pocket.fl2, b)
 			goto checkCtxAndFirstLineSize
 		// req version or res status phrase
@@ -107,6 +104,12 @@ func parsePocket(ctx context.Context, reader *bufio.Reader, readBuf []byte, pock
 
 				goto checkCtxAndFirstLineSize
 			}
+			if strict && isCTL(b) && b != '\t' {
+				if b == '\n' {
+					return ErrBareLF
+				}
+				return ErrBadHTTPPocketData
+			}
 			pocket.fl3 = append(pocket.fl3, toUpperTable[b])
 			goto checkCtxAndFirstLineSize
 		// headers
@@ -116,7 +119,17 @@ func parsePocket(ctx context.Context, reader *bufio.Reader, readBuf []byte, pock
 				return StatusError(StatusRequestHeaderFieldsTooLarge)
 			}
 
+			if skipSpace { // optional whitespaces before the value
+				if isOWS(b) {
+					continue
+				}
+				skipSpace = false
+			}
+
 			if !keySep && b == ':' {
+				if strict && headerItem == nil {
+					return ErrBadHeaderName
+				}
 				keySep = true
 				skipSpace = true
 				keyDone = true
@@ -124,13 +137,17 @@ func parsePocket(ctx context.Context, reader *bufio.Reader, readBuf []byte, pock
 			}
 
 			if b == '\r' {
+				if headerItem != nil {
+					if strict && !keyDone {
+						return ErrBadHeaderName
+					}
+					headerItem.Val = trimOWS(headerItem.Val)
+				}
 				keySep = false
 				keyDone = false
 				skipNewLine = true
 
-				if headerItem == nil { // header done, get content-length
-					parseStatus++
-
+				if headerItem == nil { // header done
 					b, e := reader.ReadByte()
 					if e != nil {
 						return e
@@ -138,114 +155,173 @@ func parsePocket(ctx context.Context, reader *bufio.Reader, readBuf []byte, pock
 					if b != '\n' {
 						return ErrBadHTTPPocketData
 					}
-
-					rn, _ := pocket.header.Get(HeaderTransferEncoding)
-					// multi-values such as `chunked, gzip` is not supported. i think the `gzip` should be set to `Content-Encoding`
-					if string(rn) == chunked {
-						parseStatus++
-						goto checkCtx
-					}
-					contentLength := pocket.header.ContentLength()
-					if contentLength < 1 {
-						return nil
-					}
-					bodyRemain = contentLength
-					if opt.MaxBodySize > 0 && contentLength > opt.MaxBodySize {
-						return StatusError(StatusRequestEntityTooLarge)
-					}
-					goto checkCtx
+					return nil
 				}
 				headerItem = nil
 				goto checkCtx
 			}
 
+			if strict && b == '\n' {
+				return ErrBareLF
+			}
+
 			if headerItem == nil {
+				if strict && isOWS(b) { // a line starts with whitespaces is a folded value of the previous header
+					return ErrObsFold
+				}
+				headerCount++
+				if opt.MaxHeaderCount > 0 && headerCount > opt.MaxHeaderCount {
+					return ErrTooManyHeaders
+				}
 				headerItem = pocket.header.AppendBytes(nil, nil)
 			}
 
 			if keyDone {
+				if strict && isCTL(b) && b != '\t' {
+					return ErrBadHeaderValue
+				}
 				headerItem.Val = append(headerItem.Val, b)
 			} else {
+				if strict && !tokenTable[b] {
+					return ErrBadHeaderName
+				}
 				//header key encoding: latin-1
 				headerItem.Key = append(headerItem.Key, toLowerTable[b])
 			}
 			continue
+		}
+		continue
+
+	checkCtxAndFirstLineSize:
+		if opt.MaxFirstLineSize > 0 && firstLineSize > opt.MaxFirstLineSize {
+			return StatusError(StatusRequestURITooLong)
+		}
+
+	checkCtx:
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+}
+
+const chunked = "chunked"
+
+// bodyFraming returns whether the body is chunked and the value of `content-length`
+func (p *_HTTPPocket) bodyFraming() (bool, int) {
+	rn, _ := p.header.Get(HeaderTransferEncoding)
+	// multi-values such as `gzip, chunked` is not supported. i think the `gzip` should be set to `Content-Encoding`.
+	// the strict parsing has normalized the value or rejected the pocket, see `checkFraming`.
+	if string(rn) == chunked {
+		return true, -1
+	}
+	return false, p.header.ContentLength()
+}
+
+func (p *_HTTPPocket) hasBody() bool {
+	isChunked, contentLength := p.bodyFraming()
+	return isChunked || contentLength > 0
+}
+
+/* parsePocketBody read http pocket body from `reader`, use fixed-size buffer `readBuf`
+parseStatus:
+4  --  read fixed size body, `content-length`
+5  --  read chunked body
+*/
+func parsePocketBody(ctx context.Context, reader *bufio.Reader, readBuf []byte, pocket *_HTTPPocket, opt *HTTPOptions) error {
+	var (
+		bodyRemain  = -1
+		parseStatus = 4
+		bodySize    int
+		extSize     int
+		strict      = !opt.LaxParsing
+	)
+
+	isChunked, contentLength := pocket.bodyFraming()
+	if isChunked {
+		parseStatus++
+	} else {
+		if contentLength < 1 {
+			return nil
+		}
+		bodyRemain = contentLength
+		if opt.MaxBodySize > 0 && contentLength > opt.MaxBodySize {
+			return StatusError(StatusRequestEntityTooLarge)
+		}
+	}
+
+	for {
+		switch parseStatus {
 		// fixed size body
 		case 4:
-			for {
-				if len(readBuf) > bodyRemain {
-					readBuf = readBuf[:bodyRemain]
+			if len(readBuf) > bodyRemain {
+				readBuf = readBuf[:bodyRemain]
+			}
+			l, e := reader.Read(readBuf)
+			if e != nil {
+				return e
+			}
+			if l == 0 {
+				goto checkCtx
+			}
+
+			_, _ = pocket.Write(readBuf[:l])
+
+			bodyRemain -= l
+			if bodyRemain == 0 {
+				return nil
+			}
+			goto checkCtx
+		// chunked body
+		case 5:
+			if bodyRemain < 0 {
+				line, e := readChunkLine(reader, strict)
+				if e != nil {
+					return e
 				}
-				l, e := reader.Read(readBuf)
+				size, ext, e := parseChunkSize(line, strict)
 				if e != nil {
 					return e
 				}
-				if l == 0 {
-					goto checkCtx
+				if extSize += ext; strict && extSize > maxChunkExtSize {
+					return ErrBadChunk
 				}
-
-				_, _ = pocket.Write(readBuf[:l])
-
-				bodyRemain -= l
-				if bodyRemain == 0 {
-					return nil
+				if bodySize += size; opt.MaxBodySize > 0 && bodySize > opt.MaxBodySize {
+					return StatusError(StatusRequestEntityTooLarge)
+				}
+				bodyRemain = size
+				if bodyRemain == 0 { // last chunk
+					return parseTrailer(reader, &pocket.trailer, opt)
 				}
 				goto checkCtx
 			}
-		// chunked body
-		case 5:
-			for {
-				if bodyRemain < 0 {
-					var line []byte
-					line, _, e = reader.ReadLine()
-					if e != nil {
-						return e
-					}
-					if len(line) == 0 {
-						goto checkCtx
-					}
-					var l int64
-					l, e = strconv.ParseInt(utils.S(line), 16, 32)
-					if e != nil {
-						return e
-					}
-					bodyRemain = int(l)
-					if bodyRemain == 0 {
-						_, _, e = reader.ReadLine()
-						if e != nil {
-							return e
-						}
-						return nil
-					}
-					goto checkCtx
-				}
 
-				if len(readBuf) > bodyRemain {
-					readBuf = readBuf[:bodyRemain]
-				}
+			if len(readBuf) > bodyRemain {
+				readBuf = readBuf[:bodyRemain]
+			}
+
+			l, e := reader.Read(readBuf)
+			if e != nil {
+				return e
+			}
+			if l == 0 {
+				goto checkCtx
+			}
+			_, _ = pocket.Write(readBuf[:l])
 
-				l, e := reader.Read(readBuf)
+			bodyRemain -= l
+			if bodyRemain == 0 { // the chunk data must be followed by CRLF
+				line, e := readChunkLine(reader, strict)
 				if e != nil {
 					return e
 				}
-				if l == 0 {
-					goto checkCtx
-				}
-				_, _ = pocket.Write(readBuf[:l])
-
-				bodyRemain -= l
-				if bodyRemain == 0 {
-					bodyRemain = -1
-					goto checkCtx
+				if len(line) != 0 {
+					return ErrBadChunk
 				}
-				goto checkCtx
+				bodyRemain = -1
 			}
-		}
-		continue
-
-	checkCtxAndFirstLineSize:
-		if opt.MaxFirstLineSize > 0 && firstLineSize > opt.MaxFirstLineSize {
-			return StatusError(StatusRequestURITooLong)
+			goto checkCtx
 		}
 
 	checkCtx:
@@ -257,10 +333,24 @@ func parsePocket(ctx context.Context, reader *bufio.Reader, readBuf []byte, pock
 	}
 }
 
+func parsePocket(ctx context.Context, reader *bufio.Reader, readBuf []byte, pocket *_HTTPPocket, opt *HTTPOptions) error {
+	if err := parsePocketHeader(ctx, reader, pocket, opt); err != nil {
+		return err
+	}
+	return parsePocketBody(ctx, reader, readBuf, pocket, opt)
+}
+
 var httpVersionPrefix = []byte("HTTP/")
 
 func parseRequest(ctx context.Context, r *bufio.Reader, buf []byte, req *Request, opt *HTTPOptions) error {
-	if err := parsePocket(ctx, r, buf, &req._HTTPPocket, opt); err != nil {
+	if err := parseRequestHeader(ctx, r, req, opt); err != nil {
+		return err
+	}
+	return parsePocketBody(ctx, r, buf, &req._HTTPPocket, opt)
+}
+
+func parseRequestHeader(ctx context.Context, r *bufio.Reader, req *Request, opt *HTTPOptions) error {
+	if err := parsePocketHeader(ctx, r, &req._HTTPPocket, opt); err != nil {
 		return err
 	}
 	if len(req.Method()) < 1 {
@@ -269,6 +359,11 @@ func parseRequest(ctx context.Context, r *bufio.Reader, buf []byte, req *Request
 	if len(req.HTTPVersion()) != 8 || !bytes.HasPrefix(req.HTTPVersion(), httpVersionPrefix) {
 		return ErrBadHTTPPocketData
 	}
+	if !opt.LaxParsing {
+		if err := req.checkFraming(req.HTTPVersion()); err != nil {
+			return err
+		}
+	}
 	req.methodToEnum()
 	req.parsePath()
 	req.setTime()
@@ -276,7 +371,14 @@ func parseRequest(ctx context.Context, r *bufio.Reader, buf []byte, req *Request
 }
 
 func parseResponse(ctx context.Context, r *bufio.Reader, buf []byte, res *Response, opt *HTTPOptions) error {
-	if err := parsePocket(ctx, r, buf, &res._HTTPPocket, opt); err != nil {
+	if err := parseResponseHeader(ctx, r, res, opt); err != nil {
+		return err
+	}
+	return parsePocketBody(ctx, r, buf, &res._HTTPPocket, opt)
+}
+
+func parseResponseHeader(ctx context.Context, r *bufio.Reader, res *Response, opt *HTTPOptions) error {
+	if err := parsePocketHeader(ctx, r, &res._HTTPPocket, opt); err != nil {
 		return err
 	}
 	sv, err := strconv.ParseInt(utils.S(res.fl2), 10, 64)
@@ -291,6 +393,11 @@ func parseResponse(ctx context.Context, r *bufio.Reader, buf []byte, res *Respon
 	if len(res.Phrase()) < 1 {
 		return ErrBadHTTPPocketData
 	}
+	if !opt.LaxParsing {
+		if err := res.checkFraming(res.HTTPVersion()); err != nil {
+			return err
+		}
+	}
 	res.setTime()
 	return nil
 }
@@ -0,0 +1,92 @@
+//go:build go1.18
+// +build go1.18
+
+package sha
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// remaining returns the count of the unread bytes, the next pocket on the connection starts from here.
+func remaining(r *bufio.Reader, src *bytes.Reader) int { return r.Buffered() + src.Len() }
+
+// FuzzParseRequest checks that the parser never panics, and agrees with `net/http` on the body and the framing
+// when both of them accept the request, a disagreement means that a proxy can desync the connection.
+func FuzzParseRequest(f *testing.F) {
+	for _, c := range requestParseCases {
+		f.Add([]byte(c.raw))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var req Request
+		src := bytes.NewReader(data)
+		r := bufio.NewReader(src)
+		err := parseRequest(context.Background(), r, make([]byte, 512), &req, &defaultHTTPOption)
+		if err != nil {
+			return
+		}
+		if len(req.Header().GetAll(HeaderTransferEncoding))+len(req.Header().GetAll(HeaderContentLength)) > 1 {
+			t.Fatalf("ambiguous framing is accepted: %q", data)
+		}
+
+		stdSrc := bytes.NewReader(data)
+		stdR := bufio.NewReader(stdSrc)
+		stdReq, err := http.ReadRequest(stdR)
+		if err != nil {
+			return
+		}
+		body, err := ioutil.ReadAll(stdReq.Body)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(body, req.BodyRaw()) {
+			t.Fatalf("body %q != %q: %q", req.BodyRaw(), body, data)
+		}
+		if remaining(r, src) != remaining(stdR, stdSrc) {
+			t.Fatalf("consumed bytes mismatch: %q", data)
+		}
+	})
+}
+
+func FuzzParseResponse(f *testing.F) {
+	for _, c := range responseParseCases {
+		f.Add([]byte(c.raw))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var res Response
+		src := bytes.NewReader(data)
+		r := bufio.NewReader(src)
+		err := parseResponse(context.Background(), r, make([]byte, 512), &res, &defaultHTTPOption)
+		if err != nil {
+			return
+		}
+		if len(res.Header().GetAll(HeaderTransferEncoding))+len(res.Header().GetAll(HeaderContentLength)) > 1 {
+			t.Fatalf("ambiguous framing is accepted: %q", data)
+		}
+
+		stdSrc := bytes.NewReader(data)
+		stdR := bufio.NewReader(stdSrc)
+		stdRes, err := http.ReadResponse(stdR, nil)
+		if err != nil || (stdRes.ContentLength < 0 && len(stdRes.TransferEncoding) == 0) {
+			return // `net/http` reads the body until the connection is closed
+		}
+		body, err := ioutil.ReadAll(stdRes.Body)
+		if err != nil {
+			return
+		}
+		var got []byte
+		if res.Body() != nil {
+			got = res.Body().Bytes()
+		}
+		if !bytes.Equal(body, got) {
+			t.Fatalf("body %q != %q: %q", got, body, data)
+		}
+		if remaining(r, src) != remaining(stdR, stdSrc) {
+			t.Fatalf("consumed bytes mismatch: %q", data)
+		}
+	})
+}
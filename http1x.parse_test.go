@@ -0,0 +1,104 @@
+package sha
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+)
+
+type _ParseCase struct {
+	raw  string
+	lax  bool
+	err  error
+	body string
+}
+
+// the seeds of the fuzz tests also
+var requestParseCases = []_ParseCase{
+	{raw: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello", body: "hello"},
+	{raw: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length:5 \r\n\r\nhello", body: "hello"},
+	{raw: "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello", body: "hello"},
+	{raw: "POST / HTTP/1.1\r\nContent-Length: 5, 5\r\n\r\nhello", body: "hello"},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: Chunked\r\n\r\n5;a=b\r\nhello\r\n0\r\n\r\n", body: "hello"},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhe\r\n003\r\nllo\r\n0\r\nX-T: 1\r\n\r\n", body: "hello"},
+
+	{raw: "POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", err: ErrAmbiguousFraming},
+	{raw: "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello!", err: ErrBadContentLength},
+	{raw: "POST / HTTP/1.1\r\nContent-Length: 5, 6\r\n\r\nhello!", err: ErrBadContentLength},
+	{raw: "POST / HTTP/1.1\r\nContent-Length: +5\r\n\r\nhello", err: ErrBadContentLength},
+	{raw: "POST / HTTP/1.1\r\nContent-Length: 0x5\r\n\r\nhello", err: ErrBadContentLength},
+	{raw: "POST / HTTP/1.1\r\nContent-Length:\r\n\r\n", err: ErrBadContentLength},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked, gzip\r\n\r\n0\r\n\r\n", err: ErrBadTransferEncoding},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", err: ErrBadTransferEncoding},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n", err: ErrBadTransferEncoding},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n", err: ErrUnsupportedTransferEncoding},
+	{raw: "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", err: ErrBadTransferEncoding},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n", err: ErrBadHeaderName},
+	{raw: "POST / HTTP/1.1\r\n\x00Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n", err: ErrBadHeaderName},
+	{raw: "POST / HTTP/1.1\r\n: chunked\r\n\r\n", err: ErrBadHeaderName},
+	{raw: "POST / HTTP/1.1\r\nHost\r\n\r\n", err: ErrBadHeaderName},
+	{raw: "POST / HTTP/1.1\r\nHost: a\x00b\r\n\r\n", err: ErrBadHeaderValue},
+	{raw: "POST / HTTP/1.1\r\nX-A: 1\r\n Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n", err: ErrObsFold},
+	{raw: "POST / HTTP/1.1\r\nX-A: 1\nContent-Length: 5\r\n\r\nhello", err: ErrBareLF},
+	{raw: "POST / HTTP/1.1\nHost: a\r\n\r\n", err: ErrBareLF},
+	{raw: "POST  / HTTP/1.1\r\nHost: a\r\n\r\n", err: ErrBadHTTPPocketData},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\nhello\r\n0\r\n\r\n", err: ErrBareLF},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhelloXX0\r\n\r\n", err: ErrBadChunk},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n+5\r\nhello\r\n0\r\n\r\n", err: ErrBadChunk},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;a\x00\r\nhello\r\n0\r\n\r\n", err: ErrBadChunk},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nffffffff\r\nhello\r\n0\r\n\r\n", err: ErrBadChunk},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX-T: 1\r\n 2\r\n\r\n", err: ErrObsFold},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX-T 1\r\n\r\n", err: ErrBadHeaderName},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n1;" + strings.Repeat("a", 5000) + "\r\nh\r\n0\r\n\r\n", err: ErrBadChunk},
+	{
+		raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			strings.Repeat("1;"+strings.Repeat("a", 1000)+"\r\nh\r\n", 20) + "0\r\n\r\n",
+		err: ErrBadChunk,
+	},
+
+	{raw: "POST / HTTP/1.1\r\nX-A: 1\r\n Transfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\nhello", lax: true, body: "hello"},
+	{raw: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\nhello\n0\n\n", lax: true, body: "hello"},
+}
+
+var responseParseCases = []_ParseCase{
+	{raw: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", body: "hello"},
+	{raw: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", body: "hello"},
+	{raw: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", err: ErrAmbiguousFraming},
+	{raw: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Length: 0\r\n\r\nhello", err: ErrBadContentLength},
+	{raw: "HTTP/1.1 200 OK\r\nX-A: 1\r\n\tContent-Length: 5\r\n\r\nhello", err: ErrObsFold},
+	{raw: "HTTP/1.1 200 O\x01K\r\nContent-Length: 5\r\n\r\nhello", err: ErrBadHTTPPocketData},
+}
+
+func TestParseRequest_Strict(t *testing.T) {
+	for i, c := range requestParseCases {
+		var req Request
+		opt := defaultHTTPOption
+		opt.LaxParsing = c.lax
+		err := parseRequest(context.Background(), bufio.NewReader(strings.NewReader(c.raw)), make([]byte, 512), &req, &opt)
+		if err != c.err {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if err == nil && string(req.BodyRaw()) != c.body {
+			t.Fatalf("case %d: unexpected body %q", i, req.BodyRaw())
+		}
+		if v, ok := req.Trailer().Get("X-T"); ok && string(v) != "1" {
+			t.Fatalf("case %d: unexpected trailer %q", i, v)
+		}
+	}
+}
+
+func TestParseResponse_Strict(t *testing.T) {
+	for i, c := range responseParseCases {
+		var res Response
+		opt := defaultHTTPOption
+		opt.LaxParsing = c.lax
+		err := parseResponse(context.Background(), bufio.NewReader(strings.NewReader(c.raw)), make([]byte, 512), &res, &opt)
+		if err != c.err {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if err == nil && string(res.Body().Bytes()) != c.body {
+			t.Fatalf("case %d: unexpected body %q", i, res.Body().Bytes())
+		}
+	}
+}
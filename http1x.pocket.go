@@ -6,19 +6,24 @@ import (
 	"time"
 )
 
-var UniqueIDGenerator interface {
+type IDGenerator interface {
 	Size() int
 	Generate([]byte)
 }
 
+// UniqueIDGenerator is used by `GUID`, nil means no id, such as `utils.ULIDGenerator{}`.
+var UniqueIDGenerator IDGenerator
+
 type _HTTPPocket struct {
 	fl1    []byte
 	fl2    []byte
 	fl3    []byte
 	header Header
 	body   *bytes.Buffer
-	time   int64
-	guid   []byte
+	// the fields after the chunked body or the http2 data frames
+	trailer Header
+	time    int64
+	guid    []byte
 }
 
 var bodyBufPool = sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
@@ -48,6 +53,7 @@ func (p *_HTTPPocket) reset(maxCap int) {
 	p.guid = p.guid[:0]
 
 	p.header.Reset()
+	p.trailer.Reset()
 
 	if p.body != nil {
 		p.body.Reset()
@@ -67,6 +73,12 @@ func (p *_HTTPPocket) Write(v []byte) (int, error) {
 
 func (p *_HTTPPocket) Header() *Header { return &p.header }
 
+// Trailer returns the trailer fields, which are sent after the body.
+// the trailer of the response is announced by the `Trailer` header. for `RequestCtx.WriteStream`, the keys should be
+// set before writing the stream, and the values can be changed until the stream is EOF. the buffered response with
+// the trailer is sent by the chunked encoding, and the trailer is dropped for the http1.0 clients.
+func (p *_HTTPPocket) Trailer() *Header { return &p.trailer }
+
 func (p *_HTTPPocket) UnixNano() int64 { return p.time }
 
 func (p *_HTTPPocket) setTime() { p.time = time.Now().UnixNano() }
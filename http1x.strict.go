@@ -0,0 +1,205 @@
+package sha
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+
+	"github.com/zzztttkkk/sha/internal"
+)
+
+var (
+	ErrObsFold                     = errors.New("sha.http: obsolete line folding")
+	ErrBareLF                      = errors.New("sha.http: bare LF")
+	ErrBadHeaderName               = errors.New("sha.http: bad header name")
+	ErrBadHeaderValue              = errors.New("sha.http: bad header value")
+	ErrBadContentLength            = errors.New("sha.http: bad content-length")
+	ErrBadTransferEncoding         = errors.New("sha.http: bad transfer-encoding")
+	ErrAmbiguousFraming            = errors.New("sha.http: both transfer-encoding and content-length")
+	ErrBadChunk                    = errors.New("sha.http: bad chunk")
+	ErrUnsupportedTransferEncoding = errors.New("sha.http: unsupported transfer-encoding")
+)
+
+func init() {
+	for _, err := range []error{
+		ErrObsFold, ErrBareLF, ErrBadHeaderName, ErrBadHeaderValue,
+		ErrBadContentLength, ErrBadTransferEncoding, ErrAmbiguousFraming, ErrBadChunk,
+	} {
+		internal.ErrorStatusByValue[err] = StatusBadRequest
+	}
+	internal.ErrorStatusByValue[ErrUnsupportedTransferEncoding] = StatusNotImplemented
+}
+
+const (
+	// the max size of a chunk size line, include the chunk extensions
+	maxChunkLineSize = 4096
+	// the max size of all chunk extensions of a pocket, tiny chunks with huge extensions cost much more than the body
+	maxChunkExtSize = 16 * 1024
+)
+
+// tokenTable is the `tchar` of RFC 9110 section 5.6.2
+var tokenTable [256]bool
+
+func init() {
+	for _, b := range []byte("!#$%&'*+-.^_`|~0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+		tokenTable[b] = true
+	}
+}
+
+func isCTL(b byte) bool { return b < 0x20 || b == 0x7f }
+
+func isOWS(b byte) bool { return b == ' ' || b == '\t' }
+
+func trimOWS(v []byte) []byte {
+	for len(v) > 0 && isOWS(v[0]) {
+		v = v[1:]
+	}
+	for len(v) > 0 && isOWS(v[len(v)-1]) {
+		v = v[:len(v)-1]
+	}
+	return v
+}
+
+// supportChunked returns false if the version is lower than HTTP/1.1
+func supportChunked(version []byte) bool {
+	return len(version) == 8 && (version[5] > '1' || version[5] == '1' && version[7] >= '1')
+}
+
+// checkFraming rejects the pocket whose body length can not be determined reliably, RFC 9112 section 6.
+// `transfer-encoding` and `content-length` are normalized to a single value, so `bodyFraming` can trust them.
+func (p *_HTTPPocket) checkFraming(version []byte) error {
+	header := &p.header
+	tes := header.GetAll(HeaderTransferEncoding)
+	cls := header.GetAll(HeaderContentLength)
+
+	if len(tes) > 0 {
+		if len(cls) > 0 {
+			return ErrAmbiguousFraming
+		}
+		if !supportChunked(version) {
+			return ErrBadTransferEncoding
+		}
+
+		var codings int
+		var isChunked bool
+		for _, v := range tes {
+			for _, coding := range bytes.Split(v, []byte{','}) {
+				coding = trimOWS(coding)
+				if len(coding) < 1 {
+					continue
+				}
+				if isChunked { // `chunked` must be the final coding and be applied only once
+					return ErrBadTransferEncoding
+				}
+				codings++
+				isChunked = bytes.EqualFold(coding, []byte(chunked))
+			}
+		}
+		if !isChunked {
+			return ErrBadTransferEncoding
+		}
+		if codings > 1 { // such as `gzip, chunked`
+			return ErrUnsupportedTransferEncoding
+		}
+		header.SetString(HeaderTransferEncoding, chunked)
+		return nil
+	}
+
+	if len(cls) < 1 {
+		return nil
+	}
+	var size int64 = -1
+	var normalize = len(cls) > 1
+	for _, v := range cls {
+		for _, item := range bytes.Split(v, []byte{','}) {
+			item = trimOWS(item)
+			if len(item) < 1 || len(item) > 18 {
+				return ErrBadContentLength
+			}
+			var n int64
+			for _, b := range item {
+				if b < '0' || b > '9' {
+					return ErrBadContentLength
+				}
+				n = n*10 + int64(b-'0')
+			}
+			if size > -1 && n != size {
+				return ErrBadContentLength
+			}
+			size = n
+		}
+		if bytes.IndexByte(v, ',') > -1 {
+			normalize = true
+		}
+	}
+	if normalize {
+		header.SetString(HeaderContentLength, strconv.FormatInt(size, 10))
+	}
+	return nil
+}
+
+// readChunkLine reads a line of the chunked body without the line ending.
+func readChunkLine(r *bufio.Reader, strict bool) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, ErrBadChunk
+		}
+		return nil, err
+	}
+	if len(line) > maxChunkLineSize {
+		return nil, ErrBadChunk
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		return line[:len(line)-1], nil
+	}
+	if strict {
+		return nil, ErrBareLF
+	}
+	return line, nil
+}
+
+// parseChunkSize returns the chunk size and the size of the chunk extensions.
+func parseChunkSize(line []byte, strict bool) (int, int, error) {
+	var ext []byte
+	if ind := bytes.IndexByte(line, ';'); ind > -1 {
+		line, ext = line[:ind], line[ind:]
+	}
+	if strict {
+		for _, b := range ext {
+			if isCTL(b) && b != '\t' {
+				return 0, 0, ErrBadChunk
+			}
+		}
+		for len(line) > 0 && isOWS(line[len(line)-1]) { // BWS before the extensions
+			line = line[:len(line)-1]
+		}
+	} else {
+		line = bytes.TrimSpace(line)
+	}
+
+	// 7 hex digits is large enough for the 32-bit size, the leading zeros are allowed
+	for len(line) > 1 && line[0] == '0' {
+		line = line[1:]
+	}
+	if len(line) < 1 || len(line) > 7 {
+		return 0, 0, ErrBadChunk
+	}
+	var size int
+	for _, b := range line {
+		switch {
+		case b >= '0' && b <= '9':
+			b -= '0'
+		case b >= 'a' && b <= 'f':
+			b -= 'a' - 10
+		case b >= 'A' && b <= 'F':
+			b -= 'A' - 10
+		default:
+			return 0, 0, ErrBadChunk
+		}
+		size = size<<4 | int(b)
+	}
+	return size, len(ext), nil
+}
@@ -0,0 +1,109 @@
+package sha
+
+import (
+	"bufio"
+	"bytes"
+
+	"github.com/zzztttkkk/sha/utils"
+)
+
+// parseTrailer reads the trailer fields after the last chunk, until the empty line.
+// the trailer is limited by `MaxHeaderPartSize` and `MaxHeaderCount` as the header.
+func parseTrailer(reader *bufio.Reader, trailer *Header, opt *HTTPOptions) error {
+	var (
+		strict = !opt.LaxParsing
+		size   int
+		count  int
+	)
+	trailer.fromOutSide = true
+
+	for {
+		line, err := readChunkLine(reader, strict)
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 {
+			return nil
+		}
+
+		size += len(line) + 2
+		if opt.MaxHeaderPartSize > 0 && size > opt.MaxHeaderPartSize {
+			return StatusError(StatusRequestHeaderFieldsTooLarge)
+		}
+		if count++; opt.MaxHeaderCount > 0 && count > opt.MaxHeaderCount {
+			return ErrTooManyHeaders
+		}
+
+		ind := bytes.IndexByte(line, ':')
+		if !strict {
+			if ind < 1 {
+				continue
+			}
+			item := trailer.AppendBytes(nil, trimOWS(line[ind+1:]))
+			for _, b := range line[:ind] {
+				item.Key = append(item.Key, toLowerTable[b])
+			}
+			continue
+		}
+
+		if isOWS(line[0]) {
+			return ErrObsFold
+		}
+		if ind < 1 {
+			return ErrBadHeaderName
+		}
+		for _, b := range line[:ind] {
+			if !tokenTable[b] {
+				return ErrBadHeaderName
+			}
+		}
+		val := trimOWS(line[ind+1:])
+		for _, b := range val {
+			if isCTL(b) && b != '\t' {
+				return ErrBadHeaderValue
+			}
+		}
+		item := trailer.AppendBytes(nil, val)
+		for _, b := range line[:ind] {
+			item.Key = append(item.Key, toLowerTable[b])
+		}
+	}
+}
+
+// announceTrailer sets the `Trailer` header by the keys of the trailer, if it is not set by the user.
+func (p *_HTTPPocket) announceTrailer() {
+	if p.trailer.Size() < 1 {
+		return
+	}
+	if _, ok := p.header.Get(HeaderTrailer); ok {
+		return
+	}
+	var keys []byte
+	p.trailer.EachKey(func(k []byte) bool {
+		if len(keys) > 0 {
+			keys = append(keys, ", "...)
+		}
+		keys = append(keys, k...)
+		return true
+	})
+	p.header.Set(HeaderTrailer, keys)
+}
+
+// writeLastChunk writes the last chunk, the trailer and the empty line.
+func writeLastChunk(buf *bufio.Writer, trailer *Header) {
+	const (
+		endLine     = "\r\n"
+		headerKVSep = ": "
+	)
+	buf.WriteString("0" + endLine)
+	trailer.EachItem(
+		func(item *utils.KvItem) bool {
+			buf.Write(item.Key)
+			buf.WriteString(headerKVSep)
+			utils.EncodeHeaderValueToBuf(item.Val, buf)
+			buf.WriteString(endLine)
+			return true
+		},
+	)
+	buf.WriteString(endLine)
+}
@@ -0,0 +1,55 @@
+package sha
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// _ConnWatcher reads the connection in background while the handler is running, the request context is canceled if
+// the client is disconnected. the data read from the connection belongs to the next pipelined request, it is kept in
+// `pending` and returned by the next read of `_PipelineReader`.
+type _ConnWatcher struct {
+	conn     net.Conn
+	buf      [1]byte
+	pending  []byte
+	stopping int32
+	done     chan struct{}
+}
+
+func (w *_ConnWatcher) start(conn net.Conn, cancel func()) {
+	w.conn = conn
+	w.done = make(chan struct{})
+	atomic.StoreInt32(&w.stopping, 0)
+
+	go func() {
+		defer close(w.done)
+		n, err := conn.Read(w.buf[:])
+		if n > 0 {
+			w.pending = w.buf[:n]
+			return
+		}
+		if err != nil && atomic.LoadInt32(&w.stopping) == 0 { // EOF or reset
+			cancel()
+		}
+	}()
+}
+
+// stop interrupts the background reading and waits for it.
+func (w *_ConnWatcher) stop() {
+	if w == nil || w.done == nil {
+		return
+	}
+	atomic.StoreInt32(&w.stopping, 1)
+	_ = w.conn.SetReadDeadline(time.Now())
+	<-w.done
+	_ = w.conn.SetReadDeadline(time.Time{})
+	w.done = nil
+}
+
+// read returns the pending data.
+func (w *_ConnWatcher) read(p []byte) int {
+	n := copy(p, w.pending)
+	w.pending = w.pending[n:]
+	return n
+}
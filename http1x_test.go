@@ -0,0 +1,436 @@
+package sha
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zzztttkkk/sha/utils"
+)
+
+func startHTTP11TestServer(t *testing.T, handler RequestCtxHandler, setup func(s *Server)) (string, func()) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := DefaultWithContext(ctx)
+	s.Handler = handler
+	if setup != nil {
+		setup(s)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Serve(l)
+		close(done)
+	}()
+	return l.Addr().String(), func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestHTTP11Protocol_Pipelining(t *testing.T) {
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_ = ctx.WriteString(fmt.Sprintf("%s %s", ctx.Request.Path(), ctx.Request.BodyRaw()))
+	}), nil)
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var buf strings.Builder
+	for i := 0; i < 10; i++ {
+		buf.WriteString(fmt.Sprintf("POST /%d HTTP/1.1\r\nHost: sha.local\r\nContent-Length: 4\r\n\r\nbody", i))
+	}
+	buf.WriteString("GET /last HTTP/1.1\r\nHost: sha.local\r\nConnection: close\r\n\r\n")
+	if _, err = conn.Write([]byte(buf.String())); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(conn)
+	for i := 0; i < 10; i++ {
+		res, err := http.ReadResponse(r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		if string(body) != fmt.Sprintf("/%d body", i) {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "/last " || !res.Close {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestHTTP11Protocol_ExpectContinue(t *testing.T) {
+	addr, stop := startHTTP11TestServer(
+		t,
+		RequestCtxHandlerFunc(func(ctx *RequestCtx) { _, _ = ctx.Write(ctx.Request.BodyRaw()) }),
+		func(s *Server) {
+			s.OnExpectContinue = func(ctx *RequestCtx) int {
+				if ctx.Request.Path() == "/reject" {
+					return StatusRequestEntityTooLarge
+				}
+				return StatusContinue
+			}
+		},
+	)
+	defer stop()
+
+	send := func(req string) (*bufio.Reader, net.Conn) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = conn.Write([]byte(req))
+		return bufio.NewReader(conn), conn
+	}
+
+	r, conn := send("POST /echo HTTP/1.1\r\nHost: sha.local\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	defer conn.Close()
+	res, err := http.ReadResponse(r, nil)
+	if err != nil || res.StatusCode != StatusContinue {
+		t.Fatalf("unexpected response %v %v", res, err)
+	}
+	_, _ = conn.Write([]byte("hello"))
+	res, err = http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "hello" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	for path, expect := range map[string]string{"/reject": "100-continue", "/echo": "something"} {
+		r, conn := send(fmt.Sprintf("POST %s HTTP/1.1\r\nHost: sha.local\r\nContent-Length: 5\r\nExpect: %s\r\n\r\n", path, expect))
+		res, err := http.ReadResponse(r, nil)
+		_ = conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := StatusRequestEntityTooLarge
+		if expect != "100-continue" {
+			expected = StatusExpectationFailed
+		}
+		if res.StatusCode != expected || !res.Close {
+			t.Fatalf("unexpected response %d close=%v", res.StatusCode, res.Close)
+		}
+	}
+}
+
+func TestHTTP11Protocol_SlowRequest(t *testing.T) {
+	cases := []struct {
+		opt    HTTPOptions
+		chunks []string
+		delay  time.Duration
+		err    error
+	}{
+		{
+			opt:    HTTPOptions{MaxHeaderReadDuration: utils.TomlDuration{Duration: time.Millisecond * 200}},
+			chunks: []string{"GET / HTTP/1.1\r\n", "Host: sha.local\r\n", "X-A: 1\r\n", "X-B: 2\r\n", "X-C: 3\r\n", "\r\n"},
+			delay:  time.Millisecond * 80,
+			err:    ErrHeaderReadTimeout,
+		},
+		{
+			opt:    HTTPOptions{MaxHeaderCount: 3},
+			chunks: []string{"GET / HTTP/1.1\r\nHost: sha.local\r\nX-A: 1\r\nX-B: 2\r\nX-C: 3\r\n\r\n"},
+			err:    ErrTooManyHeaders,
+		},
+		{
+			opt:    HTTPOptions{MinTransferRate: 1024},
+			chunks: strings.Split("GET / HTTP/1.1\r\nHost: sha.local\r\n\r\n", ""),
+			delay:  time.Millisecond * 100,
+			err:    ErrTransferRateTooLow,
+		},
+		{
+			opt:    HTTPOptions{MaxBodyReadDuration: utils.TomlDuration{Duration: time.Millisecond * 200}},
+			chunks: []string{"POST / HTTP/1.1\r\nHost: sha.local\r\nContent-Length: 6\r\n\r\n", "ab", "cd", "ef", "gh"},
+			delay:  time.Millisecond * 80,
+			err:    ErrBodyReadTimeout,
+		},
+	}
+
+	for i, c := range cases {
+		errs := make(chan error, 1)
+		addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {}), func(s *Server) {
+			s.SetHTTPProtocol(newHTTP11Protocol(NewRequestCtxPool(&c.opt)))
+			s.OnParseError = func(conn net.Conn, err error) { errs <- err }
+		})
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range c.chunks {
+			if _, err = conn.Write([]byte(chunk)); err != nil {
+				break
+			}
+			time.Sleep(c.delay)
+		}
+
+		select {
+		case err = <-errs:
+			if err != c.err {
+				t.Fatalf("case %d: unexpected error %v", i, err)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("case %d: expected error %v", i, c.err)
+		}
+		_ = conn.Close()
+		stop()
+	}
+}
+
+func TestCli_SlowResponse(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Read(make([]byte, 1024))
+		for _, b := range []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n") {
+			if _, err = conn.Write([]byte{b}); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond * 50)
+		}
+	}()
+
+	cli := newCliConn(
+		l.Addr().String(), false,
+		&CliConnectionOptions{
+			HTTPOptions: &HTTPOptions{MaxHeaderReadDuration: utils.TomlDuration{Duration: time.Millisecond * 200}},
+		},
+		nil,
+	)
+	defer cli.Close()
+
+	ctx := AcquireRequestCtx(context.Background())
+	defer ReleaseRequestCtx(ctx)
+	ctx.Request.SetPathString("/")
+	if err = cli.Send(ctx); err != ErrHeaderReadTimeout {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestHTTP11Protocol_Smuggling(t *testing.T) {
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_ = ctx.WriteString(ctx.Request.Path())
+	}), nil)
+	defer stop()
+
+	for _, c := range []struct {
+		raw    string
+		status int
+	}{
+		{"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 6\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nGET /smuggled HTTP/1.1\r\nHost: a\r\n\r\n", StatusBadRequest},
+		{"POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhelloGET /smuggled HTTP/1.1\r\nHost: a\r\n\r\n", StatusBadRequest},
+		{"POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n", StatusNotImplemented},
+	} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = conn.Write([]byte(c.raw))
+		r := bufio.NewReader(conn)
+		res, err := http.ReadResponse(r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != c.status || !res.Close {
+			t.Fatalf("unexpected response %d close=%v", res.StatusCode, res.Close)
+		}
+		_, _ = ioutil.ReadAll(res.Body)
+		if _, err = http.ReadResponse(r, nil); err == nil {
+			t.Fatal("the smuggled request is processed")
+		}
+		_ = conn.Close()
+	}
+}
+
+const trailerTestData = "sha trailer"
+
+// _EOFReader calls onEOF when the stream is EOF, so the checksum of the stream can be set to the trailer.
+type _EOFReader struct {
+	io.Reader
+	onEOF func()
+}
+
+func (r *_EOFReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF && r.onEOF != nil {
+		r.onEOF()
+		r.onEOF = nil
+	}
+	return n, err
+}
+
+var trailerTestHandler = RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+	reqSum, _ := ctx.Request.Trailer().Get("X-Sum")
+	res := &ctx.Response
+	res.Trailer().SetString("X-Request-Sum", string(reqSum))
+	res.Trailer().SetString("X-Sum", "")
+
+	h := md5.New()
+	_ = ctx.WriteStream(&_EOFReader{
+		Reader: io.TeeReader(strings.NewReader(trailerTestData), h),
+		onEOF:  func() { res.Trailer().SetString("X-Sum", fmt.Sprintf("%x", h.Sum(nil))) },
+	})
+})
+
+func checkTrailerTestResponse(t *testing.T, cli *http.Client, url string) {
+	sum := fmt.Sprintf("%x", md5.Sum([]byte(trailerTestData)))
+	// the length of the multi reader is unknown, so the request body is chunked
+	req, _ := http.NewRequest(MethodPost, url, io.MultiReader(strings.NewReader(trailerTestData)))
+	req.Trailer = http.Header{"X-Sum": {"request"}}
+	res, err := cli.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != trailerTestData {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if res.Trailer.Get("X-Sum") != sum || res.Trailer.Get("X-Request-Sum") != "request" {
+		t.Fatalf("unexpected trailer %v", res.Trailer)
+	}
+}
+
+func TestHTTP11Protocol_Trailer(t *testing.T) {
+	addr, stop := startHTTP11TestServer(t, trailerTestHandler, nil)
+	defer stop()
+
+	checkTrailerTestResponse(t, &http.Client{}, "http://"+addr)
+
+	cli := newCliConn(addr, false, &CliConnectionOptions{}, nil)
+	defer cli.Close()
+	for i := 0; i < 2; i++ { // nothing is written after the stream, the connection can be reused
+		ctx := AcquireRequestCtx(context.Background())
+		ctx.Request.SetPathString("/")
+		if err := cli.Send(ctx); err != nil {
+			t.Fatal(err)
+		}
+		v, _ := ctx.Response.Trailer().Get("X-Sum")
+		if string(v) != fmt.Sprintf("%x", md5.Sum([]byte(trailerTestData))) {
+			t.Fatalf("unexpected trailer %q", v)
+		}
+		ReleaseRequestCtx(ctx)
+	}
+}
+
+func TestHTTP11Protocol_BufferedTrailer(t *testing.T) {
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_ = ctx.WriteString("hello")
+		ctx.Response.Trailer().SetString("X-Sum", "5")
+	}), nil)
+	defer stop()
+
+	res, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if string(body) != "hello" || res.Trailer.Get("X-Sum") != "5" || len(res.TransferEncoding) != 1 {
+		t.Fatalf("unexpected response %q %v %v", body, res.Trailer, res.TransferEncoding)
+	}
+
+	// http1.0 clients do not support the chunked encoding, the trailer is dropped
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	res, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	if string(body) != "hello" || res.ContentLength != 5 || len(res.Trailer) != 0 {
+		t.Fatalf("unexpected response %q %v", body, res.Trailer)
+	}
+}
+
+func TestHTTP11Protocol_Disconnect(t *testing.T) {
+	canceled := make(chan error, 1)
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		switch ctx.Request.Path() {
+		case "/wait":
+			select {
+			case <-ctx.Done():
+				canceled <- ctx.Err()
+			case <-time.After(time.Second * 3):
+				canceled <- nil
+			}
+		case "/slow":
+			time.Sleep(time.Millisecond * 100)
+			_ = ctx.WriteString(fmt.Sprintf("%v", ctx.Err()))
+		default:
+			_ = ctx.WriteString("next")
+		}
+	}), nil)
+	defer stop()
+
+	// the context is canceled after the client is gone
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("GET /wait HTTP/1.1\r\nHost: a\r\n\r\n"))
+	time.Sleep(time.Millisecond * 50)
+	_ = conn.Close()
+	if err := <-canceled; err != context.Canceled {
+		t.Fatalf("unexpected context error %v", err)
+	}
+
+	// the pipelined request arrives while the handler is running, it is not a disconnection and it is not lost
+	conn, err = net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: a\r\n\r\n"))
+	time.Sleep(time.Millisecond * 50)
+	_, _ = conn.Write([]byte("GET /next HTTP/1.1\r\nHost: a\r\nConnection: close\r\n\r\n"))
+
+	r := bufio.NewReader(conn)
+	for _, body := range []string{"<nil>", "next"} {
+		res, err := http.ReadResponse(r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(res.Body)
+		if string(data) != body {
+			t.Fatalf("unexpected body %q", data)
+		}
+	}
+}
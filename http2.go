@@ -0,0 +1,1097 @@
+package sha
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zzztttkkk/sha/utils"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+type HTTP2Options struct {
+	MaxConcurrentStreams uint32 `json:"max_concurrent_streams" toml:"max-concurrent-streams"`
+	MaxReadFrameSize     uint32 `json:"max_read_frame_size" toml:"max-read-frame-size"`
+	InitialWindowSize    uint32 `json:"initial_window_size" toml:"initial-window-size"`
+	MaxHeaderListSize    uint32 `json:"max_header_list_size" toml:"max-header-list-size"`
+	DisableH2C           bool   `json:"disable_h2c" toml:"disable-h2c"` // disable cleartext http2(prior-knowledge and `Upgrade: h2c`)
+}
+
+var defaultHTTP2Option = HTTP2Options{
+	MaxConcurrentStreams: 250,
+	MaxReadFrameSize:     1 << 20,
+	InitialWindowSize:    1 << 20,
+}
+
+const (
+	HTTPVersion20 = "HTTP/2.0"
+
+	http2NextProto      = "h2"
+	http2CleartextProto = "h2c"
+	http2DefaultWindow  = 65535
+	http2DefaultFrame   = 16384
+	http2MaxWindow      = 1<<31 - 1
+)
+
+var (
+	ErrHTTP2StreamClosed = errors.New("sha.http2: stream closed")
+)
+
+type _Http2Protocol struct {
+	HTTP2Options
+	http11 *_Http11Protocol
+	pool   *RequestCtxPool
+}
+
+// NewHTTP2Protocol returns a protocol that serves http2 over tls(alpn `h2`) and cleartext http2,
+// other connections fall back to http1.x.
+func NewHTTP2Protocol(pool *RequestCtxPool, opt *HTTP2Options) HTTPServerProtocol {
+	if pool == nil {
+		pool = defaultRCtxPool
+	}
+
+	v := &_Http2Protocol{pool: pool}
+	if opt == nil {
+		v.HTTP2Options = defaultHTTP2Option
+	} else {
+		v.HTTP2Options = *opt
+		utils.Merge(&v.HTTP2Options, defaultHTTP2Option)
+	}
+	if v.MaxHeaderListSize == 0 {
+		v.MaxHeaderListSize = uint32(pool.opt.MaxHeaderPartSize)
+	}
+
+	v.http11 = newHTTP11Protocol(pool).(*_Http11Protocol)
+	if !v.DisableH2C {
+		v.http11.h2c = v
+	}
+	return v
+}
+
+// recvWindow returns the advertised receive window of the connection and the streams. the peer may send
+// in the default window before acknowledging our settings, so the window is never smaller than it.
+func (protocol *_Http2Protocol) recvWindow() int32 {
+	if protocol.InitialWindowSize < http2DefaultWindow {
+		return http2DefaultWindow
+	}
+	if protocol.InitialWindowSize > http2MaxWindow {
+		return http2MaxWindow
+	}
+	return int32(protocol.InitialWindowSize)
+}
+
+func isHTTP2Protocol(p HTTPServerProtocol) bool {
+	_, ok := p.(*_Http2Protocol)
+	return ok
+}
+
+type _PeekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *_PeekedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+var peekReaderPool sync.Pool
+
+func peekHTTP2Preface(r *bufio.Reader) bool {
+	for i := 1; i <= len(http2.ClientPreface); i++ {
+		v, err := r.Peek(i)
+		if err != nil || v[i-1] != http2.ClientPreface[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+func (protocol *_Http2Protocol) ServeConn(ctx context.Context, conn net.Conn) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if tlsConn.ConnectionState().NegotiatedProtocol == http2NextProto {
+			protocol.serve(ctx, conn, bufio.NewReader(conn), nil)
+			return
+		}
+		protocol.http11.ServeConn(ctx, conn)
+		return
+	}
+
+	if protocol.DisableH2C {
+		protocol.http11.ServeConn(ctx, conn)
+		return
+	}
+
+	var r *bufio.Reader
+	if v := peekReaderPool.Get(); v != nil {
+		r = v.(*bufio.Reader)
+		r.Reset(conn)
+	} else {
+		r = bufio.NewReaderSize(conn, protocol.pool.opt.ReadBufferSize)
+	}
+	defer func() {
+		r.Reset(nil)
+		peekReaderPool.Put(r)
+	}()
+
+	server := ctx.Value(CtxKeyServer).(*Server)
+	if readTimeout := server.Options.ReadTimeout.Duration; readTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+	}
+	if peekHTTP2Preface(r) {
+		protocol.serve(ctx, conn, r, nil)
+		return
+	}
+	protocol.http11.ServeConn(ctx, &_PeekedConn{Conn: conn, r: r})
+}
+
+func isH2CUpgrade(req *Request) bool {
+	v, _ := req.Header().Get(HeaderUpgrade)
+	if !strings.EqualFold(utils.S(v), http2CleartextProto) {
+		return false
+	}
+	if len(req.Header().GetAll(HeaderHTTP2Settings)) != 1 {
+		return false
+	}
+	var connUpgrade, connSettings bool
+	for _, hv := range req.Header().GetAll(HeaderConnection) {
+		for _, token := range strings.Split(utils.S(hv), ",") {
+			token = strings.TrimSpace(token)
+			if strings.EqualFold(token, upgrade) {
+				connUpgrade = true
+			} else if strings.EqualFold(token, HeaderHTTP2Settings) {
+				connSettings = true
+			}
+		}
+	}
+	return connUpgrade && connSettings
+}
+
+const h2cSwitchingResponse = "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"
+
+// serveUpgrade serves a connection upgraded by `Upgrade: h2c`, the http1.x request becomes the stream 1.
+func (protocol *_Http2Protocol) serveUpgrade(ctx *RequestCtx) {
+	settingsVal, _ := ctx.Request.Header().Get(HeaderHTTP2Settings)
+	settings, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(utils.S(settingsVal), "="))
+	if err != nil || len(settings)%6 != 0 {
+		ctx.Response.SetStatusCode(StatusBadRequest)
+		_ = sendResponse(ctx.w, &ctx.Response)
+		return
+	}
+
+	if _, err = ctx.w.WriteString(h2cSwitchingResponse); err != nil {
+		return
+	}
+	if err = ctx.w.Flush(); err != nil {
+		return
+	}
+
+	rctx := protocol.pool.Acquire()
+	req := &rctx.Request
+	req.header.fromOutSide = true
+	req.fl1 = append(req.fl1, ctx.Request.fl1...)
+	req.fl2 = append(req.fl2, ctx.Request.fl2...)
+	req.fl3 = append(req.fl3, HTTPVersion20...)
+	ctx.Request.header.EachItem(func(item *utils.KvItem) bool {
+		if !isHTTP2ConnectionHeader(item.Key) && !strings.EqualFold(utils.S(item.Key), HeaderHTTP2Settings) {
+			req.header.AppendBytes(item.Key, item.Val)
+		}
+		return true
+	})
+	if body := ctx.Request.body; body != nil && body.Len() > 0 {
+		_, _ = req._HTTPPocket.Write(body.Bytes())
+	}
+
+	protocol.serve(ctx.ctx, ctx.conn, ctx.r, &_Http2Upgrade{rctx: rctx, settings: settings})
+}
+
+type _Http2Upgrade struct {
+	rctx     *RequestCtx
+	settings []byte
+}
+
+type _Http2Stream struct {
+	id          uint32
+	c           *_Http2Conn
+	rctx        *RequestCtx
+	sendWindow  int32
+	recvWindow  int32 // read loop only
+	dispatched  bool
+	headersSent bool
+	reset       bool
+}
+
+type _Http2Conn struct {
+	protocol *_Http2Protocol
+	server   *Server
+	ctx      context.Context
+	conn     net.Conn
+	bw       *bufio.Writer
+	framer   *http2.Framer
+
+	// guards framer writing and hpack encoding
+	wmu  sync.Mutex
+	henc *hpack.Encoder
+	hbuf bytes.Buffer
+
+	mu                sync.Mutex
+	cond              *sync.Cond
+	streams           map[uint32]*_Http2Stream
+	maxStreamID       uint32
+	sendWindow        int32
+	recvWindow        int32 // read loop only
+	peerInitialWindow int32
+	peerMaxFrameSize  uint32
+	goingAway         bool
+	closed            bool
+
+	tracker *_ConnTracker
+
+	wg sync.WaitGroup
+}
+
+func (protocol *_Http2Protocol) serve(ctx context.Context, conn net.Conn, r io.Reader, upgrade *_Http2Upgrade) {
+	server := ctx.Value(CtxKeyServer).(*Server)
+	c := &_Http2Conn{
+		protocol:          protocol,
+		server:            server,
+		ctx:               ctx,
+		conn:              conn,
+		bw:                bufio.NewWriterSize(conn, http2DefaultFrame),
+		streams:           map[uint32]*_Http2Stream{},
+		sendWindow:        http2DefaultWindow,
+		recvWindow:        protocol.recvWindow(),
+		peerInitialWindow: http2DefaultWindow,
+		peerMaxFrameSize:  http2DefaultFrame,
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.tracker = connTrackerFrom(ctx)
+	c.henc = hpack.NewEncoder(&c.hbuf)
+	c.framer = http2.NewFramer(c.bw, r)
+	c.framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	c.framer.MaxHeaderListSize = protocol.MaxHeaderListSize
+	c.framer.SetMaxReadFrameSize(protocol.MaxReadFrameSize)
+
+	defer c.close()
+
+	if upgrade != nil {
+		for p := upgrade.settings; len(p) >= 6; p = p[6:] {
+			s := http2.Setting{ID: http2.SettingID(binary.BigEndian.Uint16(p)), Val: binary.BigEndian.Uint32(p[2:])}
+			if c.applySetting(s) != nil {
+				protocol.pool.Release(upgrade.rctx)
+				return
+			}
+		}
+	}
+
+	_ = conn.SetReadDeadline(time.Time{})
+	if err := c.writeServerPreface(); err != nil {
+		if upgrade != nil {
+			protocol.pool.Release(upgrade.rctx)
+		}
+		return
+	}
+
+	if upgrade != nil {
+		st := c.newStream(1, upgrade.rctx)
+		c.maxStreamID = 1
+		c.dispatch(st)
+	}
+
+	if readTimeout := server.Options.ReadTimeout.Duration; readTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+	}
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(r, preface); err != nil || string(preface) != http2.ClientPreface {
+		return
+	}
+	c.tracker.setOnShutdown(func() {
+		c.goAway(http2.ErrCodeNo)
+		c.mu.Lock()
+		c.wakeIfDone()
+		c.mu.Unlock()
+	})
+	c.readLoop()
+}
+
+func (c *_Http2Conn) writeServerPreface() error {
+	opts := &c.protocol.HTTP2Options
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	err := c.framer.WriteSettings(
+		http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: opts.MaxConcurrentStreams},
+		http2.Setting{ID: http2.SettingMaxFrameSize, Val: opts.MaxReadFrameSize},
+		http2.Setting{ID: http2.SettingInitialWindowSize, Val: opts.InitialWindowSize},
+		http2.Setting{ID: http2.SettingMaxHeaderListSize, Val: opts.MaxHeaderListSize},
+	)
+	if err != nil {
+		return err
+	}
+	if opts.InitialWindowSize > http2DefaultWindow {
+		if err = c.framer.WriteWindowUpdate(0, opts.InitialWindowSize-http2DefaultWindow); err != nil {
+			return err
+		}
+	}
+	return c.bw.Flush()
+}
+
+func (c *_Http2Conn) readLoop() {
+	for {
+		if c.server.isRunning() {
+			_ = c.conn.SetReadDeadline(c.readDeadline())
+		} else if !c.isGoingAway() {
+			c.goAway(http2.ErrCodeNo)
+		}
+
+		frame, err := c.framer.ReadFrame()
+		if err != nil {
+			switch ev := err.(type) {
+			case http2.StreamError:
+				c.server.parseError()
+				c.resetStream(ev.StreamID, ev.Code)
+				continue
+			case http2.ConnectionError:
+				c.server.parseError()
+				c.goAway(http2.ErrCode(ev))
+			}
+			return
+		}
+
+		if err = c.processFrame(frame); err != nil {
+			if ce, ok := err.(http2.ConnectionError); ok {
+				c.server.parseError()
+				c.goAway(http2.ErrCode(ce))
+			}
+			return
+		}
+
+		c.mu.Lock()
+		done := c.goingAway && len(c.streams) == 0
+		c.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// readDeadline returns the deadline of the next frame: the idle timeout if there are no streams,
+// the read timeout of the oldest stream whose request is still being read, or no deadline if all the
+// streams are handled.
+func (c *_Http2Conn) readDeadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.streams) == 0 {
+		if idleTimeout := c.server.Options.IdleTimeout.Duration; idleTimeout > 0 {
+			return time.Now().Add(idleTimeout)
+		}
+		return time.Time{}
+	}
+
+	readTimeout := c.server.Options.ReadTimeout.Duration
+	if readTimeout <= 0 {
+		return time.Time{}
+	}
+	var deadline time.Time
+	for _, st := range c.streams {
+		if st.dispatched {
+			continue
+		}
+		if v := st.rctx.connTime.Add(readTimeout); deadline.IsZero() || v.Before(deadline) {
+			deadline = v
+		}
+	}
+	return deadline
+}
+
+func (c *_Http2Conn) processFrame(frame http2.Frame) error {
+	switch f := frame.(type) {
+	case *http2.SettingsFrame:
+		if f.IsAck() {
+			return nil
+		}
+		if err := f.ForeachSetting(c.applySetting); err != nil {
+			return err
+		}
+		c.wmu.Lock()
+		defer c.wmu.Unlock()
+		if err := c.framer.WriteSettingsAck(); err != nil {
+			return err
+		}
+		return c.bw.Flush()
+	case *http2.MetaHeadersFrame:
+		return c.onHeaders(f)
+	case *http2.DataFrame:
+		return c.onData(f)
+	case *http2.WindowUpdateFrame:
+		return c.onWindowUpdate(f)
+	case *http2.PingFrame:
+		if f.IsAck() {
+			return nil
+		}
+		c.wmu.Lock()
+		defer c.wmu.Unlock()
+		if err := c.framer.WritePing(true, f.Data); err != nil {
+			return err
+		}
+		return c.bw.Flush()
+	case *http2.RSTStreamFrame:
+		// the dispatched streams are released by `finishStream` only, it removes the stream under the lock before
+		// releasing the ctx, so the ctx of a stream in the map is still owned by this connection.
+		var pending *_Http2Stream
+		c.mu.Lock()
+		st := c.streams[f.StreamID]
+		if st != nil {
+			st.reset = true
+			st.rctx.cancelFunc()
+			if !st.dispatched {
+				pending = st
+				delete(c.streams, st.id)
+				if len(c.streams) == 0 {
+					c.tracker.setIdle(true)
+				}
+			}
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+
+		if pending != nil {
+			c.protocol.pool.Release(pending.rctx)
+		}
+		return nil
+	case *http2.GoAwayFrame:
+		c.mu.Lock()
+		c.goingAway = true
+		c.mu.Unlock()
+		return nil
+	case *http2.PushPromiseFrame:
+		return http2.ConnectionError(http2.ErrCodeProtocol)
+	}
+	return nil
+}
+
+func (c *_Http2Conn) applySetting(s http2.Setting) error {
+	if err := s.Valid(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch s.ID {
+	case http2.SettingInitialWindowSize:
+		delta := int32(s.Val) - c.peerInitialWindow
+		for _, st := range c.streams {
+			if int64(st.sendWindow)+int64(delta) > http2MaxWindow {
+				return http2.ConnectionError(http2.ErrCodeFlowControl)
+			}
+		}
+		for _, st := range c.streams {
+			st.sendWindow += delta
+		}
+		c.peerInitialWindow = int32(s.Val)
+		c.cond.Broadcast()
+	case http2.SettingMaxFrameSize:
+		c.peerMaxFrameSize = s.Val
+	case http2.SettingHeaderTableSize:
+		c.wmu.Lock()
+		c.henc.SetMaxDynamicTableSize(s.Val)
+		c.wmu.Unlock()
+	}
+	return nil
+}
+
+func (c *_Http2Conn) newStream(id uint32, rctx *RequestCtx) *_Http2Stream {
+	st := &_Http2Stream{id: id, c: c, rctx: rctx, recvWindow: c.protocol.recvWindow()}
+	rctx.h2 = st
+	rctx.conn = c.conn
+	rctx.connTime = time.Now()
+	rctx.ctx, rctx.cancelFunc = context.WithCancel(c.ctx)
+	if isTLSConn(c.conn) {
+		rctx.Request.flags.Add(_ReqFlagIsTLS)
+	}
+
+	c.mu.Lock()
+	st.sendWindow = c.peerInitialWindow
+	c.streams[id] = st
+	c.tracker.setIdle(false)
+	c.mu.Unlock()
+	return st
+}
+
+func (c *_Http2Conn) onHeaders(f *http2.MetaHeadersFrame) error {
+	id := f.StreamID
+
+	c.mu.Lock()
+	st := c.streams[id]
+	c.mu.Unlock()
+
+	if st != nil { // trailers
+		if st.dispatched || !f.StreamEnded() {
+			return http2.ConnectionError(http2.ErrCodeProtocol)
+		}
+		trailer := &st.rctx.Request.trailer
+		trailer.fromOutSide = true
+		for _, hf := range f.RegularFields() {
+			trailer.AppendString(hf.Name, hf.Value)
+		}
+		c.dispatch(st)
+		return nil
+	}
+
+	// written by the read loop only, and read by `goAway` under the lock
+	c.mu.Lock()
+	if id%2 == 0 || id <= c.maxStreamID {
+		c.mu.Unlock()
+		return http2.ConnectionError(http2.ErrCodeProtocol)
+	}
+	c.maxStreamID = id
+	refused := c.goingAway || uint32(len(c.streams)) >= c.protocol.MaxConcurrentStreams
+	c.mu.Unlock()
+	if refused {
+		c.resetStream(id, http2.ErrCodeRefusedStream)
+		return nil
+	}
+
+	method := f.PseudoValue("method")
+	path := f.PseudoValue("path")
+	if len(method) < 1 || (len(path) < 1 && method != MethodConnect) {
+		c.resetStream(id, http2.ErrCodeProtocol)
+		return nil
+	}
+
+	rctx := c.protocol.pool.Acquire()
+	req := &rctx.Request
+	req.header.fromOutSide = true
+	req.fl1 = append(req.fl1, method...)
+	req.fl2 = append(req.fl2, path...)
+	req.fl3 = append(req.fl3, HTTPVersion20...)
+	if authority := f.PseudoValue("authority"); len(authority) > 0 {
+		req.header.AppendString(lowerHeaderHost, authority)
+	}
+	for _, hf := range f.RegularFields() {
+		if hf.Name == lowerHeaderHost && len(f.PseudoValue("authority")) > 0 {
+			continue
+		}
+		req.header.AppendString(hf.Name, hf.Value)
+	}
+
+	st = c.newStream(id, rctx)
+	if f.Truncated {
+		c.reply(st, StatusRequestHeaderFieldsTooLarge)
+		return nil
+	}
+	req.methodToEnum()
+	rctx.route = routeOptionsOf(c.server.Handler, rctx)
+	if f.StreamEnded() {
+		c.dispatch(st)
+	}
+	return nil
+}
+
+func (c *_Http2Conn) onData(f *http2.DataFrame) error {
+	id := f.StreamID
+	size := f.Length
+
+	c.mu.Lock()
+	st := c.streams[id]
+	c.mu.Unlock()
+
+	// the padding is counted too
+	if int64(size) > int64(c.recvWindow) || (st != nil && !st.dispatched && int64(size) > int64(st.recvWindow)) {
+		return http2.ConnectionError(http2.ErrCodeFlowControl)
+	}
+	c.recvWindow -= int32(size)
+	if size > 0 {
+		if err := c.writeWindowUpdate(0, size); err != nil {
+			return err
+		}
+		c.recvWindow += int32(size)
+	}
+
+	if st == nil || st.dispatched {
+		if id > c.maxStreamID {
+			return http2.ConnectionError(http2.ErrCodeProtocol)
+		}
+		c.resetStream(id, http2.ErrCodeStreamClosed)
+		return nil
+	}
+
+	data := f.Data()
+	if len(data) > 0 {
+		req := &st.rctx.Request
+		maxBodySize := c.protocol.pool.opt.MaxBodySize
+		if route := st.rctx.route; route != nil && route.MaxBodySize != 0 {
+			maxBodySize = route.MaxBodySize
+		}
+		if maxBodySize > 0 && req.body != nil && req.body.Len()+len(data) > maxBodySize {
+			c.reply(st, StatusRequestEntityTooLarge)
+			return nil
+		}
+		_, _ = req._HTTPPocket.Write(data)
+	}
+
+	if f.StreamEnded() {
+		c.dispatch(st)
+		return nil
+	}
+	if size > 0 {
+		st.recvWindow -= int32(size)
+		if err := c.writeWindowUpdate(id, size); err != nil {
+			return err
+		}
+		st.recvWindow += int32(size)
+	}
+	return nil
+}
+
+func (c *_Http2Conn) onWindowUpdate(f *http2.WindowUpdateFrame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f.StreamID == 0 {
+		if int64(c.sendWindow)+int64(f.Increment) > http2MaxWindow {
+			return http2.ConnectionError(http2.ErrCodeFlowControl)
+		}
+		c.sendWindow += int32(f.Increment)
+	} else if st := c.streams[f.StreamID]; st != nil {
+		if int64(st.sendWindow)+int64(f.Increment) > http2MaxWindow {
+			st.reset = true
+			go c.resetStream(st.id, http2.ErrCodeFlowControl)
+		} else {
+			st.sendWindow += int32(f.Increment)
+		}
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+// reply sends a response without calling the handler and then discards the rest of the request.
+func (c *_Http2Conn) reply(st *_Http2Stream, status int) {
+	st.dispatched = true
+	st.rctx.Response.SetStatusCode(status)
+	c.wg.Add(1)
+	go func() {
+		defer c.finishStream(st)
+		if c.writeHeaders(st, &st.rctx.Response, true) == nil {
+			c.resetStream(st.id, http2.ErrCodeNo)
+		}
+	}()
+}
+
+func (c *_Http2Conn) dispatch(st *_Http2Stream) {
+	st.dispatched = true
+	req := &st.rctx.Request
+	req.methodToEnum()
+	req.parsePath()
+	req.setTime()
+
+	c.wg.Add(1)
+	go c.handle(st)
+}
+
+func (c *_Http2Conn) handle(st *_Http2Stream) {
+	defer c.finishStream(st)
+
+	ctx := st.rctx
+	if !c.server.acquireRequest() {
+		if c.server.Options.Limits.CloseOnOverload {
+			c.resetStream(st.id, http2.ErrCodeRefusedStream)
+			return
+		}
+		c.server.setOverloadResponse(ctx)
+		_ = c.writeResponse(st)
+		return
+	}
+	defer c.server.releaseRequest()
+
+	if c.server.OnNewRequestCtx != nil && c.server.OnNewRequestCtx(ctx) {
+		c.resetStream(st.id, http2.ErrCodeRefusedStream)
+		return
+	}
+
+	c.server.Handler.Handle(ctx)
+	if err := ctx.sw.finish(); err != nil || st.headersSent {
+		return
+	}
+	_ = c.writeResponse(st)
+}
+
+func (c *_Http2Conn) finishStream(st *_Http2Stream) {
+	st.rctx.cancelFunc()
+
+	c.mu.Lock()
+	delete(c.streams, st.id)
+	if len(c.streams) == 0 {
+		c.tracker.setIdle(true)
+		c.wakeIfDone()
+	}
+	c.mu.Unlock()
+
+	c.protocol.pool.Release(st.rctx)
+	c.wg.Done()
+}
+
+func (c *_Http2Conn) close() {
+	c.mu.Lock()
+	c.closed = true
+	var pending []*_Http2Stream
+	for id, st := range c.streams {
+		st.rctx.cancelFunc()
+		if !st.dispatched {
+			pending = append(pending, st)
+			delete(c.streams, id)
+		}
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	for _, st := range pending {
+		c.protocol.pool.Release(st.rctx)
+	}
+	c.wg.Wait()
+}
+
+func (c *_Http2Conn) isGoingAway() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.goingAway
+}
+
+// wakeIfDone interrupts the blocked reading after the last stream is done, so the read loop can exit.
+// c.mu must be held.
+func (c *_Http2Conn) wakeIfDone() {
+	if c.goingAway && len(c.streams) == 0 {
+		_ = c.conn.SetReadDeadline(time.Now())
+	}
+}
+
+func (c *_Http2Conn) goAway(code http2.ErrCode) {
+	c.mu.Lock()
+	c.goingAway = true
+	lastStreamID := c.maxStreamID
+	c.mu.Unlock()
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.framer.WriteGoAway(lastStreamID, code, nil) == nil {
+		_ = c.bw.Flush()
+	}
+}
+
+func (c *_Http2Conn) resetStream(id uint32, code http2.ErrCode) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.framer.WriteRSTStream(id, code) == nil {
+		_ = c.bw.Flush()
+	}
+}
+
+func (c *_Http2Conn) writeWindowUpdate(id, size uint32) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.framer.WriteWindowUpdate(id, size); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+const lowerHeaderHost = "host"
+
+var http2ConnectionHeaders = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+func isHTTP2ConnectionHeader(key []byte) bool {
+	return http2ConnectionHeaders[strings.ToLower(utils.S(key))]
+}
+
+func (c *_Http2Conn) writeHeaders(st *_Http2Stream, res *Response, endStream bool) error {
+	if c.isStreamClosed(st) {
+		return ErrHTTP2StreamClosed
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	st.headersSent = true
+
+	status := res.statusCode
+	if status == 0 {
+		status = StatusOK
+	}
+
+	c.hbuf.Reset()
+	_ = c.henc.WriteField(hpack.HeaderField{Name: ":status", Value: strconv.FormatInt(int64(status), 10)})
+	c.encodeFields(&res.header)
+	return c.writeHeaderBlock(st, endStream)
+}
+
+// writeTrailer sends the trailer fields and ends the stream.
+func (c *_Http2Conn) writeTrailer(st *_Http2Stream, trailer *Header) error {
+	if c.isStreamClosed(st) {
+		return ErrHTTP2StreamClosed
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.hbuf.Reset()
+	c.encodeFields(trailer)
+	return c.writeHeaderBlock(st, true)
+}
+
+func (c *_Http2Conn) encodeFields(header *Header) {
+	header.EachItem(func(item *utils.KvItem) bool {
+		if isHTTP2ConnectionHeader(item.Key) {
+			return true
+		}
+		_ = c.henc.WriteField(hpack.HeaderField{Name: strings.ToLower(string(item.Key)), Value: string(item.Val)})
+		return true
+	})
+}
+
+// writeHeaderBlock sends the encoded fields in `hbuf`, `wmu` must be locked.
+func (c *_Http2Conn) writeHeaderBlock(st *_Http2Stream, endStream bool) error {
+	block := c.hbuf.Bytes()
+	maxFrameSize := int(c.peerMaxFrameSize)
+	for first := true; first || len(block) > 0; first = false {
+		size := len(block)
+		if size > maxFrameSize {
+			size = maxFrameSize
+		}
+		endHeaders := size == len(block)
+
+		var err error
+		if first {
+			err = c.framer.WriteHeaders(
+				http2.HeadersFrameParam{
+					StreamID:      st.id,
+					BlockFragment: block[:size],
+					EndStream:     endStream,
+					EndHeaders:    endHeaders,
+				},
+			)
+		} else {
+			err = c.framer.WriteContinuation(st.id, endHeaders, block[:size])
+		}
+		if err != nil {
+			return err
+		}
+		block = block[size:]
+	}
+	return c.bw.Flush()
+}
+
+func (c *_Http2Conn) isStreamClosed(st *_Http2Stream) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed || st.reset
+}
+
+// takeSendWindow blocks until the peer allows us to send some bytes on this stream.
+func (c *_Http2Conn) takeSendWindow(st *_Http2Stream, want int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		if c.closed || st.reset {
+			return 0, ErrHTTP2StreamClosed
+		}
+
+		n := want
+		if n > int(c.peerMaxFrameSize) {
+			n = int(c.peerMaxFrameSize)
+		}
+		if n > int(c.sendWindow) {
+			n = int(c.sendWindow)
+		}
+		if n > int(st.sendWindow) {
+			n = int(st.sendWindow)
+		}
+		if n > 0 {
+			c.sendWindow -= int32(n)
+			st.sendWindow -= int32(n)
+			return n, nil
+		}
+		c.cond.Wait()
+	}
+}
+
+func (c *_Http2Conn) writeData(st *_Http2Stream, data []byte, endStream bool) error {
+	for len(data) > 0 {
+		n, err := c.takeSendWindow(st, len(data))
+		if err != nil {
+			return err
+		}
+
+		c.wmu.Lock()
+		err = c.framer.WriteData(st.id, endStream && n == len(data), data[:n])
+		if err == nil {
+			err = c.bw.Flush()
+		}
+		c.wmu.Unlock()
+
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		if len(data) == 0 {
+			return nil
+		}
+	}
+
+	if !endStream {
+		return nil
+	}
+
+	if c.isStreamClosed(st) {
+		return ErrHTTP2StreamClosed
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.framer.WriteData(st.id, true, nil); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+func (c *_Http2Conn) writeResponse(st *_Http2Stream) error {
+	ctx := st.rctx
+	res := &ctx.Response
+	if res.cw != nil {
+		if err := res.cw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	var body []byte
+	if res.body != nil {
+		body = res.body.Bytes()
+	}
+	res.header.SetContentLength(int64(len(body)))
+
+	noBody := len(body) < 1 || ctx.Request._method == _MHead
+	hasTrailer := res.trailer.Size() > 0
+	if hasTrailer {
+		res.announceTrailer()
+	}
+	if err := c.writeHeaders(st, res, noBody && !hasTrailer); err != nil {
+		return err
+	}
+	if !noBody {
+		if err := c.writeData(st, body, !hasTrailer); err != nil {
+			return err
+		}
+	}
+	if hasTrailer {
+		return c.writeTrailer(st, &res.trailer)
+	}
+	return nil
+}
+
+// sendStream sends the headers on the first call and then the buffered body, it is used by `RequestCtx.StreamWriter`.
+func (st *_Http2Stream) sendStream(last bool) error {
+	res := &st.rctx.Response
+	c := st.c
+
+	if !st.headersSent {
+		res.header.Del(HeaderContentLength)
+		res.announceTrailer()
+		if err := c.writeHeaders(st, res, false); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	if res.body != nil {
+		data = res.body.Bytes()
+	}
+	hasTrailer := last && res.trailer.Size() > 0
+	if len(data) > 0 || (last && !hasTrailer) {
+		if err := c.writeData(st, data, last && !hasTrailer); err != nil {
+			return err
+		}
+		if res.body != nil {
+			res.body.Reset()
+		}
+	}
+	if hasTrailer {
+		return c.writeTrailer(st, &res.trailer)
+	}
+	return nil
+}
+
+func (st *_Http2Stream) writeStream(stream io.Reader) error {
+	ctx := st.rctx
+	res := &ctx.Response
+	c := st.c
+
+	res.header.Del(HeaderContentLength)
+	res.announceTrailer()
+	if err := c.writeHeaders(st, res, false); err != nil {
+		return err
+	}
+
+	buf := ctx.readBuf
+	for {
+		l, e := stream.Read(buf)
+		if l > 0 {
+			data := buf[:l]
+			if res.cw != nil {
+				if _, err := res.cw.Write(data); err != nil {
+					return err
+				}
+				data = nil
+				if res.body != nil {
+					data = res.body.Bytes()
+				}
+			}
+			if err := c.writeData(st, data, false); err != nil {
+				return err
+			}
+			if res.cw != nil && res.body != nil {
+				res.body.Reset()
+			}
+		}
+		if e != nil {
+			if e == io.EOF {
+				break
+			}
+			return e
+		}
+		if l == 0 {
+			break
+		}
+	}
+
+	if res.cw != nil {
+		if err := res.cw.Flush(); err != nil {
+			return err
+		}
+		if res.body != nil && res.body.Len() > 0 {
+			if err := c.writeData(st, res.body.Bytes(), false); err != nil {
+				return err
+			}
+			res.body.Reset()
+		}
+	}
+	if res.trailer.Size() > 0 {
+		return c.writeTrailer(st, &res.trailer)
+	}
+	return c.writeData(st, nil, true)
+}
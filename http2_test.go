@@ -0,0 +1,431 @@
+package sha
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func startHTTP2TestServer(t *testing.T, handler RequestCtxHandler) (string, func()) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := DefaultWithContext(ctx)
+	s.Handler = handler
+	s.SetHTTPProtocol(NewHTTP2Protocol(nil, nil))
+
+	done := make(chan struct{})
+	go func() {
+		s.Serve(l)
+		close(done)
+	}()
+	return l.Addr().String(), func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestHTTP2Protocol_H2C(t *testing.T) {
+	mux := NewMux(&MuxOptions{AutoHandleDocs: false, AutoCompress: false})
+	mux.HTTP(MethodGet, "/hello/{name}", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		name, _ := ctx.Request.URL.Params.Get("name")
+		_ = ctx.WriteString(fmt.Sprintf("Hello %s, %s", name, ctx.Request.HTTPVersion()))
+	}))
+	mux.HTTP(MethodPost, "/echo", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_, _ = ctx.Write(ctx.Request.BodyRaw())
+	}))
+	mux.HTTP(MethodGet, "/stream", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_ = ctx.WriteStream(strings.NewReader(strings.Repeat("sha", 10000)))
+	}))
+
+	addr, stop := startHTTP2TestServer(t, mux)
+	defer stop()
+
+	cli := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			res, err := cli.Get(fmt.Sprintf("http://%s/hello/%d", addr, i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer res.Body.Close()
+			body, _ := ioutil.ReadAll(res.Body)
+			if res.ProtoMajor != 2 || string(body) != fmt.Sprintf("Hello %d, HTTP/2.0", i) {
+				t.Errorf("unexpected response: %s %q", res.Proto, body)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	payload := strings.Repeat("0123456789", 20000)
+	res, err := cli.Post(fmt.Sprintf("http://%s/echo", addr), MIMEText, strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if string(body) != payload {
+		t.Fatalf("bad echo body, length %d", len(body))
+	}
+
+	res, err = cli.Get(fmt.Sprintf("http://%s/stream", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if string(body) != strings.Repeat("sha", 10000) {
+		t.Fatalf("bad stream body, length %d", len(body))
+	}
+
+	res, err = cli.Get(fmt.Sprintf("http://%s/missing", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != StatusNotFound {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+}
+
+func TestHTTP2Protocol_HTTP11Fallback(t *testing.T) {
+	addr, stop := startHTTP2TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_, _ = ctx.Write(ctx.Request.HTTPVersion())
+	}))
+	defer stop()
+
+	res, err := http.Get(fmt.Sprintf("http://%s/", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if string(body) != HTTPVersion11 {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestHTTP2Protocol_UpgradeH2C(t *testing.T) {
+	addr, stop := startHTTP2TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_, _ = ctx.Write(ctx.Request.HTTPVersion())
+	}))
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: sha.local\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAARAAAAAAAIAAAAA\r\n\r\n"))
+	buf := make([]byte, len(h2cSwitchingResponse))
+	if _, err = io.ReadFull(conn, buf); err != nil || string(buf) != h2cSwitchingResponse {
+		t.Fatalf("bad upgrade response %q %v", buf, err)
+	}
+	_, _ = conn.Write([]byte(http2.ClientPreface))
+
+	framer := http2.NewFramer(conn, conn)
+	_ = framer.WriteSettings()
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if df, ok := f.(*http2.DataFrame); ok && df.StreamID == 1 {
+			if string(df.Data()) != HTTPVersion20 {
+				t.Fatalf("unexpected body %q", df.Data())
+			}
+			return
+		}
+	}
+}
+
+func TestHTTP2Protocol_Trailer(t *testing.T) {
+	addr, stop := startHTTP2TestServer(t, trailerTestHandler)
+	defer stop()
+
+	checkTrailerTestResponse(t, &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}, "http://"+addr)
+}
+
+func TestHTTP2Protocol_ResetStream(t *testing.T) {
+	var seq int32
+	addr, stop := startHTTP2TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		if atomic.AddInt32(&seq, 1)%2 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		_ = ctx.WriteString("sha")
+	}))
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte(http2.ClientPreface))
+
+	framer := http2.NewFramer(conn, conn)
+	_ = framer.WriteSettings()
+
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	writeRequest := func(id uint32) error {
+		block.Reset()
+		_ = enc.WriteField(hpack.HeaderField{Name: ":method", Value: MethodGet})
+		_ = enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "http"})
+		_ = enc.WriteField(hpack.HeaderField{Name: ":authority", Value: addr})
+		_ = enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})
+		return framer.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      id,
+			BlockFragment: block.Bytes(),
+			EndStream:     true,
+			EndHeaders:    true,
+		})
+	}
+
+	// the reset frames race with the handlers finishing the streams.
+	const count = 500
+	for i := uint32(0); i < count; i++ {
+		id := i*2 + 1
+		if err := writeRequest(id); err != nil {
+			t.Fatal(err)
+		}
+		if i%10 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if err := framer.WriteRSTStream(id, http2.ErrCodeCancel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last := uint32(count*2 + 1)
+	if err := writeRequest(last); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch v := f.(type) {
+		case *http2.GoAwayFrame:
+			t.Fatalf("unexpected go away %v", v.ErrCode)
+		case *http2.DataFrame:
+			if v.StreamID == last {
+				if string(v.Data()) != "sha" {
+					t.Fatalf("unexpected body %q", v.Data())
+				}
+				return
+			}
+		}
+	}
+}
+
+func TestHTTP2Protocol_ContinuationFlood(t *testing.T) {
+	addr, stop := startHTTP2TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {}))
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte(http2.ClientPreface))
+	framer := http2.NewFramer(conn, conn)
+	_ = framer.WriteSettings()
+
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	_ = enc.WriteField(hpack.HeaderField{Name: ":method", Value: MethodGet})
+	_ = enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})
+	_ = framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: block.Bytes(), EndStream: true})
+
+	// the header block never ends, the connection must be closed instead of decoding it forever
+	go func() {
+		block.Reset()
+		_ = enc.WriteField(hpack.HeaderField{Name: "x-flood", Value: strings.Repeat("a", 1024)})
+		for i := 0; i < 100000; i++ {
+			if framer.WriteContinuation(1, false, block.Bytes()) != nil {
+				return
+			}
+		}
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.Copy(ioutil.Discard, conn)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("the connection is not closed")
+	}
+}
+
+func TestHTTP2Protocol_ShutdownWhileOpening(t *testing.T) {
+	addr, stop := startHTTP2TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {}))
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte(http2.ClientPreface))
+	framer := http2.NewFramer(conn, conn)
+	_ = framer.WriteSettings()
+	go func() { _, _ = io.Copy(ioutil.Discard, conn) }()
+
+	// the go away frame is written by the shutdown goroutine while the read loop is opening the streams
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var block bytes.Buffer
+		enc := hpack.NewEncoder(&block)
+		for id := uint32(1); id < 1<<20; id += 2 {
+			block.Reset()
+			_ = enc.WriteField(hpack.HeaderField{Name: ":method", Value: MethodGet})
+			_ = enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "http"})
+			_ = enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})
+			err := framer.WriteHeaders(http2.HeadersFrameParam{
+				StreamID: id, BlockFragment: block.Bytes(), EndStream: true, EndHeaders: true,
+			})
+			if err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(time.Millisecond * 50)
+	stop()
+	_ = conn.Close()
+	<-done
+}
+
+func dialHTTP2TestServer(t *testing.T, addr string, path string, endStream bool) (net.Conn, *http2.Framer) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte(http2.ClientPreface))
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	_ = framer.WriteSettings()
+
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	_ = enc.WriteField(hpack.HeaderField{Name: ":method", Value: MethodPost})
+	_ = enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "http"})
+	_ = enc.WriteField(hpack.HeaderField{Name: ":path", Value: path})
+	err = framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID: 1, BlockFragment: block.Bytes(), EndStream: endStream, EndHeaders: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, framer
+}
+
+func readHTTP2GoAway(t *testing.T, conn net.Conn, framer *http2.Framer) http2.ErrCode {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := f.(*http2.GoAwayFrame); ok {
+			return v.ErrCode
+		}
+	}
+}
+
+func TestHTTP2Protocol_ReadTimeout(t *testing.T) {
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {}), func(s *Server) {
+		s.Options.ReadTimeout.Duration = time.Millisecond * 200
+		s.SetHTTPProtocol(NewHTTP2Protocol(nil, nil))
+	})
+	defer stop()
+
+	conn, framer := dialHTTP2TestServer(t, addr, "/", false)
+	defer conn.Close()
+
+	// the request body never ends, pings must not keep the stream open
+	go func() {
+		for i := 0; i < 100; i++ {
+			if framer.WritePing(false, [8]byte{}) != nil {
+				return
+			}
+			time.Sleep(time.Millisecond * 20)
+		}
+	}()
+
+	begin := time.Now()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := io.Copy(ioutil.Discard, conn)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("the connection is not closed")
+	}
+	if time.Since(begin) > time.Second {
+		t.Fatalf("the connection is closed after %s", time.Since(begin))
+	}
+}
+
+func TestHTTP2Protocol_InitialWindowSizeOverflow(t *testing.T) {
+	addr, stop := startHTTP2TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {}))
+	defer stop()
+
+	conn, framer := dialHTTP2TestServer(t, addr, "/", false)
+	defer conn.Close()
+
+	_ = framer.WriteWindowUpdate(1, http2MaxWindow-http2DefaultWindow)
+	_ = framer.WriteSettings(http2.Setting{ID: http2.SettingInitialWindowSize, Val: http2DefaultWindow + 1})
+	if code := readHTTP2GoAway(t, conn, framer); code != http2.ErrCodeFlowControl {
+		t.Fatalf("unexpected go away %v", code)
+	}
+}
+
+func TestHTTP2Protocol_RecvWindow(t *testing.T) {
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {}), func(s *Server) {
+		s.SetHTTPProtocol(NewHTTP2Protocol(nil, &HTTP2Options{InitialWindowSize: http2DefaultWindow}))
+	})
+	defer stop()
+
+	conn, framer := dialHTTP2TestServer(t, addr, "/", false)
+	defer conn.Close()
+
+	_ = framer.WriteData(1, true, make([]byte, http2DefaultWindow+1))
+	if code := readHTTP2GoAway(t, conn, framer); code != http2.ErrCodeFlowControl {
+		t.Fatalf("unexpected go away %v", code)
+	}
+}
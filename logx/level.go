@@ -0,0 +1,60 @@
+package logx
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var ErrBadLevel = errors.New("sha.logx: bad level")
+
+// ParseLevel parses the names of the levels case-insensitively, such as `debug` and `WARN`, or the integers.
+func ParseLevel(v string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(v)) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return 0, ErrBadLevel
+	}
+	return Level(n), nil
+}
+
+// LevelVar is a level which can be changed at runtime, the zero value is `LevelInfo`.
+type LevelVar struct{ v int64 }
+
+func (lv *LevelVar) Level() Level { return Level(atomic.LoadInt64(&lv.v)) }
+
+func (lv *LevelVar) Set(l Level) { atomic.StoreInt64(&lv.v, int64(l)) }
+
+func (lv *LevelVar) String() string { return lv.Level().String() }
+
+// DefaultLevel is the min level of the default logger, see `SetDefault`.
+var DefaultLevel = &LevelVar{}
+
+// Filter drops the records below the current level of min.
+func Filter(l Logger, min *LevelVar) Logger {
+	return Func(func(level Level, msg string, kvs ...interface{}) {
+		if level < min.Level() {
+			return
+		}
+		switch {
+		case level < LevelInfo:
+			l.Debug(msg, kvs...)
+		case level < LevelWarn:
+			l.Info(msg, kvs...)
+		case level < LevelError:
+			l.Warn(msg, kvs...)
+		default:
+			l.Error(msg, kvs...)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+// Package logx defines the leveled logger with key/value fields used by sha and its sub packages.
+package logx
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int
+
+// the values are the same as `slog.Level`
+const (
+	LevelDebug = Level(-4)
+	LevelInfo  = Level(0)
+	LevelWarn  = Level(4)
+	LevelError = Level(8)
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// Logger is a leveled logger, the `kvs` are alternating keys and values, such as `"pid", 12`.
+// the method set is the same as `*slog.Logger`, so it can be used directly.
+type Logger interface {
+	Debug(msg string, kvs ...interface{})
+	Info(msg string, kvs ...interface{})
+	Warn(msg string, kvs ...interface{})
+	Error(msg string, kvs ...interface{})
+}
+
+// Func adapts a function to the `Logger`.
+type Func func(level Level, msg string, kvs ...interface{})
+
+func (fn Func) Debug(msg string, kvs ...interface{}) { fn(LevelDebug, msg, kvs...) }
+
+func (fn Func) Info(msg string, kvs ...interface{}) { fn(LevelInfo, msg, kvs...) }
+
+func (fn Func) Warn(msg string, kvs ...interface{}) { fn(LevelWarn, msg, kvs...) }
+
+func (fn Func) Error(msg string, kvs ...interface{}) { fn(LevelError, msg, kvs...) }
+
+// Std writes the records to the standard logger as `LEVEL msg key=value ...`, the records below `min` are dropped.
+// nil `l` means the default logger of the `log` package.
+func Std(l *log.Logger, min Level) Logger {
+	return Func(func(level Level, msg string, kvs ...interface{}) {
+		if level < min {
+			return
+		}
+		line := Format(level, msg, kvs...)
+		if l == nil {
+			log.Print(line)
+			return
+		}
+		l.Print(line)
+	})
+}
+
+// Format formats the record as `LEVEL msg key=value ...`, the values containing spaces are quoted.
+func Format(level Level, msg string, kvs ...interface{}) string {
+	var buf strings.Builder
+	buf.WriteString(level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	for i := 0; i < len(kvs); i += 2 {
+		buf.WriteByte(' ')
+		if i+1 >= len(kvs) {
+			buf.WriteString("!BADKEY=")
+			writeValue(&buf, kvs[i])
+			break
+		}
+		buf.WriteString(fmt.Sprint(kvs[i]))
+		buf.WriteByte('=')
+		writeValue(&buf, kvs[i+1])
+	}
+	return buf.String()
+}
+
+func writeValue(buf *strings.Builder, v interface{}) {
+	s := fmt.Sprint(v)
+	if len(s) < 1 || strings.ContainsAny(s, " \t\r\n\"=") {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
+
+// ZapSugared is the method set of `*zap.SugaredLogger` used by the adapter.
+type ZapSugared interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// Zap adapts the zap-like sugared logger, such as `zap.S()`.
+func Zap(l ZapSugared) Logger {
+	return Func(func(level Level, msg string, kvs ...interface{}) {
+		switch {
+		case level < LevelInfo:
+			l.Debugw(msg, kvs...)
+		case level < LevelWarn:
+			l.Infow(msg, kvs...)
+		case level < LevelError:
+			l.Warnw(msg, kvs...)
+		default:
+			l.Errorw(msg, kvs...)
+		}
+	})
+}
+
+// Discard drops all records.
+var Discard Logger = Func(func(Level, string, ...interface{}) {})
+
+type _Holder struct{ Logger }
+
+var defaultLogger atomic.Value
+
+func stdDefault() Logger { return Filter(Std(nil, LevelDebug), DefaultLevel) }
+
+func init() { defaultLogger.Store(_Holder{stdDefault()}) }
+
+// Default returns the logger used by the components without their own loggers, see `SetDefault`.
+func Default() Logger { return defaultLogger.Load().(_Holder).Logger }
+
+// SetDefault replaces the default logger, nil means the standard logger filtered by `DefaultLevel`.
+func SetDefault(l Logger) {
+	if l == nil {
+		l = stdDefault()
+	}
+	defaultLogger.Store(_Holder{l})
+}
+
+// Or returns l if it is not nil, otherwise the default logger.
+func Or(l Logger) Logger {
+	if l != nil {
+		return l
+	}
+	return Default()
+}
@@ -0,0 +1,103 @@
+package logx
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"testing"
+)
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	l := Std(log.New(&buf, "", 0), LevelInfo)
+	l.Debug("dropped")
+	l.Info("sha.server: listening", "addr", "127.0.0.1:80", "pid", 12)
+	l.Error("sha.server: error", "err", fmt.Errorf("a b"), "odd")
+	expected := "INFO sha.server: listening addr=127.0.0.1:80 pid=12\n" +
+		"ERROR sha.server: error err=\"a b\" !BADKEY=odd\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
+
+type _ZapRecorder struct{ records []string }
+
+func (z *_ZapRecorder) record(level, msg string, kvs []interface{}) {
+	z.records = append(z.records, fmt.Sprint(level, msg, kvs))
+}
+
+func (z *_ZapRecorder) Debugw(msg string, kvs ...interface{}) { z.record("debug", msg, kvs) }
+func (z *_ZapRecorder) Infow(msg string, kvs ...interface{})  { z.record("info", msg, kvs) }
+func (z *_ZapRecorder) Warnw(msg string, kvs ...interface{})  { z.record("warn", msg, kvs) }
+func (z *_ZapRecorder) Errorw(msg string, kvs ...interface{}) { z.record("error", msg, kvs) }
+
+func TestZap(t *testing.T) {
+	z := &_ZapRecorder{}
+	l := Zap(z)
+	l.Debug("a", "k", 1)
+	l.Warn("b")
+	l.Error("c", "k", 2)
+	if fmt.Sprint(z.records) != "[debuga[k 1] warnb[] errorc[k 2]]" {
+		t.Fatalf("unexpected records %v", z.records)
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	defer SetDefault(nil)
+	SetDefault(Discard)
+	if Or(nil) == nil || Or(Discard) == nil {
+		t.Fatal("nil logger")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var buf bytes.Buffer
+	lv := &LevelVar{}
+	l := Filter(Std(log.New(&buf, "", 0), LevelDebug), lv)
+	l.Debug("dropped")
+	l.Info("a")
+	level, err := ParseLevel("debug")
+	if err != nil || level != LevelDebug {
+		t.Fatal(level, err)
+	}
+	lv.Set(level)
+	l.Debug("b")
+	if _, err = ParseLevel("verbose"); err != ErrBadLevel {
+		t.Fatal(err)
+	}
+	if buf.String() != "INFO a\nDEBUG b\n" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
+
+func TestLevels(t *testing.T) {
+	lv := &LevelVar{}
+	lv.Set(Level(-10))
+	z := &_ZapRecorder{}
+	filter := Filter(Zap(z), lv).(Func)
+	zap := Zap(z).(Func)
+
+	// the intermediate levels belong to the nearest lower level, same as `slog`
+	for _, c := range []struct {
+		level    Level
+		expected string
+	}{
+		{Level(-8), "debug"},
+		{LevelDebug, "debug"},
+		{Level(-2), "debug"},
+		{LevelInfo, "info"},
+		{Level(2), "info"},
+		{LevelWarn, "warn"},
+		{Level(6), "warn"},
+		{LevelError, "error"},
+		{Level(12), "error"},
+	} {
+		for _, fn := range []Func{filter, zap} {
+			z.records = z.records[:0]
+			fn(c.level, "")
+			if len(z.records) != 1 || z.records[0] != c.expected+"[]" {
+				t.Fatalf("%s: unexpected records %v", c.level, z.records)
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build go1.21
+// +build go1.21
+
+package logx
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// Slog adapts the `slog.Handler`, the source of the record is the caller of the `Logger` method.
+// `*slog.Logger` implements `Logger` directly.
+func Slog(h slog.Handler) Logger {
+	return Func(func(level Level, msg string, kvs ...interface{}) {
+		ctx := context.Background()
+		if !h.Enabled(ctx, slog.Level(level)) {
+			return
+		}
+		var pcs [1]uintptr
+		runtime.Callers(3, pcs[:]) // skip runtime.Callers, this function and the method of `Func`
+		r := slog.NewRecord(time.Now(), slog.Level(level), msg, pcs[0])
+		r.Add(kvs...)
+		_ = h.Handle(ctx, r)
+	})
+}
@@ -0,0 +1,29 @@
+//go:build go1.21
+// +build go1.21
+
+package logx
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{AddSource: true, Level: slog.LevelInfo})
+
+	var l Logger = slog.New(handler)
+	l.Info("direct", "k", 1)
+	l = Slog(handler)
+	l.Debug("dropped")
+	l.Warn("adapted", "k", 2)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"direct","k":1`) ||
+		!strings.Contains(lines[1], `"level":"WARN"`) || !strings.Contains(lines[1], `"msg":"adapted","k":2`) ||
+		!strings.Contains(lines[1], "slog_test.go") {
+		t.Fatalf("unexpected output %q", lines)
+	}
+}
@@ -0,0 +1,187 @@
+package sha
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zzztttkkk/sha/metrics"
+)
+
+// Metrics collects the requests of the mux, see `MuxOptions.Metrics`, and the counters of the watched servers and
+// clients. the collectors are named `sha_http_*`, `sha_server_*` and `sha_cli_*`.
+type Metrics struct {
+	registry *metrics.Registry
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+
+	mutex   sync.RWMutex
+	servers map[string]*Server
+	clis    map[string]*Cli
+}
+
+// NewMetrics registers the collectors to reg, nil reg means `metrics.Default`, nil buckets means `metrics.DefBuckets`.
+// it panics if the collectors are already registered.
+func NewMetrics(reg *metrics.Registry, buckets []float64) *Metrics {
+	if reg == nil {
+		reg = metrics.Default
+	}
+	m := &Metrics{
+		registry: reg,
+		requests: metrics.NewCounterVec(
+			"sha_http_requests_total", "The count of the handled requests.",
+			"method", "route", "status",
+		),
+		duration: metrics.NewHistogramVec(
+			"sha_http_request_duration_seconds", "The latency of the handlers.",
+			buckets, "method", "route",
+		),
+		servers: map[string]*Server{},
+		clis:    map[string]*Cli{},
+	}
+
+	serverValue := func(typ metrics.Type, name, help string, fn func(stats *ServerStats) int64) metrics.Collector {
+		return metrics.NewFunc(typ, name, help, []string{"server"}, func(w *metrics.Writer) {
+			m.mutex.RLock()
+			defer m.mutex.RUnlock()
+			for _, k := range sortedNames(m.servers) {
+				stats := m.servers[k].Stats()
+				w.Value(float64(fn(&stats)), k)
+			}
+		})
+	}
+
+	reg.MustRegister(
+		m.requests,
+		m.duration,
+		serverValue(
+			metrics.TypeGauge, "sha_server_alive_connections", "The connections being served.",
+			func(stats *ServerStats) int64 { return stats.AliveConnections },
+		),
+		serverValue(
+			metrics.TypeGauge, "sha_server_in_flight_requests", "The requests being handled.",
+			func(stats *ServerStats) int64 { return stats.InFlightRequests },
+		),
+		serverValue(
+			metrics.TypeCounter, "sha_server_accepted_connections_total", "The count of the accepted connections.",
+			func(stats *ServerStats) int64 { return stats.AcceptedConnections },
+		),
+		serverValue(
+			metrics.TypeCounter, "sha_server_rejected_connections_total", "The count of the connections rejected by the limits.",
+			func(stats *ServerStats) int64 { return stats.RejectedConnections },
+		),
+		serverValue(
+			metrics.TypeCounter, "sha_server_rejected_requests_total", "The count of the requests rejected by the limits.",
+			func(stats *ServerStats) int64 { return stats.RejectedRequests },
+		),
+		serverValue(
+			metrics.TypeCounter, "sha_server_parse_errors_total", "The count of the malformed requests.",
+			func(stats *ServerStats) int64 { return stats.ParseErrors },
+		),
+		metrics.NewFunc(
+			metrics.TypeGauge, "sha_cli_connections_in_use", "The connections being used by the clients.",
+			[]string{"cli"},
+			func(w *metrics.Writer) {
+				m.eachCli(func(name string, stats *CliStats) { w.Value(float64(stats.InUse), name) })
+			},
+		),
+		metrics.NewFunc(
+			metrics.TypeGauge, "sha_cli_idle_connections", "The idle connections of the clients by the hosts.",
+			[]string{"cli", "host", "tls"},
+			func(w *metrics.Writer) {
+				m.eachCli(func(name string, stats *CliStats) {
+					for _, key := range sortedNames(stats.Idle) {
+						ind := strings.LastIndexByte(key, ':')
+						w.Value(float64(stats.Idle[key]), name, key[:ind], key[ind+1:])
+					}
+				})
+			},
+		),
+	)
+	return m
+}
+
+// sortedNames returns the sorted keys of the map, the values are `*Server`, `*Cli` or `int`.
+func sortedNames(v interface{}) []string {
+	var names []string
+	switch m := v.(type) {
+	case map[string]*Server:
+		for k := range m {
+			names = append(names, k)
+		}
+	case map[string]*Cli:
+		for k := range m {
+			names = append(names, k)
+		}
+	case map[string]*Mux:
+		for k := range m {
+			names = append(names, k)
+		}
+	case map[string]int:
+		for k := range m {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *Metrics) eachCli(fn func(name string, stats *CliStats)) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, name := range sortedNames(m.clis) {
+		stats := m.clis[name].Stats()
+		fn(name, &stats)
+	}
+}
+
+// Registry returns the registry of the collectors.
+func (m *Metrics) Registry() *metrics.Registry { return m.registry }
+
+// WatchServer exposes the counters of the server with the label `server="<name>"`, see `Server.Stats`.
+func (m *Metrics) WatchServer(name string, s *Server) {
+	m.mutex.Lock()
+	m.servers[name] = s
+	m.mutex.Unlock()
+}
+
+// WatchCli exposes the usage of the connection pool of the client with the label `cli="<name>"`, see `Cli.Stats`.
+func (m *Metrics) WatchCli(name string, cli *Cli) {
+	m.mutex.Lock()
+	m.clis[name] = cli
+	m.mutex.Unlock()
+}
+
+// observe records the request handled by the mux, the unmatched requests are labeled as `route=""`.
+func (m *Metrics) observe(ctx *RequestCtx, begin time.Time) {
+	route := ctx.RoutePattern()
+	method := "OTHER" // the custom methods of the unmatched requests are unbounded
+	if len(route) > 0 || !ctx.IsCustomMethod() {
+		method = string(ctx.Request.Method())
+	}
+	sc := ctx.Response.statusCode
+	if sc == 0 {
+		sc = StatusOK
+	}
+	m.requests.With(method, route, strconv.Itoa(sc)).Inc()
+	m.duration.With(method, route).Observe(time.Since(begin).Seconds())
+}
+
+// Handler returns the handler which writes the metrics of the registry in the Prometheus text format.
+func (m *Metrics) Handler() RequestCtxHandler { return MetricsHandler(m.registry) }
+
+// MetricsHandler returns the handler which writes the metrics of reg in the Prometheus text format, nil reg means
+// `metrics.Default`.
+func MetricsHandler(reg *metrics.Registry) RequestCtxHandler {
+	if reg == nil {
+		reg = metrics.Default
+	}
+	return RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		ctx.Response.Header().SetContentType(metrics.ContentType)
+		if err := reg.WriteText(ctx); err != nil {
+			ctx.SetError(err)
+		}
+	})
+}
@@ -0,0 +1,261 @@
+// Package metrics implements the counters, gauges and histograms, and exposes them in the Prometheus text format
+// without any external dependency.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Type string
+
+const (
+	TypeCounter   = Type("counter")
+	TypeGauge     = Type("gauge")
+	TypeHistogram = Type("histogram")
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type Desc struct {
+	Name   string
+	Help   string
+	Type   Type
+	Labels []string
+}
+
+type Collector interface {
+	Desc() *Desc
+	// Collect writes the series, the label values must be in the same order as `Desc.Labels`
+	Collect(w *Writer)
+}
+
+var (
+	ErrDuplicated = errors.New("sha.metrics: duplicated metric name")
+	ErrBadName    = errors.New("sha.metrics: bad metric or label name")
+)
+
+func validName(name string, isLabel bool) bool {
+	if len(name) < 1 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				return false
+			}
+		case c == ':':
+			if isLabel {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return !isLabel || !strings.HasPrefix(name, "__")
+}
+
+func (d *Desc) validate() error {
+	if !validName(d.Name, false) {
+		return ErrBadName
+	}
+	for _, l := range d.Labels {
+		if !validName(l, true) || (d.Type == TypeHistogram && l == "le") {
+			return ErrBadName
+		}
+	}
+	return nil
+}
+
+type Registry struct {
+	mutex      sync.RWMutex
+	collectors map[string]Collector
+}
+
+func NewRegistry() *Registry { return &Registry{collectors: map[string]Collector{}} }
+
+// Default is the registry of the collectors of sha, see `Metrics` of sha, `groupcache.RegisterMetrics` and
+// `pipeline.RegisterMetrics`.
+var Default = NewRegistry()
+
+func (r *Registry) Register(c Collector) error {
+	desc := c.Desc()
+	if err := desc.validate(); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.collectors[desc.Name]; ok {
+		return ErrDuplicated
+	}
+	r.collectors[desc.Name] = c
+	return nil
+}
+
+// MustRegister registers the collectors, it panics if any name is bad or duplicated.
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(fmt.Errorf("%w, `%s`", err, c.Desc().Name))
+		}
+	}
+}
+
+func (r *Registry) Unregister(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.collectors[name]
+	delete(r.collectors, name)
+	return ok
+}
+
+// WriteText writes all the metrics in the Prometheus text format, sorted by the names.
+func (r *Registry) WriteText(dist io.Writer) error {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	cs := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		cs = append(cs, r.collectors[name])
+	}
+	r.mutex.RUnlock()
+
+	var w Writer
+	for _, c := range cs {
+		w.begin(c.Desc())
+		c.Collect(&w)
+	}
+	_, err := dist.Write(w.buf)
+	return err
+}
+
+// Writer writes the series of a collector.
+type Writer struct {
+	buf  []byte
+	desc *Desc
+}
+
+func (w *Writer) begin(desc *Desc) {
+	w.desc = desc
+	if len(desc.Help) > 0 {
+		w.buf = append(w.buf, "# HELP "...)
+		w.buf = append(w.buf, desc.Name...)
+		w.buf = append(w.buf, ' ')
+		w.buf = appendEscaped(w.buf, desc.Help, false)
+		w.buf = append(w.buf, '\n')
+	}
+	w.buf = append(w.buf, "# TYPE "...)
+	w.buf = append(w.buf, desc.Name...)
+	w.buf = append(w.buf, ' ')
+	w.buf = append(w.buf, desc.Type...)
+	w.buf = append(w.buf, '\n')
+}
+
+func (w *Writer) series(suffix string, labelValues []string, extraName, extraValue string, v float64) {
+	w.buf = append(w.buf, w.desc.Name...)
+	w.buf = append(w.buf, suffix...)
+	n := 0
+	label := func(name, value string) {
+		if n == 0 {
+			w.buf = append(w.buf, '{')
+		} else {
+			w.buf = append(w.buf, ',')
+		}
+		n++
+		w.buf = append(w.buf, name...)
+		w.buf = append(w.buf, '=', '"')
+		w.buf = appendEscaped(w.buf, value, true)
+		w.buf = append(w.buf, '"')
+	}
+	for i, name := range w.desc.Labels {
+		if i < len(labelValues) {
+			label(name, labelValues[i])
+		} else {
+			label(name, "")
+		}
+	}
+	if len(extraName) > 0 {
+		label(extraName, extraValue)
+	}
+	if n > 0 {
+		w.buf = append(w.buf, '}')
+	}
+	w.buf = append(w.buf, ' ')
+	w.buf = appendFloat(w.buf, v)
+	w.buf = append(w.buf, '\n')
+}
+
+// Value writes a series of the counter or the gauge.
+func (w *Writer) Value(v float64, labelValues ...string) { w.series("", labelValues, "", "", v) }
+
+// Histogram writes a series of the histogram, the counts are not cumulative, the last one is the count of `+Inf`.
+func (w *Writer) Histogram(upperBounds []float64, counts []uint64, sum float64, labelValues ...string) {
+	var total uint64
+	for i, c := range counts {
+		total += c
+		le := math.Inf(1)
+		if i < len(upperBounds) {
+			le = upperBounds[i]
+		}
+		w.series("_bucket", labelValues, "le", string(appendFloat(nil, le)), float64(total))
+	}
+	w.series("_sum", labelValues, "", "", sum)
+	w.series("_count", labelValues, "", "", float64(total))
+}
+
+func appendFloat(buf []byte, v float64) []byte {
+	switch {
+	case math.IsInf(v, 1):
+		return append(buf, "+Inf"...)
+	case math.IsInf(v, -1):
+		return append(buf, "-Inf"...)
+	case math.IsNaN(v):
+		return append(buf, "NaN"...)
+	default:
+		return strconv.AppendFloat(buf, v, 'g', -1, 64)
+	}
+}
+
+// appendEscaped escapes the backslashes and the line breaks, and the double quotes of the label values.
+func appendEscaped(buf []byte, v string, quote bool) []byte {
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '\\':
+			buf = append(buf, '\\', '\\')
+		case c == '\n':
+			buf = append(buf, '\\', 'n')
+		case c == '"' && quote:
+			buf = append(buf, '\\', '"')
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+type _Func struct {
+	desc Desc
+	fn   func(w *Writer)
+}
+
+func (f *_Func) Desc() *Desc { return &f.desc }
+
+func (f *_Func) Collect(w *Writer) { f.fn(w) }
+
+// NewFunc returns a collector which calls fn at collecting, such as reading the sizes of the pools.
+func NewFunc(typ Type, name, help string, labels []string, fn func(w *Writer)) Collector {
+	return &_Func{desc: Desc{Name: name, Help: help, Type: typ, Labels: labels}, fn: fn}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	reg := NewRegistry()
+	counter := NewCounterVec("test_requests_total", "The requests.\nSecond line.", "path")
+	gauge := NewGaugeVec("test_temperature", "")
+	histogram := NewHistogramVec("test_latency_seconds", "The latency.", []float64{1, 0.1, math.Inf(1)}, "op")
+	reg.MustRegister(counter, gauge, histogram, NewFunc(TypeGauge, "test_func", "", []string{"k"}, func(w *Writer) {
+		w.Value(math.Inf(-1), `a"b\`)
+	}))
+	if reg.Register(NewGaugeVec("test_temperature", "")) != ErrDuplicated {
+		t.Fatal("expected duplicated error")
+	}
+
+	counter.With("/a").Inc()
+	counter.With("/a").Add(2)
+	counter.With("/a").Add(-1)
+	counter.With("/b\n").Inc()
+	gauge.With().Set(1.5)
+	gauge.With().Dec()
+	histogram.With("get").Observe(0.05)
+	histogram.With("get").Observe(0.1)
+	histogram.With("get").Observe(3)
+
+	var buf bytes.Buffer
+	if err := reg.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# TYPE test_func gauge
+test_func{k="a\"b\\"} -Inf
+# HELP test_latency_seconds The latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{op="get",le="0.1"} 2
+test_latency_seconds_bucket{op="get",le="1"} 2
+test_latency_seconds_bucket{op="get",le="+Inf"} 3
+test_latency_seconds_sum{op="get"} 3.15
+test_latency_seconds_count{op="get"} 3
+# HELP test_requests_total The requests.\nSecond line.
+# TYPE test_requests_total counter
+test_requests_total{path="/a"} 3
+test_requests_total{path="/b\n"} 1
+# TYPE test_temperature gauge
+test_temperature 0.5
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected output\n%s", buf.String())
+	}
+}
+
+func TestBadNames(t *testing.T) {
+	for _, fn := range []func(){
+		func() { NewCounterVec("0bad", "") },
+		func() { NewCounterVec("ok", "", "bad-label") },
+		func() { NewHistogramVec("ok", "", nil, "le") },
+		func() { NewCounterVec("ok", "", "a").With() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected panic")
+				}
+			}()
+			fn()
+		}()
+	}
+}
@@ -0,0 +1,221 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets is the default buckets of the histograms, in seconds, the same as the Prometheus client.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var ErrLabelCount = errors.New("sha.metrics: label values do not match the label names")
+
+func addFloat(bits *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		if atomic.CompareAndSwapUint64(bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+type Counter struct{ bits uint64 }
+
+// Add increases the counter, the negative values are ignored.
+func (c *Counter) Add(v float64) {
+	if v > 0 {
+		addFloat(&c.bits, v)
+	}
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+func (c *Counter) Value() float64 { return math.Float64frombits(atomic.LoadUint64(&c.bits)) }
+
+type Gauge struct{ bits uint64 }
+
+func (g *Gauge) Set(v float64) { atomic.StoreUint64(&g.bits, math.Float64bits(v)) }
+
+func (g *Gauge) Add(v float64) { addFloat(&g.bits, v) }
+
+func (g *Gauge) Inc() { g.Add(1) }
+
+func (g *Gauge) Dec() { g.Add(-1) }
+
+func (g *Gauge) Value() float64 { return math.Float64frombits(atomic.LoadUint64(&g.bits)) }
+
+type Histogram struct {
+	upperBounds []float64
+	counts      []uint64 // the last one is `+Inf`
+	sumBits     uint64
+}
+
+func newHistogram(upperBounds []float64) *Histogram {
+	return &Histogram{upperBounds: upperBounds, counts: make([]uint64, len(upperBounds)+1)}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	addFloat(&h.sumBits, v)
+}
+
+// Count returns the count of the observations.
+func (h *Histogram) Count() uint64 {
+	var n uint64
+	for i := range h.counts {
+		n += atomic.LoadUint64(&h.counts[i])
+	}
+	return n
+}
+
+func (h *Histogram) Sum() float64 { return math.Float64frombits(atomic.LoadUint64(&h.sumBits)) }
+
+func (h *Histogram) collect(w *Writer, labelValues []string) {
+	counts := make([]uint64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	w.Histogram(h.upperBounds, counts, h.Sum(), labelValues...)
+}
+
+type _Child struct {
+	values []string
+	metric interface{}
+}
+
+// _Vec is the labeled metrics, the children are created by the label values on demand.
+type _Vec struct {
+	desc     Desc
+	mutex    sync.RWMutex
+	children map[string]*_Child
+	new      func() interface{}
+}
+
+func (v *_Vec) init(typ Type, name, help string, labels []string, fn func() interface{}) {
+	v.desc = Desc{Name: name, Help: help, Type: typ, Labels: labels}
+	if err := v.desc.validate(); err != nil {
+		panic(err)
+	}
+	v.children = map[string]*_Child{}
+	v.new = fn
+}
+
+func (v *_Vec) Desc() *Desc { return &v.desc }
+
+func (v *_Vec) with(values []string) interface{} {
+	if len(values) != len(v.desc.Labels) {
+		panic(ErrLabelCount)
+	}
+	key := strings.Join(values, "\xff")
+	v.mutex.RLock()
+	c := v.children[key]
+	v.mutex.RUnlock()
+	if c != nil {
+		return c.metric
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if c = v.children[key]; c == nil {
+		c = &_Child{values: append([]string(nil), values...), metric: v.new()}
+		v.children[key] = c
+	}
+	return c.metric
+}
+
+// Delete removes the child of the label values.
+func (v *_Vec) Delete(values ...string) bool {
+	key := strings.Join(values, "\xff")
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	_, ok := v.children[key]
+	delete(v.children, key)
+	return ok
+}
+
+// Reset removes all the children.
+func (v *_Vec) Reset() {
+	v.mutex.Lock()
+	v.children = map[string]*_Child{}
+	v.mutex.Unlock()
+}
+
+func (v *_Vec) sorted() []*_Child {
+	v.mutex.RLock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	children := make([]*_Child, 0, len(keys))
+	for _, k := range keys {
+		children = append(children, v.children[k])
+	}
+	v.mutex.RUnlock()
+	return children
+}
+
+type CounterVec struct{ _Vec }
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{}
+	v.init(TypeCounter, name, help, labels, func() interface{} { return &Counter{} })
+	return v
+}
+
+// With returns the counter of the label values, it panics if the count of the values is wrong.
+func (v *CounterVec) With(values ...string) *Counter { return v.with(values).(*Counter) }
+
+func (v *CounterVec) Collect(w *Writer) {
+	for _, c := range v.sorted() {
+		w.Value(c.metric.(*Counter).Value(), c.values...)
+	}
+}
+
+type GaugeVec struct{ _Vec }
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{}
+	v.init(TypeGauge, name, help, labels, func() interface{} { return &Gauge{} })
+	return v
+}
+
+// With returns the gauge of the label values, it panics if the count of the values is wrong.
+func (v *GaugeVec) With(values ...string) *Gauge { return v.with(values).(*Gauge) }
+
+func (v *GaugeVec) Collect(w *Writer) {
+	for _, c := range v.sorted() {
+		w.Value(c.metric.(*Gauge).Value(), c.values...)
+	}
+}
+
+type HistogramVec struct{ _Vec }
+
+// NewHistogramVec returns the histograms, nil buckets means `DefBuckets`.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) < 1 {
+		buckets = DefBuckets
+	}
+	upperBounds := append([]float64(nil), buckets...)
+	sort.Float64s(upperBounds)
+	if math.IsInf(upperBounds[len(upperBounds)-1], 1) {
+		upperBounds = upperBounds[:len(upperBounds)-1]
+	}
+	v := &HistogramVec{}
+	v.init(TypeHistogram, name, help, labels, func() interface{} { return newHistogram(upperBounds) })
+	return v
+}
+
+// With returns the histogram of the label values, it panics if the count of the values is wrong.
+func (v *HistogramVec) With(values ...string) *Histogram { return v.with(values).(*Histogram) }
+
+func (v *HistogramVec) Collect(w *Writer) {
+	for _, c := range v.sorted() {
+		c.metric.(*Histogram).collect(w, c.values)
+	}
+}
@@ -0,0 +1,63 @@
+package sha
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zzztttkkk/sha/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(metrics.NewRegistry(), []float64{1})
+	mux := NewMux(&MuxOptions{Metrics: m})
+	mux.HTTP(MethodGet, "/user/{id}", RequestCtxHandlerFunc(func(ctx *RequestCtx) {}))
+	mux.HTTP(MethodGet, "/panic", RequestCtxHandlerFunc(func(ctx *RequestCtx) { panic("oops") }))
+	mux.HTTP(MethodGet, "/metrics", m.Handler())
+
+	cli := NewCli(nil)
+	m.WatchCli("default", cli)
+	addr, stop := startHTTP11TestServer(t, mux, func(s *Server) { m.WatchServer("main", s) })
+	defer stop()
+
+	for _, p := range []string{"/user/1", "/user/2", "/panic", "/missing"} {
+		res, err := http.Get("http://" + addr + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nBad Header\r\n\r\n"))
+	_, _ = ioutil.ReadAll(conn)
+	_ = conn.Close()
+
+	res, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get(HeaderContentType) != metrics.ContentType {
+		t.Fatalf("unexpected content type %q", res.Header.Get(HeaderContentType))
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	text := string(data)
+	for _, line := range []string{
+		`sha_http_requests_total{method="GET",route="/user/{id}",status="200"} 2`,
+		`sha_http_requests_total{method="GET",route="/panic",status="500"} 1`,
+		`sha_http_requests_total{method="GET",route="",status="404"} 1`,
+		`sha_http_request_duration_seconds_count{method="GET",route="/user/{id}"} 2`,
+		`# TYPE sha_server_alive_connections gauge`,
+		`sha_server_parse_errors_total{server="main"} 1`,
+		`sha_cli_connections_in_use{cli="default"} 0`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, text)
+		}
+	}
+}
@@ -8,15 +8,16 @@ import (
 )
 
 const (
-	MIMEJson      = "application/json"
-	MIMEForm      = "application/x-www-form-urlencoded"
-	MIMEMultiPart = "multipart/form-data"
-	MIMEText      = "text/plain"
-	MIMEMarkdown  = "text/markdown"
-	MIMEHtml      = "text/html"
-	MIMEPng       = "image/png"
-	MIMEJpeg      = "image/jpeg"
-	MIMEUnknown   = "application/octet-stream"
+	MIMEJson        = "application/json"
+	MIMEForm        = "application/x-www-form-urlencoded"
+	MIMEMultiPart   = "multipart/form-data"
+	MIMEText        = "text/plain"
+	MIMEMarkdown    = "text/markdown"
+	MIMEHtml        = "text/html"
+	MIMEEventStream = "text/event-stream"
+	MIMEPng         = "image/png"
+	MIMEJpeg        = "image/jpeg"
+	MIMEUnknown     = "application/octet-stream"
 )
 
 // https://developer.mozilla.org/en-US/docs/Web/HTTP/Basics_of_HTTP/MIME_types
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/zzztttkkk/sha/logx"
+	"github.com/zzztttkkk/sha/trace"
 )
 
 type Backend interface {
@@ -45,6 +47,18 @@ var DefaultWaitBufferSize = 12
 
 var _baseCtx context.Context
 var _maxWorkers int32
+var _logger logx.Logger
+
+// SetLogger sets the logger of the runtime, nil means `logx.Default()`.
+func SetLogger(l logx.Logger) { _logger = l }
+
+func logger() logx.Logger { return logx.Or(_logger) }
+
+var _tracer *trace.Tracer
+
+// SetTracer sets the tracer of the runtime, a root span `pipeline <task type>` is recorded for each executed task.
+// the span of `Push` is a child of the span in its context, see `trace.Start`.
+func SetTracer(t *trace.Tracer) { _tracer = t }
 
 func Init(v Backend, baseCtx context.Context, maxWorkers int32) {
 	backendOnce.Do(func() {
@@ -61,7 +75,12 @@ func Push(ctx context.Context, taskType string, priority int, data interface{},
 	if _, ok := pipelineMap[taskType]; !ok {
 		return "", fmt.Errorf("sha.pipeline: unknown task type `%s`", taskType)
 	}
-	return backend.PushTask(ctx, taskType, priority, data, timeout)
+	ctx, span := trace.Start(ctx, "pipeline.push "+taskType, trace.SpanKindProducer)
+	id, err = backend.PushTask(ctx, taskType, priority, data, timeout)
+	span.SetAttributes("pipeline.task.type", taskType, "pipeline.task.id", id)
+	span.SetError(err)
+	span.End()
+	return id, err
 }
 
 var ErrEmpty = errors.New("sha.pipeline: empty")
@@ -112,6 +131,12 @@ func executeTask(task *Task) {
 	}
 	task.cFn = cFn
 
+	var span *trace.Span
+	if _tracer != nil {
+		ctx, span = _tracer.Start(ctx, "pipeline "+task.typeS, trace.SpanKindConsumer)
+		span.SetAttributes("pipeline.task.type", task.typeS, "pipeline.task.id", task.id)
+	}
+
 	var result interface{}
 	var rErr error
 
@@ -122,6 +147,8 @@ func executeTask(task *Task) {
 			copy(ue.path, task.path)
 			rErr = ue
 		}
+		span.SetError(rErr)
+		span.End()
 
 		task.setStatus(TaskStatusDone)
 		task.cleanUp(rErr, result)
@@ -146,7 +173,7 @@ func Start(ctx context.Context) {
 				c := len(runningMap)
 				if c > 0 {
 					time.Sleep(time.Second)
-					log.Printf("sha.pipeline: running tasks count: `%d`\r\n", c)
+					logger().Info("sha.pipeline: waiting for running tasks", "count", c)
 					continue
 				}
 				break
@@ -160,7 +187,7 @@ func Start(ctx context.Context) {
 			task, err := Pop(ctx)
 			if err != nil {
 				if err != ErrEmpty {
-					log.Println(err)
+					logger().Error("sha.pipeline: pop task failed", "err", err)
 				}
 				goto _doSleep
 			}
@@ -111,6 +111,10 @@ func (rb *_RedisBackend) PopTask(ctx context.Context) (id string, taskType strin
 	return id, task.Type, task.Data, task.Timeout, nil
 }
 
+func (rb *_RedisBackend) QueueLength(ctx context.Context) (int64, error) {
+	return rb.cli.ZCard(ctx, rb.prefix+":queue").Result()
+}
+
 func (rb *_RedisBackend) CancelTask(ctx context.Context, id string) error {
 	task := getRunningTask(id)
 	if task != nil {
@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/zzztttkkk/sha/metrics"
+)
+
+// QueueLengthBackend is implemented by the backends which can report the count of the pending tasks.
+type QueueLengthBackend interface {
+	QueueLength(ctx context.Context) (int64, error)
+}
+
+var metricTaskDuration = metrics.NewHistogramVec(
+	"sha_pipeline_task_duration_seconds", "The latency of the tasks by the results, `ok`, `error` or `canceled`.",
+	nil, "type", "result",
+)
+
+// RegisterMetrics registers the collectors of the runtime to reg, nil means `metrics.Default`.
+// the queue length is exposed only if the backend implements `QueueLengthBackend`.
+func RegisterMetrics(reg *metrics.Registry) {
+	if reg == nil {
+		reg = metrics.Default
+	}
+	reg.MustRegister(
+		metricTaskDuration,
+		metrics.NewFunc(
+			metrics.TypeGauge, "sha_pipeline_running_tasks", "The tasks being processed.", nil,
+			func(w *metrics.Writer) {
+				runningLock.Lock()
+				n := len(runningMap)
+				runningLock.Unlock()
+				w.Value(float64(n))
+			},
+		),
+		metrics.NewFunc(
+			metrics.TypeGauge, "sha_pipeline_queue_length", "The tasks waiting in the backend.", nil,
+			func(w *metrics.Writer) {
+				b, ok := backend.(QueueLengthBackend)
+				if !ok {
+					return
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				n, err := b.QueueLength(ctx)
+				if err != nil {
+					logger().Warn("sha.pipeline: get queue length failed", "err", err)
+					return
+				}
+				w.Value(float64(n))
+			},
+		),
+	)
+}
+
+func observeTask(task *Task, err error) {
+	result := "ok"
+	switch {
+	case err == ErrCanceled:
+		result = "canceled"
+	case err != nil:
+		result = "error"
+	}
+	metricTaskDuration.With(task.typeS, result).Observe(time.Since(task.ctime).Seconds())
+}
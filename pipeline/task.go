@@ -1,7 +1,6 @@
 package pipeline
 
 import (
-	"log"
 	"sync/atomic"
 	"time"
 )
@@ -56,8 +55,9 @@ func (task *Task) cleanUp(err error, result interface{}) {
 	atomic.StoreInt32(&task.cFnFlag, 1)
 
 	delRunningTask(task.id)
+	observeTask(task, err)
 	if err = backend.ReportResult(task.id, time.Since(task.ctime), err, result); err != nil {
-		log.Printf("sha.pipeline: report error `%s`\r\n", err.Error())
+		logger().Error("sha.pipeline: report result failed", "id", task.id, "type", task.typeS, "err", err)
 	}
 
 	if task.cFn != nil {
@@ -0,0 +1,273 @@
+package sha
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zzztttkkk/sha/utils"
+)
+
+// https://www.haproxy.org/download/2.3/doc/proxy-protocol.txt
+
+type ProxyProtocolOptions struct {
+	Enabled bool `json:"enabled" toml:"enabled"`
+	// connections from other sources will not be parsed. empty means trust no sources, use `0.0.0.0/0` and `::/0`
+	// to trust all sources.
+	TrustedCIDRs []string `json:"trusted_cidrs" toml:"trusted-cidrs"`
+	// close the connection from trusted sources without the proxy header
+	Required      bool               `json:"required" toml:"required"`
+	HeaderTimeout utils.TomlDuration `json:"header_timeout" toml:"header-timeout"`
+}
+
+var (
+	ErrBadProxyProtocolHeader     = errors.New("sha.server: bad proxy protocol header")
+	ErrMissingProxyProtocolHeader = errors.New("sha.server: missing proxy protocol header")
+)
+
+var (
+	proxyProtocolV1Prefix = []byte("PROXY ")
+	proxyProtocolV2Sig    = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	proxyProtocolV1MaxLength = 107
+	proxyProtocolV2HeadSize  = 16
+)
+
+type _ProxyProtocolListener struct {
+	net.Listener
+	trusted       []*net.IPNet
+	required      bool
+	headerTimeout time.Duration
+}
+
+func newProxyProtocolListener(l net.Listener, opt *ProxyProtocolOptions) net.Listener {
+	return &_ProxyProtocolListener{
+		Listener:      l,
+		trusted:       parseCIDRs(opt.TrustedCIDRs),
+		required:      opt.Required,
+		headerTimeout: opt.HeaderTimeout.Duration,
+	}
+}
+
+// parseCIDRs parses CIDRs, a single ip is treated as a /32 or /128 network.
+func parseCIDRs(lst []string) []*net.IPNet {
+	var rv []*net.IPNet
+	for _, v := range lst {
+		if !strings.Contains(v, "/") {
+			if strings.Contains(v, ":") {
+				v += "/128"
+			} else {
+				v += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			panic(err)
+		}
+		rv = append(rv, ipNet)
+	}
+	return rv
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *_ProxyProtocolListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && ipInNets(tcpAddr.IP, l.trusted)
+}
+
+func (l *_ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	// the header is parsed in the connection goroutine, so a slow client will not block the accept loop
+	return &_ProxyProtocolConn{Conn: conn, listener: l}, nil
+}
+
+type _ProxyProtocolConn struct {
+	net.Conn
+	listener *_ProxyProtocolListener
+	once     sync.Once
+	r        *bufio.Reader
+	err      error
+	remote   net.Addr
+	local    net.Addr
+}
+
+func (c *_ProxyProtocolConn) init() {
+	c.once.Do(func() {
+		if c.listener.headerTimeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Now().Add(c.listener.headerTimeout))
+		}
+		c.r = bufio.NewReaderSize(c.Conn, 256)
+		c.remote, c.local, c.err = readProxyProtocolHeader(c.r, c.listener.required)
+		if c.listener.headerTimeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Time{})
+		}
+	})
+}
+
+// ready reads the proxy protocol header, returns false if the header is bad.
+func (c *_ProxyProtocolConn) ready() bool {
+	c.init()
+	return c.err == nil
+}
+
+func (c *_ProxyProtocolConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+func (c *_ProxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *_ProxyProtocolConn) LocalAddr() net.Addr {
+	c.init()
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readProxyProtocolHeader returns nil addresses if the header is absent or the proxy did not provide addresses.
+func readProxyProtocolHeader(r *bufio.Reader, required bool) (net.Addr, net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch first[0] {
+	case proxyProtocolV1Prefix[0]:
+		if head, err := r.Peek(len(proxyProtocolV1Prefix)); err == nil && bytes.Equal(head, proxyProtocolV1Prefix) {
+			return readProxyProtocolV1(r)
+		}
+	case proxyProtocolV2Sig[0]:
+		if head, err := r.Peek(len(proxyProtocolV2Sig)); err == nil && bytes.Equal(head, proxyProtocolV2Sig) {
+			return readProxyProtocolV2(r)
+		}
+	}
+	if required {
+		return nil, nil, ErrMissingProxyProtocolHeader
+	}
+	return nil, nil, nil
+}
+
+func readProxyProtocolV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyProtocolV1MaxLength {
+			return nil, nil, ErrBadProxyProtocolHeader
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrBadProxyProtocolHeader
+	}
+
+	fields := strings.Split(utils.S(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return nil, nil, ErrBadProxyProtocolHeader
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, nil, ErrBadProxyProtocolHeader
+	}
+	if len(fields) != 6 {
+		return nil, nil, ErrBadProxyProtocolHeader
+	}
+
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, e1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, e2 := strconv.ParseUint(fields[5], 10, 16)
+	if src == nil || dst == nil || e1 != nil || e2 != nil || (fields[1] == "TCP4") != (src.To4() != nil) {
+		return nil, nil, ErrBadProxyProtocolHeader
+	}
+	return &net.TCPAddr{IP: src, Port: int(srcPort)}, &net.TCPAddr{IP: dst, Port: int(dstPort)}, nil
+}
+
+func readProxyProtocolV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	head := make([]byte, proxyProtocolV2HeadSize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, nil, err
+	}
+	if head[12]>>4 != 2 {
+		return nil, nil, ErrBadProxyProtocolHeader
+	}
+	cmd := head[12] & 0x0f
+	family := head[13]
+	size := int(binary.BigEndian.Uint16(head[14:]))
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, err
+	}
+
+	switch cmd {
+	case 0x0: // LOCAL, health checks of the proxy
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, ErrBadProxyProtocolHeader
+	}
+
+	var ipSize int
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		ipSize = net.IPv4len
+	case 0x2: // AF_INET6
+		ipSize = net.IPv6len
+	default: // AF_UNSPEC, AF_UNIX
+		return nil, nil, nil
+	}
+	if len(body) < ipSize*2+4 {
+		return nil, nil, ErrBadProxyProtocolHeader
+	}
+
+	src := net.IP(append([]byte(nil), body[:ipSize]...))
+	dst := net.IP(append([]byte(nil), body[ipSize:ipSize*2]...))
+	srcPort := binary.BigEndian.Uint16(body[ipSize*2:])
+	dstPort := binary.BigEndian.Uint16(body[ipSize*2+2:])
+
+	// the tlv vectors are ignored
+	if family&0x0f == 0x2 { // DGRAM
+		return &net.UDPAddr{IP: src, Port: int(srcPort)}, &net.UDPAddr{IP: dst, Port: int(dstPort)}, nil
+	}
+	return &net.TCPAddr{IP: src, Port: int(srcPort)}, &net.TCPAddr{IP: dst, Port: int(dstPort)}, nil
+}
@@ -0,0 +1,169 @@
+package sha
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProxyProtocolHeader(t *testing.T) {
+	v2 := func(cmd, family byte, addrs []byte) string {
+		buf := bytes.NewBuffer(nil)
+		buf.Write(proxyProtocolV2Sig)
+		buf.WriteByte(0x20 | cmd)
+		buf.WriteByte(family)
+		_ = binary.Write(buf, binary.BigEndian, uint16(len(addrs)))
+		buf.Write(addrs)
+		return buf.String()
+	}
+	v4Addrs := []byte{192, 168, 0, 1, 10, 0, 0, 1, 0x30, 0x39, 0x01, 0xbb}
+	v6Addrs := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x30, 0x39, 0x01, 0xbb)
+
+	cases := []struct {
+		header   string
+		required bool
+		remote   string
+		local    string
+		err      error
+	}{
+		{header: "PROXY TCP4 192.168.0.1 10.0.0.1 12345 443\r\n", remote: "192.168.0.1:12345", local: "10.0.0.1:443"},
+		{header: "PROXY TCP6 2001:db8::1 2001:db8::2 12345 443\r\n", remote: "[2001:db8::1]:12345", local: "[2001:db8::2]:443"},
+		{header: "PROXY UNKNOWN\r\n"},
+		{header: "PROXY TCP4 2001:db8::1 10.0.0.1 12345 443\r\n", err: ErrBadProxyProtocolHeader},
+		{header: "PROXY TCP4 192.168.0.1 10.0.0.1 123456 443\r\n", err: ErrBadProxyProtocolHeader},
+		{header: "PROXY TCP4 192.168.0.1\n", err: ErrBadProxyProtocolHeader},
+		{header: "PROXY " + strings.Repeat("A", 120) + "\r\n", err: ErrBadProxyProtocolHeader},
+		{header: v2(0x1, 0x11, v4Addrs), remote: "192.168.0.1:12345", local: "10.0.0.1:443"},
+		{header: v2(0x1, 0x21, append(v6Addrs, 0x04, 0x00, 0x01, 'x')), remote: "[2001:db8::1]:12345", local: "[2001:db8::2]:443"},
+		{header: v2(0x0, 0x00, nil)},
+		{header: v2(0x1, 0x11, v4Addrs[:8]), err: ErrBadProxyProtocolHeader},
+		{header: v2(0x2, 0x11, v4Addrs), err: ErrBadProxyProtocolHeader},
+		{header: ""},
+		{header: "", required: true, err: ErrMissingProxyProtocolHeader},
+	}
+
+	for _, c := range cases {
+		r := bufio.NewReader(strings.NewReader(c.header + "GET / HTTP/1.1\r\n"))
+		remote, local, err := readProxyProtocolHeader(r, c.required)
+		if err != c.err {
+			t.Fatalf("%q: unexpected error %v", c.header, err)
+		}
+		if err != nil {
+			continue
+		}
+		if (remote == nil) != (c.remote == "") || (remote != nil && (remote.String() != c.remote || local.String() != c.local)) {
+			t.Fatalf("%q: unexpected addresses %v %v", c.header, remote, local)
+		}
+		if line, _ := r.ReadString('\n'); line != "GET / HTTP/1.1\r\n" {
+			t.Fatalf("%q: unexpected rest %q", c.header, line)
+		}
+	}
+}
+
+func makeTestTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sha.local"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"sha.local"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestServer_ProxyProtocol(t *testing.T) {
+	for _, useTLS := range []bool{false, true} {
+		l, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		s := DefaultWithContext(ctx)
+		s.Options.ProxyProtocol.Enabled = true
+		s.Options.ProxyProtocol.TrustedCIDRs = []string{"127.0.0.1"}
+		s.Handler = RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+			_ = ctx.WriteString(ctx.RemoteAddr().String() + " " + ctx.LocalAddr().String())
+		})
+
+		var sl net.Listener = newProxyProtocolListener(l, &s.Options.ProxyProtocol)
+		if useTLS {
+			s.tls = makeTestTLSConfig(t)
+			s.isTLS = true
+			sl = s.enableTLS(sl, "-", "-")
+		}
+
+		done := make(chan struct{})
+		go func() {
+			s.Serve(sl)
+			close(done)
+		}()
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = conn.Write([]byte("PROXY TCP4 192.168.0.1 10.0.0.1 12345 443\r\n"))
+		if useTLS {
+			conn = tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+		}
+		_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: sha.local\r\n\r\n"))
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		_ = conn.Close()
+		if string(body) != "192.168.0.1:12345 10.0.0.1:443" {
+			t.Fatalf("unexpected body %q, tls=%v", body, useTLS)
+		}
+
+		cancel()
+		<-done
+	}
+}
+
+func TestProxyProtocolListener_Trusted(t *testing.T) {
+	addr := func(ip string) net.Addr { return &net.TCPAddr{IP: net.ParseIP(ip), Port: 80} }
+	for _, c := range []struct {
+		cidrs   []string
+		ip      string
+		trusted bool
+	}{
+		{nil, "127.0.0.1", false},
+		{[]string{}, "::1", false},
+		{[]string{"127.0.0.1"}, "127.0.0.1", true},
+		{[]string{"127.0.0.1"}, "127.0.0.2", false},
+		{[]string{"10.0.0.0/8"}, "10.1.2.3", true},
+		{[]string{"0.0.0.0/0"}, "192.168.0.1", true},
+		{[]string{"0.0.0.0/0"}, "::1", false},
+		{[]string{"0.0.0.0/0", "::/0"}, "::1", true},
+	} {
+		l := newProxyProtocolListener(nil, &ProxyProtocolOptions{TrustedCIDRs: c.cidrs}).(*_ProxyProtocolListener)
+		if l.isTrusted(addr(c.ip)) != c.trusted {
+			t.Fatalf("%v %s: expected trusted=%v", c.cidrs, c.ip, c.trusted)
+		}
+	}
+}
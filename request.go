@@ -59,19 +59,19 @@ type Request struct {
 	noCopy
 	_HTTPPocket
 
-	_method       _Method
-	flags         internal.Status16
-	URL           URL
-	query         Form
-	bodyStatus    int // 0: unparsed; 1: unsupported content type; 2: parsed
-	bodyForm      Form
-	files         FormFiles
-	boundaryBegin []byte
-	boundaryEnd   []byte
-	boundaryLine  []byte
-	session       []byte
-	cookies       utils.Kvs
-	history       []string // redirect history
+	_method    _Method
+	flags      internal.Status16
+	URL        URL
+	query      Form
+	bodyStatus int // 0: unparsed; 1: unsupported content type; 2: parsed
+	bodyForm   Form
+	files      FormFiles
+	bodyErr    error
+	bodyStream _BodyStream
+	multipart  *MultipartOptions
+	session    []byte
+	cookies    utils.Kvs
+	history    []string // redirect history
 }
 
 func (req *Request) Reset(maxCap int) {
@@ -83,14 +83,13 @@ func (req *Request) Reset(maxCap int) {
 	req.query.Reset()
 	req.bodyForm.Reset()
 	req.bodyStatus = _BodyUnParsed
+	req.bodyErr = nil
 	for _, f := range req.files {
 		f.reset(maxCap)
 		formFilePool.Put(f)
 	}
 	req.files = req.files[:0]
-	req.boundaryBegin = req.boundaryBegin[:0]
-	req.boundaryEnd = req.boundaryEnd[:0]
-	req.boundaryLine = req.boundaryLine[:0]
+	req.bodyStream.reset()
 	req.cookies.Reset()
 	req.history = nil
 }
@@ -0,0 +1,84 @@
+package sha
+
+import "github.com/zzztttkkk/sha/utils"
+
+// RequestID is a middleware which reads the request id from the header, or generates one if it is missing or
+// invalid, and echoes it in the response. the id is available by `RequestCtx.RequestID`, and it is forwarded by the
+// `Cli` requests whose context is wrapped from the request, such as `AcquireRequestCtx(ctx.Wrap())`.
+// use it with `WrapHandler` to identify all requests, including the 404s.
+type RequestID struct {
+	// `X-Request-ID` by default
+	Header string
+	// `utils.ULIDGenerator{}` by default
+	Generator IDGenerator
+	// reports whether the inbound id is acceptable, 1-128 characters of `[0-9A-Za-z._:+/=-]` by default
+	Validate func(v []byte) bool
+}
+
+var _ Middleware = (*RequestID)(nil)
+
+func validRequestID(v []byte) bool {
+	if len(v) < 1 || len(v) > 128 {
+		return false
+	}
+	for _, c := range v {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '+' || c == '/' || c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (m *RequestID) Process(ctx *RequestCtx, next func()) {
+	header := m.Header
+	if len(header) < 1 {
+		header = HeaderXRequestID
+	}
+	validate := m.Validate
+	if validate == nil {
+		validate = validRequestID
+	}
+
+	if v, ok := ctx.Request.Header().Get(header); ok && validate(v) {
+		ctx.requestID = string(v)
+	} else {
+		gen := m.Generator
+		if gen == nil {
+			gen = utils.ULIDGenerator{}
+		}
+		buf := make([]byte, gen.Size())
+		gen.Generate(buf)
+		ctx.requestID = utils.S(buf)
+	}
+	ctx.requestIDHeader = header
+
+	res := ctx.Response.Header()
+	res.SetString(header, ctx.requestID)
+	defer func() { // the headers may be reset by the handler
+		if _, ok := res.Get(header); !ok && !ctx.responseStarted() {
+			res.SetString(header, ctx.requestID)
+		}
+	}()
+	next()
+}
+
+// RequestID returns the id set by the `RequestID` middleware, or empty.
+func (ctx *RequestCtx) RequestID() string { return ctx.requestID }
+
+// forwardRequestID sets the request id of the parent request to the client request.
+func (ctx *RequestCtx) forwardRequestID() {
+	if ctx.ctx == nil {
+		return
+	}
+	parent := Unwrap(ctx.ctx)
+	if parent == nil || len(parent.requestID) < 1 {
+		return
+	}
+	header := ctx.Request.Header()
+	if _, ok := header.Get(parent.requestIDHeader); !ok {
+		header.SetString(parent.requestIDHeader, parent.requestID)
+	}
+}
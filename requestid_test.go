@@ -0,0 +1,100 @@
+package sha
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zzztttkkk/sha/logx"
+)
+
+func TestRequestID(t *testing.T) {
+	var mutex sync.Mutex
+	var logs []string
+	logger := logx.Func(func(level logx.Level, msg string, kvs ...interface{}) {
+		mutex.Lock()
+		logs = append(logs, logx.Format(level, msg, kvs...))
+		mutex.Unlock()
+	})
+
+	downstream := NewMux(&MuxOptions{Logger: logx.Discard})
+	downstream.HTTP(MethodGet, "/", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		v, _ := ctx.Request.Header().Get(HeaderXRequestID)
+		_, _ = ctx.Write(v)
+	}))
+	downstreamAddr, stopDownstream := startHTTP11TestServer(t, downstream, nil)
+	defer stopDownstream()
+	// the rules cache of the validator is not safe for preparing two muxes concurrently
+	if res, err := http.Get("http://" + downstreamAddr); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = res.Body.Close()
+	}
+
+	cli := NewCli(nil)
+	defer cli.Close()
+
+	mux := NewMux(&MuxOptions{Logger: logger})
+	mux.HTTP(MethodGet, "/forward", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		cctx := AcquireRequestCtx(ctx.Wrap())
+		defer ReleaseRequestCtx(cctx)
+		cctx.Request.SetMethod(MethodGet)
+		cctx.Request.SetPathString("/")
+		if err := cli.Send(cctx, downstreamAddr); err != nil {
+			ctx.SetError(err)
+			return
+		}
+		_ = ctx.WriteString(ctx.RequestID() + "," + cctx.Response.Body().String())
+	}))
+	mux.HTTP(MethodGet, "/panic", RequestCtxHandlerFunc(func(ctx *RequestCtx) { panic(fmt.Errorf("oops")) }))
+	addr, stop := startHTTP11TestServer(t, WrapHandler(mux, &RequestID{}), nil)
+	defer stop()
+
+	do := func(path, id string) (*http.Response, string) {
+		req, _ := http.NewRequest(MethodGet, "http://"+addr+path, nil)
+		if len(id) > 0 {
+			req.Header.Set(HeaderXRequestID, id)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return res, string(body)
+	}
+
+	res, body := do("/forward", "abc-123")
+	if res.Header.Get(HeaderXRequestID) != "abc-123" || body != "abc-123,abc-123" {
+		t.Fatalf("unexpected %v %q", res.Header, body)
+	}
+
+	res, body = do("/forward", "bad id")
+	id := res.Header.Get(HeaderXRequestID)
+	if len(id) != 26 || body != id+","+id {
+		t.Fatalf("unexpected generated id %q %q", id, body)
+	}
+
+	res, _ = do("/missing", "")
+	if res.StatusCode != StatusNotFound || len(res.Header.Get(HeaderXRequestID)) != 26 {
+		t.Fatalf("unexpected %d %v", res.StatusCode, res.Header)
+	}
+
+	res, _ = do("/panic", "panic-1")
+	if res.StatusCode != StatusInternalServerError || res.Header.Get(HeaderXRequestID) != "panic-1" {
+		t.Fatalf("unexpected %d %v", res.StatusCode, res.Header)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(logs) != 1 || !strings.HasPrefix(logs[0], "ERROR sha.mux: panic recovered request_id=panic-1 ") {
+		t.Fatalf("unexpected logs %q", logs)
+	}
+
+	if AcquireRequestCtx(context.Background()).RequestID() != "" {
+		t.Fatal("unexpected request id")
+	}
+}
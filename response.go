@@ -13,6 +13,7 @@ type Response struct {
 	statusCode int
 	cw         _CompressionWriter
 	cwPool     *sync.Pool
+	written    int64 // the size of the body written by the handler, before compression
 }
 
 func (res *Response) StatusCode() int { return res.statusCode }
@@ -41,6 +42,7 @@ func (res *Response) SetStatusCode(v int) *Response {
 func (res *Response) Body() *bytes.Buffer { return res.body }
 
 func (res *Response) Write(p []byte) (int, error) {
+	res.written += int64(len(p))
 	if res.cw != nil {
 		return res.cw.Write(p)
 	}
@@ -50,6 +52,7 @@ func (res *Response) Write(p []byte) (int, error) {
 func (res *Response) reset(maxCap int) {
 	res._HTTPPocket.reset(maxCap)
 	res.statusCode = 0
+	res.written = 0
 	if res.cw != nil {
 		res.cw.Reset(nil)
 		res.cwPool.Put(res.cw)
@@ -58,6 +61,18 @@ func (res *Response) reset(maxCap int) {
 	}
 }
 
+// disableCompression drops the compression writer, so the written data is sent immediately.
+func (res *Response) disableCompression() {
+	if res.cw == nil {
+		return
+	}
+	res.cw.Reset(nil)
+	res.cwPool.Put(res.cw)
+	res.cw = nil
+	res.cwPool = nil
+	res.header.Del(HeaderContentEncoding)
+}
+
 func (res *Response) ResetBody() {
 	if res.body != nil {
 		res.body.Reset()
@@ -78,7 +78,7 @@ func (m *MuxGroup) copyMiddleware(opt *RouteOptions) *RouteOptions {
 func (m *MuxGroup) add(method, path string, handler RequestCtxHandler, opt *RouteOptions) {
 	opt = m.copyMiddleware(opt)
 	if m.parent != nil {
-		m.parent.add(method, path, handler, opt)
+		m.parent.add(method, m.parent.prefix+path, handler, opt)
 		return
 	}
 	m.mux.HTTPWithOptions(opt, method, path, handler)
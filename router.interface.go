@@ -3,6 +3,7 @@ package sha
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/zzztttkkk/sha/validator"
 )
@@ -18,8 +19,56 @@ func (f MiddlewareFunc) Process(ctx *RequestCtx, next func()) {
 }
 
 type RouteOptions struct {
+	// Name: the unique name of the route in the mux, see `Mux.URLFor`.
+	Name        string
 	Middlewares []Middleware
 	Document    validator.Document
+
+	// StreamBody: the request body will not be read before handling, use `ctx.Request.BodyStream()` to read it.
+	// only works for http1.x.
+	StreamBody bool
+
+	// the limits below override the global options for this route, the route is matched right after the header
+	// section, so they are applied before reading the body. zero means using the global options.
+
+	// MaxBodySize: overrides `HTTPOptions.MaxBodySize`, negative means no limit.
+	MaxBodySize int
+	// ReadTimeout: the body must be read in this duration after the header section, overrides
+	// `ServerOptions.ReadTimeout`. only works for http1.x.
+	ReadTimeout time.Duration
+	// WriteTimeout: overrides `ServerOptions.WriteTimeout` for sending the response. only works for http1.x.
+	WriteTimeout time.Duration
+	// Compression: the compression policy of the response.
+	Compression CompressionPolicy
+
+	// SlowHandlerTimeout: the context of the request is canceled after this duration. the handler is not
+	// interrupted and nothing is sent at the deadline, it should return after `ctx.Done()`; then the response is
+	// replaced by `SlowHandlerStatus` if it is not started, the writes of the handler are discarded.
+	SlowHandlerTimeout time.Duration
+	// SlowHandlerStatus: `StatusServiceUnavailable` by default, or `StatusGatewayTimeout` for the proxy handlers.
+	SlowHandlerStatus int
+}
+
+type CompressionPolicy int
+
+const (
+	// CompressionDefault follows `MuxOptions.AutoCompress`
+	CompressionDefault = CompressionPolicy(iota)
+	// CompressionDisabled disables the automatic compression, such as the already compressed files
+	CompressionDisabled
+	// CompressionEnabled compresses the response by `Accept-Encoding` even if `MuxOptions.AutoCompress` is false
+	CompressionEnabled
+)
+
+func (p CompressionPolicy) String() string {
+	switch p {
+	case CompressionDisabled:
+		return "disabled"
+	case CompressionEnabled:
+		return "enabled"
+	default:
+		return "default"
+	}
 }
 
 type Router interface {
@@ -12,6 +12,7 @@ type _DocForm struct {
 	Prefix    string   `vld:"prefix,desc='url prefix',optional"`
 	Tags      []string `vld:"tags,optional"`
 	TagsLogic string   `vld:"logic,optional"`
+	Host      string   `vld:"host,desc='host pattern',optional"`
 }
 
 func (_DocForm) Default(name string) func() interface{} {
@@ -41,6 +42,32 @@ func mapAppend(m map[string]map[string]validator.Document, path, method string,
 	m1[method] = doc
 }
 
+// limits describes the route limits for the documents, one item per line.
+func (opt *RouteOptions) limits() string {
+	var buf strings.Builder
+	if opt.MaxBodySize > 0 {
+		buf.WriteString(fmt.Sprintf("- MaxBodySize: %d\r\n", opt.MaxBodySize))
+	} else if opt.MaxBodySize < 0 {
+		buf.WriteString("- MaxBodySize: unlimited\r\n")
+	}
+	if opt.StreamBody {
+		buf.WriteString("- StreamBody: true\r\n")
+	}
+	if opt.ReadTimeout > 0 {
+		buf.WriteString(fmt.Sprintf("- ReadTimeout: %s\r\n", opt.ReadTimeout))
+	}
+	if opt.SlowHandlerTimeout > 0 {
+		buf.WriteString(fmt.Sprintf("- SlowHandlerTimeout: %s\r\n", opt.SlowHandlerTimeout))
+	}
+	if opt.WriteTimeout > 0 {
+		buf.WriteString(fmt.Sprintf("- WriteTimeout: %s\r\n", opt.WriteTimeout))
+	}
+	if opt.Compression != CompressionDefault {
+		buf.WriteString(fmt.Sprintf("- Compression: %s\r\n", opt.Compression))
+	}
+	return buf.String()
+}
+
 func (m *Mux) ServeDocuments(method, path string, middleware ...Middleware) {
 	m.HTTPWithOptions(
 		&RouteOptions{Document: validator.NewDocument(_DocForm{}, nil), Middlewares: middleware},
@@ -50,82 +77,102 @@ func (m *Mux) ServeDocuments(method, path string, middleware ...Middleware) {
 			ctx.MustValidateForm(&form)
 			ctx.Response.Header().SetContentType(MIMEMarkdown)
 
-			pathFilterMap := map[string]map[string]validator.Document{}
-			if len(form.Prefix) > 0 {
-				for p, m1 := range m.documents {
-					if strings.HasPrefix(p, form.Prefix) {
-						pathFilterMap[p] = m1
-					}
+			var buf strings.Builder
+			if len(form.Host) < 1 {
+				buf.WriteString(m.renderDocuments(&form))
+			}
+			for _, hr := range m.sortedHosts() {
+				if len(form.Host) > 0 && form.Host != hr.pattern {
+					continue
 				}
-			} else {
-				pathFilterMap = m.documents
+				buf.WriteString(fmt.Sprintf("# Host: %s\n", hr.pattern))
+				buf.WriteString(hr.mux.renderDocuments(&form))
 			}
+			_ = ctx.WriteString(buf.String())
+		}),
+	)
+}
 
-			var tagsFilterMap map[string]map[string]validator.Document
-			if len(form.Tags) > 0 {
-				tagsFilterMap = map[string]map[string]validator.Document{}
-				switch form.TagsLogic {
-				case "OR":
-					for _, tag := range form.Tags {
-						tag = strings.ToLower(tag)
-						for p1, m1 := range pathFilterMap {
-							for m2, d := range m1 {
-								if contains(d.Tags(), tag) {
-									mapAppend(tagsFilterMap, p1, m2, d)
-								}
-							}
+// renderDocuments renders the documents of the routes as markdown, the routes of the hosts are excluded.
+func (m *Mux) renderDocuments(form *_DocForm) string {
+	pathFilterMap := map[string]map[string]validator.Document{}
+	if len(form.Prefix) > 0 {
+		for p, m1 := range m.documents {
+			if strings.HasPrefix(p, form.Prefix) {
+				pathFilterMap[p] = m1
+			}
+		}
+	} else {
+		pathFilterMap = m.documents
+	}
+
+	var tagsFilterMap map[string]map[string]validator.Document
+	if len(form.Tags) > 0 {
+		tagsFilterMap = map[string]map[string]validator.Document{}
+		switch form.TagsLogic {
+		case "OR":
+			for _, tag := range form.Tags {
+				tag = strings.ToLower(tag)
+				for p1, m1 := range pathFilterMap {
+					for m2, d := range m1 {
+						if contains(d.Tags(), tag) {
+							mapAppend(tagsFilterMap, p1, m2, d)
 						}
 					}
-				default:
-					for p1, m1 := range pathFilterMap {
-						for m2, d := range m1 {
-							for _, tag := range form.Tags {
-								if !contains(d.Tags(), tag) {
-									break
-								}
-								mapAppend(tagsFilterMap, p1, m2, d)
-							}
+				}
+			}
+		default:
+			for p1, m1 := range pathFilterMap {
+				for m2, d := range m1 {
+					for _, tag := range form.Tags {
+						if !contains(d.Tags(), tag) {
+							break
 						}
+						mapAppend(tagsFilterMap, p1, m2, d)
 					}
 				}
-			} else {
-				tagsFilterMap = pathFilterMap
 			}
+		}
+	} else {
+		tagsFilterMap = pathFilterMap
+	}
 
-			var buf strings.Builder
-			type _PathItem struct {
-				Path string
-				doc  string
-			}
-			var paths []*_PathItem
+	var buf strings.Builder
+	type _PathItem struct {
+		Path string
+		doc  string
+	}
+	var paths []*_PathItem
 
-			for p, m1 := range tagsFilterMap {
-				buf.WriteString(fmt.Sprintf("## Path: %s\n", p))
-				for me, doc := range m1 {
-					buf.WriteString(fmt.Sprintf("### Method: %s\n", me))
-					if doc.Description() != "" {
-						buf.WriteString(fmt.Sprintf("#### Description:\r\n%s\r\n", doc.Input()))
-					}
-					if doc.Input() != "" {
-						buf.WriteString(fmt.Sprintf("#### Input:\r\n%s\r\n", doc.Input()))
-					}
-					if doc.Output() != "" {
-						buf.WriteString(fmt.Sprintf("#### Output:\r\n%s\r\n", doc.Output()))
-					}
-					if len(doc.Tags()) > 0 {
-						buf.WriteString(fmt.Sprintf("#### Tags:\r\n%s\r\n", strings.Join(doc.Tags(), "; ")))
-					}
-				}
-				paths = append(paths, &_PathItem{doc: buf.String(), Path: p})
-				buf.Reset()
+	for p, m1 := range tagsFilterMap {
+		buf.WriteString(fmt.Sprintf("## Path: %s\n", p))
+		for me, doc := range m1 {
+			buf.WriteString(fmt.Sprintf("### Method: %s\n", me))
+			if doc.Description() != "" {
+				buf.WriteString(fmt.Sprintf("#### Description:\r\n%s\r\n", doc.Input()))
 			}
+			if doc.Input() != "" {
+				buf.WriteString(fmt.Sprintf("#### Input:\r\n%s\r\n", doc.Input()))
+			}
+			if doc.Output() != "" {
+				buf.WriteString(fmt.Sprintf("#### Output:\r\n%s\r\n", doc.Output()))
+			}
+			if len(doc.Tags()) > 0 {
+				buf.WriteString(fmt.Sprintf("#### Tags:\r\n%s\r\n", strings.Join(doc.Tags(), "; ")))
+			}
+			if limits := m.documentsLimits[p][me]; len(limits) > 0 {
+				buf.WriteString(fmt.Sprintf("#### Limits:\r\n%s", limits))
+			}
+		}
+		paths = append(paths, &_PathItem{doc: buf.String(), Path: p})
+		buf.Reset()
+	}
 
-			sort.Slice(paths, func(i, j int) bool { return paths[i].Path < paths[j].Path })
+	sort.Slice(paths, func(i, j int) bool { return paths[i].Path < paths[j].Path })
 
-			for _, v := range paths {
-				buf.WriteString(v.doc)
-			}
-			_ = ctx.WriteString(buf.String())
-		}),
-	)
+	var out strings.Builder
+	for _, v := range paths {
+		out.WriteString(v.doc)
+	}
+	return out.String()
 }
@@ -1,15 +1,17 @@
 package sha
 
 import (
+	"context"
 	"fmt"
+	"github.com/zzztttkkk/sha/logx"
 	"github.com/zzztttkkk/sha/utils"
 	"github.com/zzztttkkk/sha/validator"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 type MuxOptions struct {
@@ -24,6 +26,8 @@ type MuxOptions struct {
 	Recover                 func(ctx *RequestCtx, v interface{}) `json:"recover" toml:"-"`
 	AutoHandleDocs          bool                                 `json:"auto_handle_docs" toml:"auto-handle-docs"`
 	AutoCompress            bool                                 `json:"auto_compress" toml:"auto-compress"`
+	Logger                  logx.Logger                          `json:"-" toml:"-"` // see `RequestCtx.Logger`
+	Metrics                 *Metrics                             `json:"-" toml:"-"` // records the requests by the route patterns
 	Session                 struct {
 		Enabled     bool           `json:"enabled" toml:"enabled"`
 		SessionOpts SessionOptions `json:"session_opts" toml:"session-opts"`
@@ -33,13 +37,22 @@ type MuxOptions struct {
 
 func init() {
 	serverPrepareFunc = append(serverPrepareFunc, func(s *Server) {
-		h := s.Handler
-		if m, ok := h.(*Mux); ok && m.Opts.AutoHandleDocs {
-			m.ServeDocuments(MethodGet, "/docs")
+		h := unwrapHandler(s.Handler)
+		if m, ok := h.(*Mux); ok {
+			m.prepareDocuments()
 		}
 	})
 }
 
+func (m *Mux) prepareDocuments() {
+	if m.Opts.AutoHandleDocs {
+		m.ServeDocuments(MethodGet, "/docs")
+	}
+	for _, hr := range m.hosts {
+		hr.mux.prepareDocuments()
+	}
+}
+
 type Mux struct {
 	_MiddlewareNode
 	Opts MuxOptions
@@ -50,9 +63,18 @@ type Mux struct {
 	// path -> method -> description
 	documents         map[string]map[string]validator.Document
 	documentsTagIndex map[string]map[validator.Document]struct{}
+	// path -> method -> limits of the route options
+	documentsLimits map[string]map[string]string
 
 	cors map[string]*_CorsOptions
 
+	// the muxes of the hosts, see `Mux.Host`
+	hosts       []*_HostRoute
+	staticHosts map[string]*_HostRoute
+
+	// name -> route, see `Mux.URLFor`
+	names map[string]*_NamedRoute
+
 	// raw
 	// path -> method
 	all map[string]map[string]string
@@ -78,6 +100,49 @@ func isFileContentHandler(h RequestCtxHandler) bool {
 	return ok
 }
 
+type _RouteHandler struct {
+	RequestCtxHandler
+	opt     RouteOptions
+	pattern string
+}
+
+func (rh *_RouteHandler) Handle(ctx *RequestCtx) {
+	ctx.route = &rh.opt
+	ctx.pattern = rh.pattern
+	if rh.opt.Compression == CompressionEnabled {
+		ctx.AutoCompress()
+	}
+
+	timeout := rh.opt.SlowHandlerTimeout
+	if timeout <= 0 {
+		rh.RequestCtxHandler.Handle(ctx)
+		return
+	}
+
+	parent := ctx.ctx
+	c, cancel := context.WithTimeout(parent, timeout)
+	ctx.ctx = c
+	defer func() {
+		cancel()
+		ctx.ctx = parent
+	}()
+
+	rh.RequestCtxHandler.Handle(ctx)
+	// the status is decided after the handler returns, the response can not be sent while the handler owns the ctx
+	if c.Err() != context.DeadlineExceeded || parent.Err() != nil || ctx.responseStarted() {
+		return
+	}
+	sc := rh.opt.SlowHandlerStatus
+	if sc == 0 {
+		sc = StatusServiceUnavailable
+	}
+	res := &ctx.Response
+	res.disableCompression()
+	res.ResetBody()
+	res.Header().Reset()
+	res.SetStatusCode(sc)
+}
+
 func (m *Mux) HTTPWithOptions(opt *RouteOptions, method, path string, handler RequestCtxHandler) {
 	var middlewares []Middleware
 	var document validator.Document
@@ -126,6 +191,8 @@ func (m *Mux) HTTPWithOptions(opt *RouteOptions, method, path string, handler Re
 	}
 
 	rawHandler := handler
+	opts := &m.Opts
+	path = opts.Prefix + path
 
 	if !isAutoOptionsHandler(handler) {
 		var ms []Middleware
@@ -135,11 +202,16 @@ func (m *Mux) HTTPWithOptions(opt *RouteOptions, method, path string, handler Re
 		if len(ms) > 0 {
 			handler = middlewaresWrap(ms, handler)
 		}
+		rh := &_RouteHandler{RequestCtxHandler: handler, pattern: path}
+		if opt != nil {
+			rh.opt = *opt
+		}
+		handler = rh
 	}
 
-	opts := &m.Opts
-	path = opts.Prefix + path
-
+	if opt != nil && len(opt.Name) > 0 && !isAutoOptionsHandler(rawHandler) {
+		m.name(opt.Name, method, path)
+	}
 	tree.Add(path, handler)
 	if method != MethodOptions && opts.AutoHandleOptions {
 		m.HTTP(MethodOptions, path, newAutoOptions(method))
@@ -147,6 +219,14 @@ func (m *Mux) HTTPWithOptions(opt *RouteOptions, method, path string, handler Re
 
 	if document != nil {
 		mapAppend(m.documents, path, method, document)
+		if limits := opt.limits(); len(limits) > 0 {
+			m2 := m.documentsLimits[path]
+			if m2 == nil {
+				m2 = map[string]string{}
+				m.documentsLimits[path] = m2
+			}
+			m2[method] = limits
+		}
 
 		for _, tag := range document.Tags() {
 			m2 := m.documentsTagIndex[tag]
@@ -257,6 +337,23 @@ func (m *Mux) getTree(ctx *RequestCtx) *_RadixTree {
 	return tree
 }
 
+func (m *Mux) routeOptions(ctx *RequestCtx) *RouteOptions {
+	if len(m.hosts) > 0 {
+		if sub := m.hostMux(requestHost(ctx), nil); sub != nil {
+			return sub.routeOptions(ctx)
+		}
+	}
+	tree := m.getTree(ctx)
+	if tree == nil {
+		return nil
+	}
+	h, _ := tree.Get(ctx.Request.Path(), nil)
+	if rh, ok := h.(*_RouteHandler); ok {
+		return &rh.opt
+	}
+	return nil
+}
+
 func (m *Mux) onNotFound(ctx *RequestCtx) {
 	opts := &m.Opts
 
@@ -283,27 +380,49 @@ func (m *Mux) onNotFound(ctx *RequestCtx) {
 }
 
 func (m *Mux) Handle(ctx *RequestCtx) {
+	if m.Opts.Logger != nil {
+		ctx.logger = m.Opts.Logger
+	}
+	if m.Opts.Metrics != nil { // after recovering
+		defer m.Opts.Metrics.observe(ctx, time.Now())
+	}
+	served := false // the errors of the host mux are handled by itself
 	defer func() {
 		v := recover()
 		if v == nil {
 			v = ctx.err
-			if v == nil {
+			if v == nil || served {
 				return
 			}
 		}
+		ctx.recovered = true
 
 		if m.Opts.Recover != nil {
 			m.Opts.Recover(ctx, v)
 			return
 		}
 
-		log.Printf("sha.unhandled error: %v\n", v)
+		ctx.Logger().Error("sha.mux: unhandled error", "request_id", ctx.RequestID(), "err", v)
 
 		ctx.Response.SetStatusCode(StatusInternalServerError)
 		ctx.Response.ResetBody()
 		ctx.Response.Header().Reset()
 	}()
 
+	if len(m.hosts) > 0 {
+		if sub := m.hostMux(requestHost(ctx), ctx); sub != nil {
+			var h RequestCtxHandler = RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+				served = true
+				sub.Handle(ctx)
+			})
+			if len(m._MiddlewareNode.local) > 0 {
+				h = middlewaresWrap(m._MiddlewareNode.local, h)
+			}
+			h.Handle(ctx)
+			return
+		}
+	}
+
 	req := &ctx.Request
 	res := &ctx.Response
 
@@ -376,6 +495,40 @@ func (m *Mux) String() string {
 	return buf.String()
 }
 
+type MuxRoute struct {
+	Host    string `json:"host,omitempty"` // the pattern of `Mux.Host`
+	Name    string `json:"name,omitempty"` // see `RouteOptions.Name`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler,omitempty"`
+}
+
+// Routes returns the registered routes sorted by the path and the method, followed by the routes of the hosts sorted
+// by the host patterns. the auto `OPTIONS` handlers are excluded.
+func (m *Mux) Routes() []MuxRoute {
+	var routes []MuxRoute
+	for p, pm := range m.all {
+		for me, h := range pm {
+			routes = append(routes, MuxRoute{Name: m.routeName(me, p), Method: me, Path: p, Handler: h})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	for _, hr := range m.sortedHosts() {
+		for _, r := range hr.mux.Routes() {
+			if len(r.Host) < 1 {
+				r.Host = hr.pattern
+			}
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
 func NewMux(opts *MuxOptions) *Mux {
 	var defaultMuxOption = MuxOptions{
 		DoTrailingSlashRedirect: true,
@@ -387,9 +540,10 @@ func NewMux(opts *MuxOptions) *Mux {
 	}
 
 	mux := &Mux{
-		documents:   map[string]map[string]validator.Document{},
-		customTrees: map[string]*_RadixTree{},
-		all:         map[string]map[string]string{},
+		documents:       map[string]map[string]validator.Document{},
+		documentsLimits: map[string]map[string]string{},
+		customTrees:     map[string]*_RadixTree{},
+		all:             map[string]map[string]string{},
 	}
 
 	if opts == nil {
@@ -403,7 +557,9 @@ func NewMux(opts *MuxOptions) *Mux {
 
 	if opts.AutoCompress {
 		mux.Use(MiddlewareFunc(func(ctx *RequestCtx, next func()) {
-			ctx.AutoCompress()
+			if ctx.route == nil || ctx.route.Compression != CompressionDisabled {
+				ctx.AutoCompress()
+			}
 			next()
 		}))
 	}
@@ -0,0 +1,232 @@
+package sha
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zzztttkkk/sha/utils"
+)
+
+type _HostLabel struct {
+	literal  string
+	param    string
+	regex    *regexp.Regexp
+	wildcard bool
+}
+
+type _HostRoute struct {
+	pattern string
+	labels  []_HostLabel
+	params  int
+	mux     *Mux
+}
+
+var hostLabelReg = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// parseHostPattern parses the host pattern, the labels are separated by `.`:
+//
+//	`api.example.com`: the static host
+//	`{tenant}.example.com`: the param matches one label
+//	`{tenant:[a-z]+}.example.com`: the param matches one label by the regex
+//	`{sub:*}.example.com`: the first label only, the param matches one or more labels
+func parseHostPattern(pattern string) *_HostRoute {
+	hr := &_HostRoute{pattern: pattern}
+	v := strings.TrimSuffix(pattern, ".")
+	if len(v) < 1 {
+		panic(fmt.Errorf("sha.mux: empty host pattern"))
+	}
+
+	for len(v) > 0 {
+		var label string
+		if v[0] == '{' {
+			depth := 0
+			end := -1
+			for i := 0; i < len(v) && end < 0; i++ {
+				switch v[i] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+					if depth == 0 {
+						end = i
+					}
+				}
+			}
+			if end < 0 {
+				panic(fmt.Errorf("sha.mux: bad host pattern `%s`", pattern))
+			}
+			label = v[:end+1]
+			v = v[end+1:]
+		} else if ind := strings.IndexByte(v, '.'); ind >= 0 {
+			label = v[:ind]
+			v = v[ind:]
+		} else {
+			label = v
+			v = ""
+		}
+		if len(v) > 0 {
+			if v[0] != '.' || len(v) < 2 {
+				panic(fmt.Errorf("sha.mux: bad host pattern `%s`", pattern))
+			}
+			v = v[1:]
+		}
+
+		var hl _HostLabel
+		if label[0] != '{' {
+			label = strings.ToLower(label)
+			if !hostLabelReg.MatchString(label) {
+				panic(fmt.Errorf("sha.mux: bad host pattern `%s`", pattern))
+			}
+			hl.literal = label
+			hr.labels = append(hr.labels, hl)
+			continue
+		}
+
+		name := label[1 : len(label)-1]
+		if ind := strings.IndexByte(name, ':'); ind >= 0 {
+			expr := name[ind+1:]
+			name = name[:ind]
+			if expr == "*" {
+				if len(hr.labels) != 0 {
+					panic(fmt.Errorf("sha.mux: `{%s:*}` must be the first label of the host pattern `%s`", name, pattern))
+				}
+				hl.wildcard = true
+			} else {
+				hl.regex = regexp.MustCompile("^(?:" + expr + ")$")
+			}
+		}
+		if len(name) < 1 {
+			panic(fmt.Errorf("sha.mux: empty param name in the host pattern `%s`", pattern))
+		}
+		hl.param = name
+		hr.params++
+		hr.labels = append(hr.labels, hl)
+	}
+	return hr
+}
+
+// match matches the lowercase host without the port, the params are set to ctx if ctx is not nil.
+func (hr *_HostRoute) match(host string, ctx *RequestCtx) bool {
+	labels := strings.Split(host, ".")
+	offset := 0 // the count of the extra labels matched by the wildcard
+	if hr.labels[0].wildcard {
+		offset = len(labels) - len(hr.labels)
+		if offset < 0 {
+			return false
+		}
+	} else if len(labels) != len(hr.labels) {
+		return false
+	}
+
+	for i := 1; i < len(hr.labels); i++ {
+		if !hr.labels[i].matchLabel(labels[i+offset]) {
+			return false
+		}
+	}
+	first := labels[0]
+	if hr.labels[0].wildcard {
+		first = strings.Join(labels[:offset+1], ".")
+	} else if !hr.labels[0].matchLabel(first) {
+		return false
+	}
+
+	if ctx == nil || hr.params < 1 {
+		return true
+	}
+	params := &ctx.Request.URL.Params
+	if hr.labels[0].param != "" {
+		params.Set(hr.labels[0].param, utils.B(first))
+	}
+	for i := 1; i < len(hr.labels); i++ {
+		if hl := &hr.labels[i]; hl.param != "" {
+			params.Set(hl.param, utils.B(labels[i+offset]))
+		}
+	}
+	return true
+}
+
+func (hl *_HostLabel) matchLabel(v string) bool {
+	if len(v) < 1 {
+		return false
+	}
+	switch {
+	case hl.param == "":
+		return hl.literal == v
+	case hl.regex != nil:
+		return hl.regex.MatchString(v)
+	default:
+		return true
+	}
+}
+
+// Host returns a new mux serving the requests whose `Host` header matches the pattern, such as `api.example.com` and
+// `{tenant}.example.com`. the params of the pattern are stored in `URL.Params`. the new mux has its own middlewares,
+// `NoFound` and CORS of the options, and the requests of the unmatched hosts are served by m.
+// the requests of the host still pass the middlewares, the `Logger` and the `Metrics` of m, such as the request id, the
+// tracing and the access log, so the new mux should not repeat them. the `Logger` of the new mux overrides the one of m.
+func (m *Mux) Host(pattern string, opts *MuxOptions) *Mux {
+	sub := NewMux(opts)
+	m.AddHost(pattern, sub)
+	return sub
+}
+
+// AddHost serves the requests of the host pattern by sub, see `Mux.Host`. the static hosts are matched first, then
+// the patterns in the order of adding.
+func (m *Mux) AddHost(pattern string, sub *Mux) {
+	if sub == m {
+		panic(fmt.Errorf("sha.mux: bad host mux"))
+	}
+	hr := parseHostPattern(pattern)
+	hr.mux = sub
+	for _, v := range m.hosts {
+		if v.pattern == hr.pattern {
+			panic(fmt.Errorf("sha.mux: host `%s` is already registered", pattern))
+		}
+	}
+	m.hosts = append(m.hosts, hr)
+	if hr.params < 1 {
+		if m.staticHosts == nil {
+			m.staticHosts = map[string]*_HostRoute{}
+		}
+		m.staticHosts[strings.TrimSuffix(strings.ToLower(pattern), ".")] = hr
+	}
+}
+
+// requestHost returns the lowercase host of the request without the port and the trailing dot.
+func requestHost(ctx *RequestCtx) string {
+	v, ok := ctx.Request.Header().Get(HeaderHost)
+	if !ok || len(v) < 1 {
+		v = ctx.Request.URL.Host
+	}
+	host := utils.S(v)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// hostMux returns the mux of the matched host, or nil. the params are set to ctx if ctx is not nil.
+func (m *Mux) hostMux(host string, ctx *RequestCtx) *Mux {
+	if len(host) < 1 {
+		return nil
+	}
+	if hr := m.staticHosts[host]; hr != nil {
+		return hr.mux
+	}
+	for _, hr := range m.hosts {
+		if hr.params > 0 && hr.match(host, ctx) {
+			return hr.mux
+		}
+	}
+	return nil
+}
+
+// sortedHosts returns the host routes sorted by the patterns.
+func (m *Mux) sortedHosts() []*_HostRoute {
+	v := append([]*_HostRoute(nil), m.hosts...)
+	sort.Slice(v, func(i, j int) bool { return v[i].pattern < v[j].pattern })
+	return v
+}
@@ -0,0 +1,178 @@
+package sha
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zzztttkkk/sha/logx"
+	"github.com/zzztttkkk/sha/metrics"
+	"github.com/zzztttkkk/sha/utils"
+	"github.com/zzztttkkk/sha/validator"
+)
+
+func TestParseHostPattern(t *testing.T) {
+	for _, c := range []struct {
+		pattern string
+		host    string
+		ok      bool
+		params  string
+	}{
+		{"api.example.com", "api.example.com", true, ""},
+		{"API.Example.com.", "api.example.com", true, ""},
+		{"api.example.com", "www.example.com", false, ""},
+		{"{tenant}.example.com", "acme.example.com", true, "tenant=acme"},
+		{"{tenant}.example.com", "a.b.example.com", false, ""},
+		{"{tenant}.example.com", "example.com", false, ""},
+		{"{id:[0-9]+}.{region}.example.com", "12.eu.example.com", true, "id=12&region=eu"},
+		{"{id:[0-9]+}.{region}.example.com", "a12.eu.example.com", false, ""},
+		{"{sub:*}.example.com", "a.b.example.com", true, "sub=a.b"},
+		{"{sub:*}.example.com", "a.example.com", true, "sub=a"},
+		{"{sub:*}.example.com", "example.com", false, ""},
+	} {
+		hr := parseHostPattern(c.pattern)
+		ctx := &RequestCtx{}
+		ok := hr.match(c.host, ctx)
+		var params []string
+		ctx.Request.URL.Params.EachItem(func(item *utils.KvItem) bool {
+			params = append(params, string(item.Key)+"="+string(item.Val))
+			return true
+		})
+		if ok != c.ok || strings.Join(params, "&") != c.params {
+			t.Fatalf("%s %s: unexpected result %v %v", c.pattern, c.host, ok, params)
+		}
+	}
+
+	for _, pattern := range []string{"", "a..com", "{}.example.com", "a.{sub:*}.com", "{a}{b}.com", "a b.com"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%q: expected panic", pattern)
+				}
+			}()
+			parseHostPattern(pattern)
+		}()
+	}
+}
+
+func TestMux_Host(t *testing.T) {
+	// the middlewares, the logger and the metrics of the parent are applied to the requests of the hosts
+	m := NewMetrics(metrics.NewRegistry(), []float64{1})
+	var recovered int32
+	mux := NewMux(&MuxOptions{
+		Logger:  logx.Discard,
+		Metrics: m,
+		Recover: func(ctx *RequestCtx, v interface{}) {
+			atomic.AddInt32(&recovered, 1)
+			ctx.Response.SetStatusCode(StatusForbidden)
+		},
+	})
+	mux.Use(MiddlewareFunc(func(ctx *RequestCtx, next func()) {
+		ctx.Response.Header().SetString("X-Parent", "yes")
+		if string(ctx.Request.Path()) == "/denied" {
+			ctx.SetError(errors.New("denied"))
+			return
+		}
+		next()
+	}))
+	mux.HTTP(MethodGet, "/", RequestCtxHandlerFunc(func(ctx *RequestCtx) { _ = ctx.WriteString("default") }))
+	mux.HTTP(MethodGet, "/metrics", m.Handler())
+
+	api := mux.Host("api.example.com", &MuxOptions{
+		NoFound: func(ctx *RequestCtx) {
+			ctx.Response.SetStatusCode(StatusNotFound)
+			_ = ctx.WriteString("api not found")
+		},
+	})
+	api.Use(MiddlewareFunc(func(ctx *RequestCtx, next func()) {
+		ctx.Response.Header().SetString("X-Host", "api")
+		next()
+	}))
+	type Form struct {
+		Name string `vld:"name,optional"`
+	}
+	api.HTTPWithOptions(
+		&RouteOptions{Document: validator.NewDocument(Form{}, nil)},
+		MethodGet, "/users/{id}",
+		RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+			id, _ := ctx.Request.URL.Params.Get("id")
+			_ = ctx.WriteString("user " + string(id))
+		}),
+	)
+	api.HTTP(MethodGet, "/error", RequestCtxHandlerFunc(func(ctx *RequestCtx) { ctx.SetError(errors.New("oops")) }))
+
+	tenant := mux.Host("{tenant}.example.com", &MuxOptions{
+		CORS:             []*CorsOptions{{Name: "tenant", AllowMethods: "GET"}},
+		CORSOriginToName: func(origin []byte) string { return "tenant" },
+	})
+	tenant.HTTP(MethodGet, "/", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		v, _ := ctx.Request.URL.Params.Get("tenant")
+		_ = ctx.WriteString("tenant " + string(v))
+	}))
+
+	addr, stop := startHTTP11TestServer(t, mux, nil)
+	defer stop()
+
+	do := func(host, path string, header ...string) (*http.Response, string) {
+		req, _ := http.NewRequest(MethodGet, "http://"+addr+path, nil)
+		req.Host = host
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		v, _ := ioutil.ReadAll(res.Body)
+		return res, string(v)
+	}
+
+	if res, body := do("api.example.com:8080", "/users/12"); res.StatusCode != 200 || body != "user 12" ||
+		res.Header.Get("X-Host") != "api" || res.Header.Get("X-Parent") != "yes" {
+		t.Fatalf("unexpected response %d %s %v", res.StatusCode, body, res.Header)
+	}
+	// handled by the host mux only
+	if res, _ := do("api.example.com", "/error"); res.StatusCode != 500 || atomic.LoadInt32(&recovered) != 0 {
+		t.Fatalf("unexpected response %d %d", res.StatusCode, recovered)
+	}
+	if res, _ := do("api.example.com", "/denied"); res.StatusCode != 403 || atomic.LoadInt32(&recovered) != 1 {
+		t.Fatalf("unexpected response %d %d", res.StatusCode, recovered)
+	}
+	if _, body := do("localhost", "/metrics"); !strings.Contains(body, `sha_http_requests_total{method="GET",route="/users/{id}",status="200"} 1`+"\n") {
+		t.Fatalf("unexpected metrics %s", body)
+	}
+	if res, body := do("API.example.com", "/nothing"); res.StatusCode != 404 || body != "api not found" {
+		t.Fatalf("unexpected response %d %s", res.StatusCode, body)
+	}
+	if res, body := do("acme.example.com", "/", HeaderOrigin, "http://acme.example.com"); res.StatusCode != 200 ||
+		body != "tenant acme" || res.Header.Get(HeaderAccessControlAllowOrigin) != "http://acme.example.com" {
+		t.Fatalf("unexpected response %d %s %v", res.StatusCode, body, res.Header)
+	}
+	if res, body := do("localhost", "/", HeaderOrigin, "http://acme.example.com"); res.StatusCode != 200 ||
+		body != "default" || res.Header.Get(HeaderAccessControlAllowOrigin) != "" {
+		t.Fatalf("unexpected response %d %s", res.StatusCode, body)
+	}
+	if res, body := do("localhost", "/users/12"); res.StatusCode != 404 || body == "api not found" {
+		t.Fatalf("unexpected response %d %s", res.StatusCode, body)
+	}
+
+	if _, body := do("localhost", "/docs"); !strings.Contains(body, "# Host: api.example.com\n") || !strings.Contains(body, "## Path: /users/{id}\n") {
+		t.Fatalf("unexpected documents %s", body)
+	}
+	if _, body := do("localhost", "/docs?host=%7Btenant%7D.example.com"); strings.Contains(body, "/users/{id}") ||
+		!strings.Contains(body, "# Host: {tenant}.example.com\n") {
+		t.Fatalf("unexpected documents %s", body)
+	}
+
+	found := map[string]bool{}
+	for _, r := range mux.Routes() {
+		found[r.Host+" "+r.Method+" "+r.Path] = true
+	}
+	if !found[" GET /"] || !found["api.example.com GET /users/{id}"] || !found["{tenant}.example.com GET /"] {
+		t.Fatalf("unexpected routes %v", mux.Routes())
+	}
+}
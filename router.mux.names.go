@@ -0,0 +1,134 @@
+package sha
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type _PatternPart struct {
+	literal  string
+	param    string
+	regex    *regexp.Regexp
+	wildcard bool
+}
+
+type _NamedRoute struct {
+	method  string
+	pattern string
+	parts   []_PatternPart
+}
+
+// parseRoutePattern splits the path pattern of the radix tree into the literals and the params, such as
+// `/users/{id:[0-9]+}/files/{filepath:*}`.
+func parseRoutePattern(pattern string) []_PatternPart {
+	var parts []_PatternPart
+	v := pattern
+	for len(v) > 0 {
+		start := strings.IndexByte(v, '{')
+		if start < 0 {
+			parts = append(parts, _PatternPart{literal: v})
+			break
+		}
+		if start > 0 {
+			parts = append(parts, _PatternPart{literal: v[:start]})
+		}
+
+		depth := 0
+		end := -1
+		for i := start; i < len(v) && end < 0; i++ {
+			switch v[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			panic(fmt.Errorf("sha.mux: bad path pattern `%s`", pattern))
+		}
+
+		part := _PatternPart{param: v[start+1 : end]}
+		if ind := strings.IndexByte(part.param, ':'); ind >= 0 {
+			expr := part.param[ind+1:]
+			part.param = part.param[:ind]
+			if expr == "*" {
+				part.wildcard = true
+			} else {
+				part.regex = regexp.MustCompile("^(?:" + expr + ")$")
+			}
+		}
+		parts = append(parts, part)
+		v = v[end+1:]
+	}
+	return parts
+}
+
+// name registers the named route, it panics if the name is already used.
+func (m *Mux) name(name, method, pattern string) {
+	if m.names == nil {
+		m.names = map[string]*_NamedRoute{}
+	}
+	if v := m.names[name]; v != nil {
+		panic(fmt.Errorf("sha.mux: route name `%s` is already used by `%s %s`", name, v.method, v.pattern))
+	}
+	m.names[name] = &_NamedRoute{method: method, pattern: pattern, parts: parseRoutePattern(pattern)}
+}
+
+// routeName returns the name of the route, or empty.
+func (m *Mux) routeName(method, pattern string) string {
+	for name, v := range m.names {
+		if v.method == method && v.pattern == pattern {
+			return name
+		}
+	}
+	return ""
+}
+
+// URLFor builds the path of the route named by `RouteOptions.Name`, the prefixes of the mux and the groups are
+// included. the params are escaped and then validated by the regexes of the segments, the same as the router matching
+// them. the wildcard param, such as `{filepath:*}`, keeps the `/`. the query is appended if it is not empty.
+func (m *Mux) URLFor(name string, params map[string]string, query url.Values) (string, error) {
+	route := m.names[name]
+	if route == nil {
+		return "", fmt.Errorf("sha.mux: unknown route name `%s`", name)
+	}
+
+	var buf strings.Builder
+	for i := range route.parts {
+		part := &route.parts[i]
+		if len(part.param) < 1 {
+			buf.WriteString(part.literal)
+			continue
+		}
+
+		v, ok := params[part.param]
+		if !ok {
+			return "", fmt.Errorf("sha.mux: missing param `%s` of route `%s`", part.param, name)
+		}
+		if part.wildcard {
+			segments := strings.Split(strings.TrimPrefix(v, "/"), "/")
+			for j, s := range segments {
+				segments[j] = url.PathEscape(s)
+			}
+			buf.WriteString(strings.Join(segments, "/"))
+			continue
+		}
+
+		v = url.PathEscape(v)
+		if len(v) < 1 || (part.regex != nil && !part.regex.MatchString(v)) {
+			return "", fmt.Errorf("sha.mux: bad param `%s` of route `%s`", part.param, name)
+		}
+		buf.WriteString(v)
+	}
+
+	if len(query) > 0 {
+		buf.WriteByte('?')
+		buf.WriteString(query.Encode())
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,91 @@
+package sha
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/zzztttkkk/sha/logx"
+)
+
+func TestMux_URLFor(t *testing.T) {
+	mux := NewMux(&MuxOptions{Prefix: "/api", Logger: logx.Discard})
+	echo := RequestCtxHandlerFunc(func(ctx *RequestCtx) { _ = ctx.WriteString(ctx.RouteName()) })
+
+	mux.HTTPWithOptions(&RouteOptions{Name: "user"}, MethodGet, "/users/{id:[0-9]+}", echo)
+	group := mux.NewGroup("/v2").NewGroup("/admin")
+	group.HTTPWithOptions(&RouteOptions{Name: "post"}, MethodGet, "/posts/{slug}/comments/{cid}", echo)
+	mux.HTTPWithOptions(&RouteOptions{Name: "code"}, MethodGet, "/codes/{code:[a-z]{3}}.json", echo)
+	mux.HTTPWithOptions(&RouteOptions{Name: "static"}, MethodGet, "/static/{filepath:*}", echo)
+
+	for _, c := range []struct {
+		name     string
+		params   map[string]string
+		query    url.Values
+		expected string
+	}{
+		{"user", map[string]string{"id": "12"}, nil, "/api/users/12"},
+		{"user", map[string]string{"id": "12"}, url.Values{"b": {"2"}, "a": {"x y"}}, "/api/users/12?a=x+y&b=2"},
+		{"post", map[string]string{"slug": "hello world", "cid": "7"}, nil, "/api/v2/admin/posts/hello%20world/comments/7"},
+		{"code", map[string]string{"code": "abc"}, nil, "/api/codes/abc.json"},
+		{"static", map[string]string{"filepath": "/css/a b.css"}, nil, "/api/static/css/a%20b.css"},
+		{"static", map[string]string{"filepath": ""}, nil, "/api/static/"},
+	} {
+		v, err := mux.URLFor(c.name, c.params, c.query)
+		if err != nil || v != c.expected {
+			t.Fatalf("%s: unexpected url %q %v", c.name, v, err)
+		}
+	}
+
+	for _, c := range []struct {
+		name   string
+		params map[string]string
+	}{
+		{"nothing", nil},
+		{"user", nil},
+		{"user", map[string]string{"id": "a1"}},
+		{"post", map[string]string{"slug": "", "cid": "7"}},
+		{"code", map[string]string{"code": "abcd"}},
+	} {
+		if v, err := mux.URLFor(c.name, c.params, nil); err == nil {
+			t.Fatalf("%s %v: expected error, got %q", c.name, c.params, v)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		mux.HTTPWithOptions(&RouteOptions{Name: "user"}, MethodPost, "/users", echo)
+	}()
+
+	addr, stop := startHTTP11TestServer(t, mux, nil)
+	defer stop()
+	for _, name := range []string{"user", "post", "code", "static"} {
+		params := map[string]string{"id": "3", "slug": "s", "cid": "4", "code": "xyz", "filepath": "a/b.txt"}
+		v, err := mux.URLFor(name, params, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.Get("http://" + addr + v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if res.StatusCode != 200 || string(body) != name {
+			t.Fatalf("%s %s: unexpected response %d %s", name, v, res.StatusCode, body)
+		}
+	}
+
+	found := map[string]bool{}
+	for _, r := range mux.Routes() {
+		found[r.Name+" "+r.Path] = true
+	}
+	if !found["user /api/users/{id:[0-9]+}"] || !found["post /api/v2/admin/posts/{slug}/comments/{cid}"] {
+		t.Fatalf("unexpected routes %v", mux.Routes())
+	}
+}
@@ -3,7 +3,11 @@ package sha
 import (
 	"fmt"
 	"github.com/zzztttkkk/sha/utils"
+	"github.com/zzztttkkk/sha/validator"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -82,3 +86,86 @@ func TestMux(t *testing.T) {
 	fmt.Print(mux)
 	ListenAndServe("", mux)
 }
+
+func TestMux_SlowHandler(t *testing.T) {
+	mux := NewMux(&MuxOptions{AutoHandleDocs: false, AutoCompress: true})
+	handler := RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		ctx.Response.Header().SetString("X-Partial", "1")
+		_ = ctx.WriteString("partial")
+		<-ctx.Done()
+	})
+	mux.HTTPWithOptions(&RouteOptions{SlowHandlerTimeout: time.Millisecond * 50}, MethodGet, "/timeout", handler)
+	mux.HTTPWithOptions(
+		&RouteOptions{SlowHandlerTimeout: time.Millisecond * 50, SlowHandlerStatus: StatusGatewayTimeout},
+		MethodGet, "/gateway", handler,
+	)
+	mux.HTTPWithOptions(&RouteOptions{SlowHandlerTimeout: time.Second}, MethodGet, "/fast", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_ = ctx.WriteString("ok")
+	}))
+	addr, stop := startHTTP11TestServer(t, mux, nil)
+	defer stop()
+
+	for path, sc := range map[string]int{"/timeout": StatusServiceUnavailable, "/gateway": StatusGatewayTimeout, "/fast": StatusOK} {
+		res, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if res.StatusCode != sc || len(res.Header.Get("X-Partial")) > 0 || (sc == StatusOK) != (string(data) == "ok") {
+			t.Fatalf("%s: unexpected response %d %v %q", path, res.StatusCode, res.Header, data)
+		}
+	}
+}
+
+func TestMux_RouteLimits(t *testing.T) {
+	mux := NewMux(&MuxOptions{AutoHandleDocs: true, AutoCompress: true})
+	echo := RequestCtxHandlerFunc(func(ctx *RequestCtx) { _, _ = ctx.Write(ctx.Request.BodyRaw()) })
+	mux.HTTPWithOptions(
+		&RouteOptions{
+			MaxBodySize: 16, ReadTimeout: time.Millisecond * 200, Compression: CompressionDisabled,
+			Document: validator.NewDocument(nil, nil),
+		},
+		MethodPost, "/small", echo,
+	)
+	mux.HTTP(MethodPost, "/default", echo)
+	addr, stop := startHTTP11TestServer(t, mux, nil)
+	defer stop()
+
+	body := strings.Repeat("a", 32)
+	for path, sc := range map[string]int{"/small": StatusRequestEntityTooLarge, "/default": StatusOK} {
+		req, _ := http.NewRequest(MethodPost, "http://"+addr+path, strings.NewReader(body))
+		req.Header.Set(HeaderAcceptEncoding, "gzip")
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != sc || (sc == StatusOK) != (res.Header.Get(HeaderContentEncoding) == "gzip") {
+			t.Fatalf("%s: unexpected response %d %v", path, res.StatusCode, res.Header)
+		}
+	}
+
+	// the body is not completed in the read timeout of the route
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("POST /small HTTP/1.1\r\nHost: a\r\nContent-Length: 8\r\n\r\nab"))
+	begin := time.Now()
+	_ = conn.SetReadDeadline(begin.Add(time.Second * 3))
+	if _, err := ioutil.ReadAll(conn); err != nil || time.Since(begin) > time.Second {
+		t.Fatalf("the connection is not closed by the read timeout, %v", err)
+	}
+
+	res, err := http.Get("http://" + addr + "/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if !strings.Contains(string(data), "#### Limits:\r\n- MaxBodySize: 16\r\n- ReadTimeout: 200ms\r\n- Compression: disabled\r\n") {
+		t.Fatalf("unexpected documents %q", data)
+	}
+}
@@ -2,7 +2,6 @@ package sha
 
 import (
 	"github.com/zzztttkkk/sha/internal"
-	"log"
 	"net/http"
 	"reflect"
 )
@@ -20,7 +19,7 @@ func init() {
 	serverPrepareFunc = append(
 		serverPrepareFunc,
 		func(server *Server) {
-			_, ok := server.Handler.(*Mux)
+			_, ok := unwrapHandler(server.Handler).(*Mux)
 			if !ok {
 				return
 			}
@@ -45,6 +44,35 @@ var (
 	InternalServerErrorMessage = `<h1>Oops, an unknown internal server error occurred.`
 )
 
+// recoverStatusCode returns the status code set by `defaultRecover` for the panic value or the error of
+// `RequestCtx.SetError`, such as the redirections and `StatusError`.
+func recoverStatusCode(v interface{}) int {
+	if err, ok := v.(error); ok && reflect.TypeOf(err).Comparable() {
+		if sc := internal.ErrorStatusByValue[err]; sc != 0 {
+			return sc
+		}
+	}
+	if he, ok := v.(HTTPError); ok {
+		return he.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
+
+// responseStatusCode returns the status code of the response, including the one which will be set by the recover of
+// `Mux` for v, the recovered panic, or the error not handled yet. it is used by the middlewares of `Mux.Use`.
+func (ctx *RequestCtx) responseStatusCode(v interface{}) int {
+	if v == nil && !ctx.recovered {
+		v = ctx.err
+	}
+	if v != nil {
+		return recoverStatusCode(v)
+	}
+	if sc := ctx.Response.statusCode; sc != 0 {
+		return sc
+	}
+	return http.StatusOK
+}
+
 func defaultRecover(ctx *RequestCtx, v interface{}) {
 	ctx.Response.ResetBody()
 	ctx.Response.Header().Del(HeaderContentType)
@@ -89,6 +117,9 @@ func defaultRecover(ctx *RequestCtx, v interface{}) {
 	}
 
 	if logStack {
-		log.Print(internal.LoadCallersFrames(v, CallersFramesSkip, CallersFramesSize))
+		ctx.Logger().Error(
+			"sha.mux: panic recovered",
+			"request_id", ctx.RequestID(), "stack", internal.LoadCallersFrames(v, CallersFramesSkip, CallersFramesSize),
+		)
 	}
 }
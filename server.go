@@ -3,35 +3,48 @@ package sha
 import (
 	"context"
 	"crypto/tls"
-	"log"
+	"io/ioutil"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/zzztttkkk/sha/internal"
+	"github.com/zzztttkkk/sha/logx"
 	"github.com/zzztttkkk/sha/utils"
 	"github.com/zzztttkkk/websocket"
 	"golang.org/x/crypto/acme/autocert"
 )
 
 type ServerOptions struct {
-	Addr string `json:"addr" toml:"addr"`
-	TLS  struct {
-		AutoCertDomains []string `json:"auto_cert_domains" toml:"auto-cert-domains"`
-		Key             string   `json:"key" toml:"key"`
-		Cert            string   `json:"cert" toml:"cert"`
-	} `json:"tls" toml:"tls"`
+	// tcp, tcp4, tcp6 or unix
+	Network string     `json:"network" toml:"network"`
+	Addr    string     `json:"addr" toml:"addr"`
+	TLS     TLSOptions `json:"tls" toml:"tls"`
+	// extra listeners, all of them share the same handler and lifecycle
+	Listeners []ListenerOptions `json:"listeners" toml:"listeners"`
 
 	MaxConnectionKeepAlive utils.TomlDuration `json:"max_connection_keep_alive" toml:"max-connection-keep-alive"`
 	ReadTimeout            utils.TomlDuration `json:"read_timeout" toml:"read-timeout"`
 	IdleTimeout            utils.TomlDuration `json:"idle_timeout" toml:"idle-timeout"`
 	WriteTimeout           utils.TomlDuration `json:"write_timeout" toml:"write-timeout"`
 
+	// parse the proxy protocol header before tls handshake, see `RequestCtx.RemoteAddr`
+	ProxyProtocol ProxyProtocolOptions `json:"proxy_protocol" toml:"proxy-protocol"`
+	// CIDRs of the reverse proxies, see `RequestCtx.ClientIP`
+	TrustedProxies []string `json:"trusted_proxies" toml:"trusted-proxies"`
+	// connection and concurrency limits, see `Server.Stats`
+	Limits LimitOptions `json:"limits" toml:"limits"`
+
 	GracefullyShutdown bool   `json:"graceful_shutdown" toml:"graceful_shutdown"` //shut down until all connections are closed
 	Pid                string `json:"pid" toml:"pid"`                             //pid file path
+	// the deadline of the graceful shutdown caused by the done context or restarting. zero means no deadline.
+	ShutdownTimeout utils.TomlDuration `json:"shutdown_timeout" toml:"shutdown-timeout"`
+
+	// zero-downtime restart by passing the listeners to a new process
+	Restart RestartOptions `json:"restart" toml:"restart"`
 }
 
 type Server struct {
@@ -41,6 +54,18 @@ type Server struct {
 	OnNewRequestCtx  func(req *RequestCtx) bool
 	OnConnectionLost func(conn net.Conn)
 
+	// OnParseError is called before closing the connection which sends a malformed or slow request, the error can be
+	// `ErrHeaderReadTimeout`, `ErrBodyReadTimeout`, `ErrTransferRateTooLow`, `ErrTooManyHeaders` and so on.
+	OnParseError func(conn net.Conn, err error)
+
+	// OnExpectContinue is called before reading the body of the request which has `Expect: 100-continue`,
+	// return a non-100 status code, such as 413 or 417, to reject the request.
+	OnExpectContinue func(ctx *RequestCtx) int
+
+	// the logger of the lifecycle messages, and the default logger of the requests, see `RequestCtx.Logger`.
+	// nil means `logx.Default()`.
+	Logger logx.Logger
+
 	baseCtx           context.Context
 	Handler           RequestCtxHandler
 	httpProtocol      HTTPServerProtocol
@@ -49,18 +74,34 @@ type Server struct {
 	tls   *tls.Config
 	isTLS bool
 
+	trustedProxies []*net.IPNet
+
 	// lifecycle
 	beforeAccept   []func(s *Server)
 	beforeShutdown []func(s *Server)
+	beforeDrain    []func(ctx context.Context, s *Server)
+	shuttingDown   int32
 	aliveConns     int64
-	runningFlag    bool
-	listener       net.Listener
-	shutdownOnce   sync.Once
-	shutdownChan   *chan struct{}
+	counters       _ServerCounters
+	running        int32
+	listeners      []*_Listener
+	restartMutex   sync.Mutex
+
+	lifecycleOnce sync.Once
+	connsMutex    sync.Mutex
+	conns         map[*_ConnTracker]struct{}
+	drained       chan struct{}
+	drainedClosed bool
+	shutdownOnce  sync.Once
+	finishOnce    sync.Once
+	done          chan struct{}
 
 	pool *RequestCtxPool
 }
 
+func (s *Server) logger() logx.Logger { return logx.Or(s.Logger) }
+
+// IsTLS reports whether any listener of the server is serving tls, see `RequestCtx.IsTLS` for the connection.
 func (s *Server) IsTLS() bool { return s.isTLS }
 
 type HTTPServerProtocol interface {
@@ -84,11 +125,18 @@ var serverPrepareFunc []func(s *Server)
 
 func New(ctx context.Context, pool *RequestCtxPool, opt *ServerOptions) *Server {
 	var defaultServerOption = ServerOptions{
+		Network:                "tcp4",
 		Addr:                   "127.0.0.1:5986",
 		MaxConnectionKeepAlive: utils.TomlDuration{Duration: time.Minute * 5},
 		ReadTimeout:            utils.TomlDuration{Duration: time.Second * 10},
 		IdleTimeout:            utils.TomlDuration{Duration: time.Second * 30},
 		WriteTimeout:           utils.TomlDuration{Duration: time.Second * 10},
+		ProxyProtocol: ProxyProtocolOptions{
+			HeaderTimeout: utils.TomlDuration{Duration: time.Second * 5},
+		},
+		Restart: RestartOptions{
+			ReadyTimeout: utils.TomlDuration{Duration: time.Second * 30},
+		},
 	}
 
 	s := &Server{baseCtx: ctx}
@@ -109,6 +157,18 @@ func (s *Server) BeforeShutdown(fn func(server *Server)) {
 	s.beforeShutdown = append(s.beforeShutdown, fn)
 }
 
+// BeforeDrain appends a hook which is called when `Shutdown` starts, before the listeners are closed and the
+// connections are drained. the listeners are kept open until all the hooks return, such as waiting for the load
+// balancers to stop sending the new requests. ctx is the one passed to `Shutdown`, the hooks should return when it
+// is done.
+func (s *Server) BeforeDrain(fn func(ctx context.Context, server *Server)) {
+	s.beforeDrain = append(s.beforeDrain, fn)
+}
+
+// ShuttingDown reports whether `Shutdown` is called.
+func (s *Server) ShuttingDown() bool { return atomic.LoadInt32(&s.shuttingDown) == 1 }
+
+// SetHTTPProtocol sets the protocol of the connections, it must be called before `Serve`.
 func (s *Server) SetHTTPProtocol(protocol HTTPServerProtocol) { s.httpProtocol = protocol }
 
 func (s *Server) SetWebSocketProtocol(protocol WebSocketProtocol) { s.websocketProtocol = protocol }
@@ -127,82 +187,118 @@ func (s *Server) Listen() net.Listener {
 	if s.Handler == nil {
 		s.Handler = RequestCtxHandlerFunc(func(ctx *RequestCtx) { _ = ctx.WriteString("Hello World!\n") })
 	}
-
-	listener, err := net.Listen("tcp4", s.Options.Addr)
-	if err != nil {
-		panic(err)
-	}
-	return listener
+	return s.listen(&ListenerOptions{Network: s.Options.Network, Addr: s.Options.Addr})
 }
 
 func (s *Server) enableTLS(l net.Listener, certFile, keyFile string) net.Listener {
 	if certFile == "" || keyFile == "" {
 		panic("sha: empty tls file")
 	}
-
-	if s.tls == nil {
-		s.tls = &tls.Config{}
-	}
-
-	if !internal.StrSliceContains(s.tls.NextProtos, "http/1.1") {
-		s.tls.NextProtos = append(s.tls.NextProtos, "http/1.1")
-	}
-	configHasCert := len(s.tls.Certificates) > 0 || s.tls.GetCertificate != nil
-	if !configHasCert {
-		var err error
-		s.tls.Certificates = make([]tls.Certificate, 1)
-		s.tls.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
-		if err != nil {
-			panic(err)
-		}
-	}
-	return tls.NewListener(l, s.tls)
+	s.tls = s.tlsConfig(s.tls, certFile, keyFile)
+	return &_Listener{Listener: l, tls: s.tls}
 }
 
-func (s *Server) Shutdown() {
+// Shutdown stops accepting, closes the idle connections and lets the in-flight requests finish with
+// `Connection: close`. if `ServerOptions.GracefullyShutdown` is false, it does not wait for the connections.
+// when ctx is done, the rest connections are force closed and a `*ShutdownError` is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lifecycle()
 	s.shutdownOnce.Do(func() {
-		sc := make(chan struct{}, 1)
-		s.shutdownChan = &sc
-
-		s.runningFlag = false
-		_ = s.listener.Close()
-
-		if s.Options.GracefullyShutdown {
-			if s.aliveConns > 0 {
-				log.Printf(
-					"sha.server: shutdown waiting, alive connections(%d); Pid: %d\r\n",
-					s.aliveConns, os.Getpid(),
-				)
-			}
-			for {
-				if atomic.LoadInt64(&s.aliveConns) < 1 {
-					break
-				} else {
-					time.Sleep(time.Millisecond * 100)
-				}
-			}
+		atomic.StoreInt32(&s.shuttingDown, 1)
+		for _, fn := range s.beforeDrain {
+			fn(ctx, s)
+		}
+		atomic.StoreInt32(&s.running, 0) // stop the accept loops before closing the listeners
+		for _, l := range s.listeners {
+			_ = l.Close()
+		}
+		s.stopConns()
+		if s.Options.GracefullyShutdown && atomic.LoadInt64(&s.aliveConns) > 0 {
+			s.logger().Info(
+				"sha.server: shutdown waiting",
+				"alive_connections", atomic.LoadInt64(&s.aliveConns), "pid", os.Getpid(),
+			)
 		}
+	})
+
+	var err error
+	if s.Options.GracefullyShutdown {
+		select {
+		case <-s.drained:
+		case <-s.done:
+		case <-ctx.Done():
+			err = s.forceCloseConns(ctx.Err())
+		}
+	}
 
+	s.finishOnce.Do(func() {
 		for _, fn := range s.beforeShutdown {
 			fn(s)
 		}
 		if len(s.Options.Pid) > 0 {
-			if e := os.Remove(s.Options.Pid); e != nil {
-				log.Printf("sha.server: shutdown error, %s\r\n", e.Error())
+			// the pid file may be rewritten by the restarted process
+			if v, e := ioutil.ReadFile(s.Options.Pid); e != nil || string(v) == strconv.Itoa(os.Getpid()) {
+				if e = os.Remove(s.Options.Pid); e != nil {
+					s.logger().Error("sha.server: shutdown error", "err", e, "pid", os.Getpid())
+				}
 			}
 		}
-		log.Printf("sha.server: shutdown done; Pid: %d\r\n", os.Getpid())
-		sc <- struct{}{}
+		if err != nil {
+			s.logger().Warn("sha.server: shutdown aborted", "err", err, "pid", os.Getpid())
+		}
+		s.logger().Info("sha.server: shutdown done", "pid", os.Getpid())
+		close(s.done)
 	})
+	return err
+}
+
+// shutdownWithTimeout shuts down the server with `ServerOptions.ShutdownTimeout`.
+func (s *Server) shutdownWithTimeout() {
+	ctx := context.Background()
+	if timeout := s.Options.ShutdownTimeout.Duration; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	_ = s.Shutdown(ctx)
 }
 
+// Serve serves the listener and the listeners added by `AddListener` or `ServerOptions.Listeners`,
+// blocks until all of them are closed by `Shutdown`. l can be nil if the server only has added listeners.
 func (s *Server) Serve(l net.Listener) {
-	s.listener = l
-	s.runningFlag = true
+	if sl, ok := l.(*_Listener); ok {
+		s.listeners = append([]*_Listener{sl}, s.listeners...)
+	} else if l != nil {
+		s.listeners = append([]*_Listener{{Listener: l}}, s.listeners...)
+	}
+	for _, il := range takeRestInheritedListeners() {
+		s.logger().Warn("sha.server: serving the unmatched inherited listener", "addr", il.Addr().String())
+		if s.Options.ProxyProtocol.Enabled {
+			il = newProxyProtocolListener(il, &s.Options.ProxyProtocol)
+		}
+		s.listeners = append(s.listeners, &_Listener{Listener: il})
+	}
+	if len(s.listeners) < 1 {
+		panic("sha: empty listeners")
+	}
+	for _, sl := range s.listeners {
+		if sl.tls != nil {
+			s.isTLS = true
+		}
+	}
+	s.lifecycle()
+	atomic.StoreInt32(&s.running, 1)
 
 	if s.httpProtocol == nil {
 		s.httpProtocol = newHTTP11Protocol(s.pool)
 	}
+	for _, sl := range s.listeners {
+		if sl.tls != nil {
+			sl.tls = s.alpnConfig(sl.tls)
+		}
+	}
+
+	s.trustedProxies = parseCIDRs(s.Options.TrustedProxies)
 
 	if s.websocketProtocol == nil {
 		s.websocketProtocol = NewWebSocketProtocol(nil)
@@ -216,21 +312,16 @@ func (s *Server) Serve(l net.Listener) {
 	}
 	s.baseCtx = context.WithValue(s.baseCtx, CtxKeyServer, s)
 
-	var tempDelay time.Duration
-	serve := s.serveHTTPConn
-	if s.isTLS {
-		serve = s.serveTLS
-	}
-
 	go func() {
-		<-s.baseCtx.Done()
-		s.Shutdown()
+		select {
+		case <-s.baseCtx.Done():
+			s.shutdownWithTimeout()
+		case <-s.done:
+		}
 	}()
 
-	maxKeepAlive := s.Options.MaxConnectionKeepAlive.Duration
-
 	if len(s.Options.Pid) > 0 {
-		pid, e := os.OpenFile(s.Options.Pid, os.O_CREATE|os.O_WRONLY, 0600)
+		pid, e := os.OpenFile(s.Options.Pid, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 		if e != nil {
 			panic(e)
 		}
@@ -238,15 +329,53 @@ func (s *Server) Serve(l net.Listener) {
 		_ = pid.Close()
 	}
 
-	log.Printf("sha.server: listening @ `%s`, Pid: %d\r\n", s.Options.Addr, os.Getpid())
+	var wg sync.WaitGroup
+	for _, sl := range s.listeners {
+		wg.Add(1)
+		go func(sl *_Listener) {
+			defer wg.Done()
+			s.accept(sl)
+		}(sl)
+	}
+	notifyRestartReady()
+
+	if s.Options.Restart.Enabled && restartSignal != nil {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, restartSignal)
+		defer func() {
+			signal.Stop(signals)
+			close(signals)
+		}()
+		go func() {
+			for range signals {
+				if err := s.Restart(); err != nil {
+					s.logger().Error("sha.server: restart error", "err", err, "pid", os.Getpid())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	<-s.done
+	s.logger().Info("sha.server: stop", "pid", os.Getpid())
+}
+
+func (s *Server) accept(l *_Listener) {
+	s.logger().Info(
+		"sha.server: listening",
+		"network", l.Addr().Network(), "addr", l.Addr().String(), "pid", os.Getpid(),
+	)
 
-	for s.runningFlag {
+	var tempDelay time.Duration
+	maxKeepAlive := s.Options.MaxConnectionKeepAlive.Duration
+
+	for s.isRunning() {
 		conn, err := l.Accept()
 		if err != nil {
-			if !s.runningFlag {
+			if !s.isRunning() {
 				break
 			}
-			log.Printf("sha.server: bad connection: %s\n", err.Error())
+			s.logger().Warn("sha.server: accept error", "err", err)
 			if ne, ok := err.(net.Error); ok && ne.Temporary() {
 				if tempDelay == 0 {
 					tempDelay = 5 * time.Millisecond
@@ -260,46 +389,64 @@ func (s *Server) Serve(l net.Listener) {
 			}
 			continue
 		}
+		tempDelay = 0
+
+		if !s.acquireConn() {
+			s.rejectConn(conn, l)
+			continue
+		}
 
 		if maxKeepAlive > 0 {
 			_ = conn.SetDeadline(time.Now().Add(maxKeepAlive))
 		}
 
 		go func(c net.Conn) {
+			defer s.releaseConn()
+
+			if pc, ok := c.(*_ProxyProtocolConn); ok && !pc.ready() {
+				_ = c.Close()
+				return
+			}
+			ipKey, ok := s.acquireIP(c)
+			if !ok {
+				s.rejectConn(c, l)
+				return
+			}
+			defer s.releaseIP(ipKey)
+
 			if s.OnNewConnection != nil && !s.OnNewConnection(c) {
 				return
 			}
 
-			atomic.AddInt64(&s.aliveConns, 1)
+			tracker := s.trackConn(c)
 			defer func() {
 				_ = c.Close()
-				atomic.AddInt64(&s.aliveConns, -1)
+				s.untrackConn(tracker)
 				if s.OnConnectionLost != nil {
 					s.OnConnectionLost(c)
 				}
 			}()
 
-			serve(c)
+			if l.tls != nil || isTLSConn(c) {
+				s.serveTLS(c, l.tls, tracker)
+				return
+			}
+			s.serveHTTPConn(c, tracker)
 		}(conn)
 	}
-
-	// waiting for shutdown
-	for s.shutdownChan == nil {
-		s.Shutdown()
-	}
-	<-(*s.shutdownChan)
-	log.Printf("sha.server: stop @ `%s`, Pid: %d\r\n", s.Options.Addr, os.Getpid())
 }
 
 func (s *Server) ListenAndServe() {
+	for i := range s.Options.Listeners {
+		s.ListenWith(&s.Options.Listeners[i])
+	}
+
 	if len(s.Options.TLS.AutoCertDomains) > 0 {
-		s.isTLS = true
 		s.Serve(autocert.NewListener(s.Options.TLS.AutoCertDomains...))
 		return
 	}
 
 	if len(s.Options.TLS.Cert) > 0 {
-		s.isTLS = true
 		s.Serve(s.enableTLS(s.Listen(), s.Options.TLS.Cert, s.Options.TLS.Key))
 		return
 	}
@@ -307,10 +454,10 @@ func (s *Server) ListenAndServe() {
 	s.Serve(s.Listen())
 }
 
-func (s *Server) serveTLS(conn net.Conn) {
+func (s *Server) serveTLS(conn net.Conn, conf *tls.Config, tracker *_ConnTracker) {
 	tlsConn, ok := conn.(*tls.Conn)
 	if !ok {
-		return
+		tlsConn = tls.Server(conn, conf)
 	}
 
 	var err error
@@ -326,12 +473,17 @@ func (s *Server) serveTLS(conn net.Conn) {
 	}
 	switch tlsConn.ConnectionState().NegotiatedProtocol {
 	case "", "http/1.0", "http/1.1":
-		s.serveHTTPConn(tlsConn)
+		s.serveHTTPConn(tlsConn, tracker)
+	case http2NextProto:
+		if isHTTP2Protocol(s.httpProtocol) {
+			s.serveHTTPConn(tlsConn, tracker)
+		}
 	}
 }
 
-func (s *Server) serveHTTPConn(conn net.Conn) {
-	s.httpProtocol.ServeConn(context.WithValue(s.baseCtx, CtxKeyConnection, conn), conn)
+func (s *Server) serveHTTPConn(conn net.Conn, tracker *_ConnTracker) {
+	ctx := context.WithValue(context.WithValue(s.baseCtx, CtxKeyConnection, conn), _CtxKeyConnTracker{}, tracker)
+	s.httpProtocol.ServeConn(ctx, conn)
 }
 
 func ListenAndServe(addr string, handler RequestCtxHandler) {
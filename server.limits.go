@@ -0,0 +1,164 @@
+package sha
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zzztttkkk/sha/utils"
+)
+
+type LimitOptions struct {
+	// zero means unlimited
+	MaxConnections      int64 `json:"max_connections" toml:"max-connections"`
+	MaxConnectionsPerIP int64 `json:"max_connections_per_ip" toml:"max-connections-per-ip"`
+	MaxInFlightRequests int64 `json:"max_in_flight_requests" toml:"max-in-flight-requests"`
+	// close the connection or the http2 stream immediately instead of responding 503 when overloaded
+	CloseOnOverload bool `json:"close_on_overload" toml:"close-on-overload"`
+	// the `Retry-After` header of the 503 response, zero means no header
+	RetryAfter utils.TomlDuration `json:"retry_after" toml:"retry-after"`
+}
+
+// ServerStats is a snapshot of the counters of the server.
+type ServerStats struct {
+	Connections         int64 `json:"connections"`
+	InFlightRequests    int64 `json:"in_flight_requests"`
+	AcceptedConnections int64 `json:"accepted_connections"`
+	RejectedConnections int64 `json:"rejected_connections"`
+	HandledRequests     int64 `json:"handled_requests"`
+	RejectedRequests    int64 `json:"rejected_requests"`
+	// the malformed requests of http1x, and the stream and connection errors of http2
+	ParseErrors int64 `json:"parse_errors"`
+	// the connections being served, including the hijacked ones
+	AliveConnections int64 `json:"alive_connections"`
+}
+
+type _ServerCounters struct {
+	ServerStats
+
+	ipMutex sync.Mutex
+	ipConns map[string]int64
+}
+
+// Stats returns the counters of the server, it is safe to call concurrently.
+func (s *Server) Stats() ServerStats {
+	c := &s.counters
+	return ServerStats{
+		Connections:         atomic.LoadInt64(&c.Connections),
+		InFlightRequests:    atomic.LoadInt64(&c.InFlightRequests),
+		AcceptedConnections: atomic.LoadInt64(&c.AcceptedConnections),
+		RejectedConnections: atomic.LoadInt64(&c.RejectedConnections),
+		HandledRequests:     atomic.LoadInt64(&c.HandledRequests),
+		RejectedRequests:    atomic.LoadInt64(&c.RejectedRequests),
+		ParseErrors:         atomic.LoadInt64(&c.ParseErrors),
+		AliveConnections:    atomic.LoadInt64(&s.aliveConns),
+	}
+}
+
+func (s *Server) parseError() { atomic.AddInt64(&s.counters.ParseErrors, 1) }
+
+// retryAfter returns the seconds of the `Retry-After` header, empty means no header.
+func (opt *LimitOptions) retryAfter() string {
+	if v := opt.RetryAfter.Duration; v > 0 {
+		return strconv.FormatInt(int64((v+time.Second-1)/time.Second), 10)
+	}
+	return ""
+}
+
+func (s *Server) overloadResponse() []byte {
+	buf := []byte("HTTP/1.1 503 Service Unavailable\r\nConnection: close\r\nContent-Length: 0\r\n")
+	if v := s.Options.Limits.retryAfter(); len(v) > 0 {
+		buf = append(buf, HeaderRetryAfter+": "+v+"\r\n"...)
+	}
+	return append(buf, "\r\n"...)
+}
+
+// rejectConn closes the connection, a 503 response is written if the connection is not tls.
+func (s *Server) rejectConn(conn net.Conn, l *_Listener) {
+	atomic.AddInt64(&s.counters.RejectedConnections, 1)
+	if !s.Options.Limits.CloseOnOverload && l.tls == nil && !isTLSConn(conn) {
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Millisecond * 100))
+		_, _ = conn.Write(s.overloadResponse())
+	}
+	_ = conn.Close()
+}
+
+// acquireConn is called in the accept loop, returns false if the connection should be rejected.
+func (s *Server) acquireConn() bool {
+	c := &s.counters
+	n := atomic.AddInt64(&c.Connections, 1)
+	if max := s.Options.Limits.MaxConnections; max > 0 && n > max {
+		atomic.AddInt64(&c.Connections, -1)
+		return false
+	}
+	atomic.AddInt64(&c.AcceptedConnections, 1)
+	return true
+}
+
+func (s *Server) releaseConn() { atomic.AddInt64(&s.counters.Connections, -1) }
+
+// acquireIP returns the key of the remote ip, and false if the ip has too many connections.
+// the connections without ip, such as unix domain sockets, are not limited.
+func (s *Server) acquireIP(conn net.Conn) (string, bool) {
+	max := s.Options.Limits.MaxConnectionsPerIP
+	if max < 1 {
+		return "", true
+	}
+	ip := addrToIP(conn.RemoteAddr())
+	if ip == nil {
+		return "", true
+	}
+	key := ip.String()
+
+	c := &s.counters
+	c.ipMutex.Lock()
+	defer c.ipMutex.Unlock()
+	if c.ipConns == nil {
+		c.ipConns = map[string]int64{}
+	}
+	if c.ipConns[key] >= max {
+		return "", false
+	}
+	c.ipConns[key]++
+	return key, true
+}
+
+func (s *Server) releaseIP(key string) {
+	if len(key) < 1 {
+		return
+	}
+	c := &s.counters
+	c.ipMutex.Lock()
+	if c.ipConns[key]--; c.ipConns[key] < 1 {
+		delete(c.ipConns, key)
+	}
+	c.ipMutex.Unlock()
+}
+
+// acquireRequest returns false if the server has too many in-flight requests.
+func (s *Server) acquireRequest() bool {
+	c := &s.counters
+	n := atomic.AddInt64(&c.InFlightRequests, 1)
+	if max := s.Options.Limits.MaxInFlightRequests; max > 0 && n > max {
+		atomic.AddInt64(&c.InFlightRequests, -1)
+		atomic.AddInt64(&c.RejectedRequests, 1)
+		return false
+	}
+	return true
+}
+
+func (s *Server) releaseRequest() {
+	atomic.AddInt64(&s.counters.InFlightRequests, -1)
+	atomic.AddInt64(&s.counters.HandledRequests, 1)
+}
+
+// setOverloadResponse makes the response of a rejected request.
+func (s *Server) setOverloadResponse(ctx *RequestCtx) {
+	ctx.Response.ResetBody()
+	ctx.Response.SetStatusCode(StatusServiceUnavailable)
+	if v := s.Options.Limits.retryAfter(); len(v) > 0 {
+		ctx.Response.Header().SetString(HeaderRetryAfter, v)
+	}
+}
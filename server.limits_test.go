@@ -0,0 +1,154 @@
+package sha
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zzztttkkk/sha/utils"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestServer_Limits(t *testing.T) {
+	cases := []struct {
+		limits   LimitOptions
+		rejected func(stats ServerStats) int64
+	}{
+		{
+			limits:   LimitOptions{MaxConnections: 1, RetryAfter: utils.TomlDuration{Duration: time.Millisecond * 1500}},
+			rejected: func(stats ServerStats) int64 { return stats.RejectedConnections },
+		},
+		{
+			limits:   LimitOptions{MaxConnectionsPerIP: 1, RetryAfter: utils.TomlDuration{Duration: time.Millisecond * 1500}},
+			rejected: func(stats ServerStats) int64 { return stats.RejectedConnections },
+		},
+		{
+			limits:   LimitOptions{MaxInFlightRequests: 1, RetryAfter: utils.TomlDuration{Duration: time.Millisecond * 1500}},
+			rejected: func(stats ServerStats) int64 { return stats.RejectedRequests },
+		},
+		{
+			limits:   LimitOptions{MaxInFlightRequests: 1, CloseOnOverload: true},
+			rejected: func(stats ServerStats) int64 { return stats.RejectedRequests },
+		},
+	}
+
+	for i, c := range cases {
+		var s *Server
+		release := make(chan struct{})
+		addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+			if string(ctx.Request.Path()) == "/slow" {
+				<-release
+			}
+			_ = ctx.WriteString("ok")
+		}), func(v *Server) {
+			s = v
+			s.Options.Limits = c.limits
+		})
+
+		busy, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = busy.Write([]byte("GET /slow HTTP/1.1\r\nHost: sha.local\r\n\r\n"))
+		time.Sleep(time.Millisecond * 50)
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: sha.local\r\n\r\n"))
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		r := bufio.NewReader(conn)
+		if c.limits.CloseOnOverload {
+			if _, err = r.ReadByte(); err != io.EOF {
+				t.Fatalf("case %d: expected closed connection, %v", i, err)
+			}
+		} else {
+			res, err := http.ReadResponse(r, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != StatusServiceUnavailable || res.Header.Get(HeaderRetryAfter) != "2" || !res.Close {
+				t.Fatalf("case %d: unexpected response %d %v", i, res.StatusCode, res.Header)
+			}
+		}
+		_ = conn.Close()
+
+		stats := s.Stats()
+		if c.rejected(stats) != 1 || stats.InFlightRequests != 1 || stats.Connections < 1 {
+			t.Fatalf("case %d: unexpected stats %+v", i, stats)
+		}
+
+		close(release)
+		res, err := http.ReadResponse(bufio.NewReader(busy), nil)
+		if err != nil || res.StatusCode != StatusOK {
+			t.Fatalf("case %d: unexpected response %v", i, err)
+		}
+		_ = busy.Close()
+		stop()
+	}
+}
+
+func TestServer_LimitsH2CUpgrade(t *testing.T) {
+	var s *Server
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_ = ctx.WriteString("ok")
+	}), func(v *Server) {
+		s = v
+		s.Options.Limits = LimitOptions{MaxInFlightRequests: 1}
+		s.SetHTTPProtocol(NewHTTP2Protocol(nil, nil))
+	})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: sha.local\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAARAAAAAAAIAAAAA\r\n\r\n"))
+	buf := make([]byte, len(h2cSwitchingResponse))
+	if _, err = io.ReadFull(conn, buf); err != nil || string(buf) != h2cSwitchingResponse {
+		t.Fatalf("bad upgrade response %q %v", buf, err)
+	}
+	_, _ = conn.Write([]byte(http2.ClientPreface))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	_ = framer.WriteSettings()
+	status := func(id uint32) string {
+		for {
+			f, err := framer.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hf, ok := f.(*http2.MetaHeadersFrame); ok && hf.StreamID == id {
+				return hf.PseudoValue("status")
+			}
+		}
+	}
+	if v := status(1); v != "200" {
+		t.Fatalf("unexpected status %s", v)
+	}
+
+	// the upgraded connection does not hold the only in-flight slot
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	_ = enc.WriteField(hpack.HeaderField{Name: ":method", Value: MethodGet})
+	_ = enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "http"})
+	_ = enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "sha.local"})
+	_ = enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})
+	_ = framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 3, BlockFragment: block.Bytes(), EndStream: true, EndHeaders: true})
+	if v := status(3); v != "200" {
+		t.Fatalf("unexpected status %s", v)
+	}
+	if stats := s.Stats(); stats.RejectedRequests != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,152 @@
+package sha
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/zzztttkkk/sha/internal"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type TLSOptions struct {
+	AutoCertDomains []string `json:"auto_cert_domains" toml:"auto-cert-domains"`
+	Key             string   `json:"key" toml:"key"`
+	Cert            string   `json:"cert" toml:"cert"`
+}
+
+func (opt *TLSOptions) enabled() bool { return len(opt.AutoCertDomains) > 0 || len(opt.Cert) > 0 }
+
+type ListenerOptions struct {
+	// tcp, tcp4, tcp6 or unix
+	Network string     `json:"network" toml:"network"`
+	Addr    string     `json:"addr" toml:"addr"`
+	TLS     TLSOptions `json:"tls" toml:"tls"`
+	// file mode of the unix domain socket, such as 0660. zero means the default mode of the process umask.
+	UnixSocketMode os.FileMode `json:"unix_socket_mode" toml:"unix-socket-mode"`
+}
+
+// _Listener is a listener with its own tls config, the tls handshake is done in the connection goroutine.
+type _Listener struct {
+	net.Listener
+	tls *tls.Config
+}
+
+func isTLSConn(conn net.Conn) bool {
+	_, ok := conn.(*tls.Conn)
+	return ok
+}
+
+// removeStaleUnixSocket removes the socket file left by a crashed process, other files are kept.
+func removeStaleUnixSocket(path string) {
+	if strings.HasPrefix(path, "@") { // abstract socket
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if conn, err := net.Dial("unix", path); err == nil { // still in use
+		_ = conn.Close()
+		return
+	}
+	_ = os.Remove(path)
+}
+
+func (s *Server) listen(opt *ListenerOptions) net.Listener {
+	network := opt.Network
+	if len(network) < 1 {
+		network = "tcp"
+	}
+
+	listener := takeInheritedListener(network, opt.Addr)
+	if listener == nil {
+		if network == "unix" {
+			removeStaleUnixSocket(opt.Addr)
+		}
+		var err error
+		listener, err = net.Listen(network, opt.Addr)
+		if err != nil {
+			panic(err)
+		}
+		if network == "unix" && opt.UnixSocketMode != 0 {
+			if err = os.Chmod(opt.Addr, opt.UnixSocketMode); err != nil {
+				_ = listener.Close()
+				panic(err)
+			}
+		}
+	}
+
+	if s.Options.ProxyProtocol.Enabled {
+		listener = newProxyProtocolListener(listener, &s.Options.ProxyProtocol)
+	}
+	return listener
+}
+
+// tlsConfig loads the certificate if the config does not have one.
+func (s *Server) tlsConfig(conf *tls.Config, certFile, keyFile string) *tls.Config {
+	if conf == nil {
+		conf = &tls.Config{}
+	}
+	if len(conf.Certificates) > 0 || conf.GetCertificate != nil {
+		return conf
+	}
+	if certFile == "" || keyFile == "" {
+		panic("sha: empty tls file")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		panic(err)
+	}
+	conf.Certificates = []tls.Certificate{cert}
+	return conf
+}
+
+// alpnConfig returns a copy of the config whose alpn protocols match the http protocol of the server,
+// `h2` is only advertised by the http2 protocol. it is called by `Serve`, so the http protocol can be
+// changed before serving.
+func (s *Server) alpnConfig(conf *tls.Config) *tls.Config {
+	conf = conf.Clone()
+	protos := make([]string, 0, len(conf.NextProtos)+2)
+	if isHTTP2Protocol(s.httpProtocol) {
+		protos = append(protos, http2NextProto)
+	}
+	for _, v := range conf.NextProtos {
+		if v != http2NextProto {
+			protos = append(protos, v)
+		}
+	}
+	if !internal.StrSliceContains(protos, "http/1.1") {
+		protos = append(protos, "http/1.1")
+	}
+	conf.NextProtos = protos
+	return conf
+}
+
+// AddListener adds an extra listener, it will be served by `Serve` and closed by `Shutdown`.
+// tlsConf is nil for a plain listener. it must be called before `Serve`.
+func (s *Server) AddListener(l net.Listener, tlsConf *tls.Config) {
+	if tlsConf != nil {
+		tlsConf = s.tlsConfig(tlsConf, "", "")
+	}
+	s.listeners = append(s.listeners, &_Listener{Listener: l, tls: tlsConf})
+}
+
+// ListenWith creates a listener by the options and adds it to the server.
+func (s *Server) ListenWith(opt *ListenerOptions) {
+	if len(opt.TLS.AutoCertDomains) > 0 {
+		if opt.Network == "unix" {
+			panic("sha: auto cert is not available for unix domain sockets")
+		}
+		m := &autocert.Manager{Prompt: autocert.AcceptTOS, HostPolicy: autocert.HostWhitelist(opt.TLS.AutoCertDomains...)}
+		s.AddListener(s.listen(opt), m.TLSConfig())
+		return
+	}
+
+	var conf *tls.Config
+	if len(opt.TLS.Cert) > 0 {
+		conf = s.tlsConfig(nil, opt.TLS.Cert, opt.TLS.Key)
+	}
+	s.AddListener(s.listen(opt), conf)
+}
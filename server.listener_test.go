@@ -0,0 +1,222 @@
+package sha
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServer_MultipleListeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sha.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "sha.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := DefaultWithContext(ctx)
+	s.Handler = RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		if ctx.IsTLS() {
+			_ = ctx.WriteString("tls")
+			return
+		}
+		_ = ctx.WriteString(ctx.LocalAddr().Network())
+	})
+
+	plain, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secure, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddListener(secure, makeTestTLSConfig(t))
+	s.ListenWith(&ListenerOptions{Network: "unix", Addr: sock, UnixSocketMode: 0600})
+
+	info, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected socket mode %s", info.Mode())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Serve(plain)
+		close(done)
+	}()
+
+	cases := []struct {
+		dial func() (net.Conn, error)
+		body string
+	}{
+		{dial: func() (net.Conn, error) { return net.Dial("tcp", plain.Addr().String()) }, body: "tcp"},
+		{dial: func() (net.Conn, error) { return net.Dial("unix", sock) }, body: "unix"},
+		{
+			dial: func() (net.Conn, error) {
+				return tls.Dial("tcp", secure.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+			},
+			body: "tls",
+		},
+	}
+	for _, c := range cases {
+		conn, err := c.dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: sha.local\r\n\r\n"))
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		_ = conn.Close()
+		if string(body) != c.body {
+			t.Fatalf("unexpected body %q, expected %q", body, c.body)
+		}
+	}
+	if !s.IsTLS() {
+		t.Fatal("expected tls server")
+	}
+
+	cancel()
+	<-done
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Fatalf("the unix socket is not removed: %v", err)
+	}
+}
+
+func TestServer_ALPN(t *testing.T) {
+	cases := []struct {
+		http2    bool
+		expected string
+	}{
+		{http2: false, expected: "http/1.1"},
+		{http2: true, expected: http2NextProto},
+	}
+	for _, c := range cases {
+		ctx, cancel := context.WithCancel(context.Background())
+		s := DefaultWithContext(ctx)
+		s.Handler = RequestCtxHandlerFunc(func(ctx *RequestCtx) {})
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// `h2` is advertised by the config, like the config of autocert
+		conf := makeTestTLSConfig(t)
+		conf.NextProtos = []string{http2NextProto, "http/1.1"}
+		s.AddListener(l, conf)
+		if c.http2 {
+			s.SetHTTPProtocol(NewHTTP2Protocol(nil, nil))
+		}
+
+		done := make(chan struct{})
+		go func() {
+			s.Serve(nil)
+			close(done)
+		}()
+
+		conn, err := tls.Dial(
+			"tcp", l.Addr().String(),
+			&tls.Config{InsecureSkipVerify: true, NextProtos: []string{http2NextProto, "http/1.1"}},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proto := conn.ConnectionState().NegotiatedProtocol
+		_ = conn.Close()
+		cancel()
+		<-done
+		if proto != c.expected {
+			t.Fatalf("unexpected protocol %q, expected %q", proto, c.expected)
+		}
+	}
+}
+
+func TestServer_Restart(t *testing.T) {
+	if restartSignal == nil {
+		t.Skip(ErrRestartNotSupported)
+	}
+
+	// the new process runs this test again with the inherited listener
+	addr := os.Getenv("SHA_TEST_RESTART_ADDR")
+	isChild := len(addr) > 0
+	if !isChild {
+		l, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr = l.Addr().String()
+		_ = l.Close()
+		_ = os.Setenv("SHA_TEST_RESTART_ADDR", addr)
+		defer os.Unsetenv("SHA_TEST_RESTART_ADDR")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := New(ctx, nil, &ServerOptions{Addr: addr})
+	s.Handler = RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_ = ctx.WriteString(strconv.Itoa(os.Getpid()))
+		if isChild {
+			go cancel()
+		}
+	})
+	done := make(chan struct{})
+	go func() {
+		s.ListenAndServe()
+		close(done)
+	}()
+	if isChild {
+		<-done
+		return
+	}
+
+	getPid := func() string {
+		for i := 0; i < 50; i++ {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				time.Sleep(time.Millisecond * 20)
+				continue
+			}
+			_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: sha.local\r\nConnection: close\r\n\r\n"))
+			res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(res.Body)
+			_ = conn.Close()
+			return string(body)
+		}
+		t.Fatal("server is not listening")
+		return ""
+	}
+
+	if pid := getPid(); pid != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("unexpected pid %s", pid)
+	}
+
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestServer_Restart$"}
+	err := s.Restart()
+	os.Args = args
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	if pid := getPid(); pid == strconv.Itoa(os.Getpid()) || len(pid) < 1 {
+		t.Fatalf("unexpected pid %s", pid)
+	}
+}
@@ -0,0 +1,259 @@
+package sha
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zzztttkkk/sha/logx"
+	"github.com/zzztttkkk/sha/utils"
+)
+
+type RestartOptions struct {
+	// restart the server on `SIGUSR2`, see `Server.Restart`
+	Enabled bool `json:"enabled" toml:"enabled"`
+	// the new process will be killed if it is not serving in this duration
+	ReadyTimeout utils.TomlDuration `json:"ready_timeout" toml:"ready-timeout"`
+}
+
+var (
+	ErrListenerNotInheritable = errors.New("sha.server: listener can not be inherited")
+	ErrRestartNotSupported    = errors.New("sha.server: restart is not supported on this platform")
+	ErrRestartTimeout         = errors.New("sha.server: restart timeout, the new process is killed")
+	ErrRestartProcessExited   = errors.New("sha.server: restart failed, the new process exited")
+)
+
+const (
+	envInheritedFds   = "SHA_INHERITED_FDS"
+	envRestartReadyFd = "SHA_RESTART_READY_FD"
+	envListenPid      = "LISTEN_PID"
+	envListenFds      = "LISTEN_FDS"
+	envListenFdNames  = "LISTEN_FDNAMES"
+	listenFdsStart    = 3
+)
+
+var inherited struct {
+	sync.Mutex
+	once       sync.Once
+	fromParent bool
+	listeners  []net.Listener
+}
+
+// loadInheritedListeners loads the listeners passed by `Server.Restart` or systemd socket activation.
+func loadInheritedListeners() {
+	inherited.once.Do(func() {
+		var n int
+		if v := os.Getenv(envInheritedFds); len(v) > 0 {
+			n, _ = strconv.Atoi(v)
+			inherited.fromParent = true
+			_ = os.Unsetenv(envInheritedFds)
+		} else if pid, _ := strconv.Atoi(os.Getenv(envListenPid)); pid == os.Getpid() {
+			n, _ = strconv.Atoi(os.Getenv(envListenFds))
+			_ = os.Unsetenv(envListenPid)
+			_ = os.Unsetenv(envListenFds)
+			_ = os.Unsetenv(envListenFdNames)
+		}
+
+		for i := 0; i < n; i++ {
+			f := os.NewFile(uintptr(listenFdsStart+i), "sha.listener."+strconv.Itoa(i))
+			l, err := net.FileListener(f)
+			_ = f.Close()
+			if err != nil {
+				logx.Default().Warn("sha.server: bad inherited listener", "fd", listenFdsStart+i, "err", err)
+				continue
+			}
+			if ul, ok := l.(*net.UnixListener); ok && inherited.fromParent {
+				ul.SetUnlinkOnClose(true)
+			}
+			inherited.listeners = append(inherited.listeners, l)
+		}
+	})
+}
+
+func listenerAddrMatches(network, addr string, la net.Addr) bool {
+	if network == "unix" {
+		ua, ok := la.(*net.UnixAddr)
+		return ok && ua.Name == addr
+	}
+	ta, ok := la.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	want, err := net.ResolveTCPAddr(network, addr)
+	if err != nil || want.Port != ta.Port {
+		return false
+	}
+	if len(want.IP) < 1 || want.IP.IsUnspecified() {
+		return ta.IP.IsUnspecified()
+	}
+	return want.IP.Equal(ta.IP)
+}
+
+func takeInheritedListener(network, addr string) net.Listener {
+	loadInheritedListeners()
+	inherited.Lock()
+	defer inherited.Unlock()
+
+	for i, l := range inherited.listeners {
+		if listenerAddrMatches(network, addr, l.Addr()) {
+			inherited.listeners = append(inherited.listeners[:i], inherited.listeners[i+1:]...)
+			return l
+		}
+	}
+	return nil
+}
+
+// takeRestInheritedListeners returns the inherited listeners which are not matched by any address,
+// such as the sockets configured only in the systemd unit.
+func takeRestInheritedListeners() []net.Listener {
+	loadInheritedListeners()
+	inherited.Lock()
+	defer inherited.Unlock()
+
+	rv := inherited.listeners
+	inherited.listeners = nil
+	return rv
+}
+
+// notifyRestartReady tells the parent process that the new process is serving.
+func notifyRestartReady() {
+	v := os.Getenv(envRestartReadyFd)
+	if len(v) < 1 {
+		return
+	}
+	_ = os.Unsetenv(envRestartReadyFd)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "sha.restart.ready")
+	_, _ = f.Write([]byte{1})
+	_ = f.Close()
+}
+
+func listenerFile(l net.Listener) (*os.File, error) {
+	if pl, ok := l.(*_ProxyProtocolListener); ok {
+		l = pl.Listener
+	}
+	switch v := l.(type) {
+	case *net.TCPListener:
+		return v.File()
+	case *net.UnixListener:
+		return v.File()
+	}
+	return nil, ErrListenerNotInheritable
+}
+
+func restartEnviron(fds int) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name := kv
+		if ind := strings.IndexByte(kv, '='); ind > -1 {
+			name = kv[:ind]
+		}
+		switch name {
+		case envInheritedFds, envRestartReadyFd, envListenPid, envListenFds, envListenFdNames:
+			continue
+		}
+		env = append(env, kv)
+	}
+	return append(
+		env,
+		envInheritedFds+"="+strconv.Itoa(fds),
+		envRestartReadyFd+"="+strconv.Itoa(listenFdsStart+fds),
+	)
+}
+
+// Restart starts a new process of the same executable and arguments, which inherits all the listeners.
+// the current process stops accepting and shuts down after the new process is serving, the alive connections
+// are drained by `Shutdown`. the listeners must be created by `Listen`, `ListenWith` or `ServerOptions.Listeners`,
+// so the new process can find them by the address.
+func (s *Server) Restart() error {
+	if restartSignal == nil {
+		return ErrRestartNotSupported
+	}
+
+	s.restartMutex.Lock()
+	defer s.restartMutex.Unlock()
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, l := range s.listeners {
+		f, err := listenerFile(l.Listener)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+	process, err := os.StartProcess(
+		executable, os.Args,
+		&os.ProcAttr{
+			Env:   restartEnviron(len(files)),
+			Files: append(append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...), w),
+		},
+	)
+	_ = w.Close()
+	if err != nil {
+		return err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	timeout := s.Options.Restart.ReadyTimeout.Duration
+	if timeout <= 0 {
+		timeout = time.Second * 30
+	}
+	select {
+	case err = <-ready:
+		if err != nil {
+			err = ErrRestartProcessExited
+		}
+	case <-time.After(timeout):
+		err = ErrRestartTimeout
+	}
+	if err != nil {
+		_ = process.Kill()
+		_, _ = process.Wait()
+		return err
+	}
+	pid := process.Pid
+	_ = process.Release()
+
+	for _, l := range s.listeners { // the socket file is still used by the new process
+		if ul, ok := l.Listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		} else if pl, ok := l.Listener.(*_ProxyProtocolListener); ok {
+			if ul, ok := pl.Listener.(*net.UnixListener); ok {
+				ul.SetUnlinkOnClose(false)
+			}
+		}
+	}
+
+	s.logger().Info("sha.server: restarted", "new_pid", pid, "pid", os.Getpid())
+	go s.shutdownWithTimeout()
+	return nil
+}
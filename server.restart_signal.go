@@ -0,0 +1,11 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package sha
+
+import (
+	"os"
+	"syscall"
+)
+
+var restartSignal os.Signal = syscall.SIGUSR2
@@ -0,0 +1,137 @@
+package sha
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+// ShutdownError is returned by `Server.Shutdown` if the context is done before all connections are closed.
+type ShutdownError struct {
+	Err error
+	// the count of force closed connections
+	Connections int
+	// the count of force closed connections which were processing requests
+	ActiveConnections int
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf(
+		"sha.server: shutdown aborted by `%s`, %d connections(%d active) are force closed",
+		e.Err, e.Connections, e.ActiveConnections,
+	)
+}
+
+func (e *ShutdownError) Unwrap() error { return e.Err }
+
+type _CtxKeyConnTracker struct{}
+
+// _ConnTracker tracks the state of an accepted connection, so `Shutdown` can close the idle connections immediately.
+type _ConnTracker struct {
+	s    *Server
+	conn net.Conn
+	idle bool
+	// the protocol closes the connection itself after the in-flight requests are done, such as http2 `GOAWAY`
+	onShutdown func()
+}
+
+func connTrackerFrom(ctx context.Context) *_ConnTracker {
+	t, _ := ctx.Value(_CtxKeyConnTracker{}).(*_ConnTracker)
+	return t
+}
+
+// setIdle returns false if the connection should be closed, because the server is shutting down.
+func (t *_ConnTracker) setIdle(idle bool) bool {
+	if t == nil {
+		return true
+	}
+	t.s.connsMutex.Lock()
+	defer t.s.connsMutex.Unlock()
+	t.idle = idle
+	return !idle || t.s.isRunning()
+}
+
+// setOnShutdown registers fn, it is called immediately if the server is already shutting down.
+func (t *_ConnTracker) setOnShutdown(fn func()) {
+	if t == nil {
+		return
+	}
+	t.s.connsMutex.Lock()
+	t.onShutdown = fn
+	running := t.s.isRunning()
+	t.s.connsMutex.Unlock()
+	if !running {
+		fn()
+	}
+}
+
+func (s *Server) isRunning() bool { return atomic.LoadInt32(&s.running) == 1 }
+
+func (s *Server) lifecycle() {
+	s.lifecycleOnce.Do(func() {
+		s.conns = map[*_ConnTracker]struct{}{}
+		s.drained = make(chan struct{})
+		s.done = make(chan struct{})
+	})
+}
+
+func (s *Server) trackConn(conn net.Conn) *_ConnTracker {
+	t := &_ConnTracker{s: s, conn: conn, idle: true}
+	s.connsMutex.Lock()
+	s.conns[t] = struct{}{}
+	s.connsMutex.Unlock()
+	atomic.AddInt64(&s.aliveConns, 1)
+	return t
+}
+
+func (s *Server) untrackConn(t *_ConnTracker) {
+	s.connsMutex.Lock()
+	delete(s.conns, t)
+	if len(s.conns) == 0 && !s.isRunning() && !s.drainedClosed {
+		s.drainedClosed = true
+		close(s.drained)
+	}
+	s.connsMutex.Unlock()
+	atomic.AddInt64(&s.aliveConns, -1)
+}
+
+// stopConns is called after the server stops accepting, closes the idle connections and notifies the protocols.
+func (s *Server) stopConns() {
+	var callbacks []func()
+	s.connsMutex.Lock()
+	atomic.StoreInt32(&s.running, 0)
+	for t := range s.conns {
+		if t.onShutdown != nil {
+			callbacks = append(callbacks, t.onShutdown)
+		} else if t.idle {
+			_ = t.conn.Close()
+		}
+	}
+	if len(s.conns) == 0 && !s.drainedClosed {
+		s.drainedClosed = true
+		close(s.drained)
+	}
+	s.connsMutex.Unlock()
+
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+func (s *Server) forceCloseConns(err error) error {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+
+	if len(s.conns) == 0 {
+		return nil
+	}
+	se := &ShutdownError{Err: err, Connections: len(s.conns)}
+	for t := range s.conns {
+		if !t.idle {
+			se.ActiveConnections++
+		}
+		_ = t.conn.Close()
+	}
+	return se
+}
@@ -0,0 +1,156 @@
+package sha
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+func TestServer_Shutdown(t *testing.T) {
+	var s *Server
+	release := make(chan struct{})
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		if string(ctx.Request.Path()) == "/slow" {
+			<-release
+		}
+		_ = ctx.WriteString("ok")
+	}), func(v *Server) {
+		s = v
+		s.Options.GracefullyShutdown = true
+	})
+	defer stop()
+
+	send := func(conn net.Conn, path string) *bufio.Reader {
+		_, _ = conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: sha.local\r\n\r\n"))
+		return bufio.NewReader(conn)
+	}
+
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	idleReader := send(idle, "/")
+	res, err := http.ReadResponse(idleReader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = ioutil.ReadAll(res.Body)
+
+	busy, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyReader := send(busy, "/slow")
+	time.Sleep(time.Millisecond * 50)
+
+	result := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		result <- s.Shutdown(ctx)
+	}()
+
+	// the idle connection is closed immediately
+	_ = idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = idleReader.ReadByte(); err != io.EOF {
+		t.Fatalf("expected closed idle connection, %v", err)
+	}
+
+	close(release)
+	res, err = http.ReadResponse(busyReader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "ok" || !res.Close {
+		t.Fatalf("unexpected response %q, close=%v", body, res.Close)
+	}
+	if err = <-result; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_ShutdownDeadline(t *testing.T) {
+	var s *Server
+	release := make(chan struct{})
+	defer close(release)
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		<-release
+	}), func(v *Server) {
+		s = v
+		s.Options.GracefullyShutdown = true
+	})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: sha.local\r\n\r\n"))
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	err = s.Shutdown(ctx)
+	var se *ShutdownError
+	if !errors.As(err, &se) || !errors.Is(err, context.DeadlineExceeded) || se.Connections != 1 || se.ActiveConnections != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected force closed connection, %v", err)
+	}
+}
+
+func TestServer_ShutdownHTTP2(t *testing.T) {
+	var s *Server
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {}), func(v *Server) {
+		s = v
+		s.Options.GracefullyShutdown = true
+		s.SetHTTPProtocol(NewHTTP2Protocol(nil, nil))
+	})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte(http2.ClientPreface))
+	framer := http2.NewFramer(conn, conn)
+	if err = framer.WriteSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = framer.ReadFrame(); err != nil { // server settings
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err = s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("expected goaway, %v", err)
+		}
+		if _, ok := frame.(*http2.GoAwayFrame); ok {
+			break
+		}
+	}
+}
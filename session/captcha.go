@@ -3,10 +3,10 @@ package session
 import (
 	"context"
 	"github.com/zzztttkkk/sha/captcha"
+	"github.com/zzztttkkk/sha/logx"
 	"github.com/zzztttkkk/sha/utils"
 	"image/png"
 	"io"
-	"log"
 )
 
 type _RandBase58Generator struct{}
@@ -24,7 +24,7 @@ func (_ _RandBase58Generator) GenerateTo(_ context.Context, w io.Writer) (string
 
 func _initCaptcha() {
 	if len(opts.Captcha.Fonts) < 1 {
-		log.Printf("sha.session: empty captcha image fonts")
+		logx.Or(opts.Logger).Warn("sha.session: empty captcha image fonts")
 		return
 	}
 	if opts.Captcha.ImgOptions.OffsetX < 1 {
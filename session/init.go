@@ -8,6 +8,7 @@ import (
 	"github.com/zzztttkkk/sha/auth"
 	"github.com/zzztttkkk/sha/captcha"
 	"github.com/zzztttkkk/sha/jsonx"
+	"github.com/zzztttkkk/sha/logx"
 	"github.com/zzztttkkk/sha/utils"
 	"hash/crc64"
 	"math/bits"
@@ -35,6 +36,9 @@ type Options struct {
 		MaxAge     utils.TomlDuration `json:"max_age" toml:"max-age"`
 		Skip       bool               `json:"skip" toml:"skip"`
 	} `json:"csrf" toml:"csrf"`
+
+	// nil means `logx.Default()`
+	Logger logx.Logger `json:"-" toml:"-"`
 }
 
 var opts Options
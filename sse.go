@@ -0,0 +1,232 @@
+package sha
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zzztttkkk/sha/utils"
+)
+
+var ErrBadSSEField = errors.New("sha.sse: event and id can not contain line breaks")
+
+// SSEWriter writes the server-sent events, https://html.spec.whatwg.org/multipage/server-sent-events.html.
+// it is not safe for concurrent use, and must not be used after the handler returns.
+type SSEWriter struct {
+	ctx  *RequestCtx
+	w    StreamWriter
+	buf  bytes.Buffer
+	done chan struct{}
+	once sync.Once
+}
+
+// SSE starts the event stream, the compression is disabled and the headers are sent immediately.
+func (ctx *RequestCtx) SSE() *SSEWriter {
+	res := &ctx.Response
+	res.disableCompression()
+	res.Header().SetContentType(MIMEEventStream)
+	res.Header().SetString(HeaderCacheControl, "no-cache")
+	res.Header().SetString("X-Accel-Buffering", "no") // disable the buffering of nginx
+
+	sse := &SSEWriter{ctx: ctx, w: ctx.StreamWriter(), done: make(chan struct{})}
+	sse.watch()
+	_ = sse.w.Flush()
+	return sse
+}
+
+// watch closes `done` if the request context is canceled, such as the http1.x client is disconnected or the http2
+// stream is reset by the `RST_STREAM` frame.
+func (sse *SSEWriter) watch() {
+	ctxDone := sse.ctx.ctx.Done()
+	go func() {
+		select {
+		case <-ctxDone:
+			sse.close()
+		case <-sse.done:
+		}
+	}()
+}
+
+func (sse *SSEWriter) close() { sse.once.Do(func() { close(sse.done) }) }
+
+// Done is closed when the client is disconnected or the request is finished.
+func (sse *SSEWriter) Done() <-chan struct{} { return sse.done }
+
+// LastEventID returns the `Last-Event-ID` header, the id of the last event received by the reconnecting client.
+func (sse *SSEWriter) LastEventID() string {
+	v, _ := sse.ctx.Request.Header().Get(HeaderLastEventID)
+	return string(v)
+}
+
+func (sse *SSEWriter) flush() error {
+	_, err := sse.w.Write(sse.buf.Bytes())
+	sse.buf.Reset()
+	if err == nil {
+		err = sse.w.Flush()
+	}
+	if err != nil {
+		sse.close()
+	}
+	return err
+}
+
+func (sse *SSEWriter) writeField(name string, value []byte) {
+	sse.buf.WriteString(name)
+	sse.buf.WriteString(": ")
+	sse.buf.Write(value)
+	sse.buf.WriteByte('\n')
+}
+
+// Send sends an event, empty event and id are omitted. the data is split into multiple `data` fields by line breaks.
+func (sse *SSEWriter) Send(event, id string, data []byte) error {
+	if bytes.ContainsAny(utils.B(event), "\r\n") || bytes.ContainsAny(utils.B(id), "\r\n\x00") {
+		return ErrBadSSEField
+	}
+	if len(event) > 0 {
+		sse.writeField("event", utils.B(event))
+	}
+	if len(id) > 0 {
+		sse.writeField("id", utils.B(id))
+	}
+	for {
+		ind := bytes.IndexAny(data, "\r\n")
+		if ind < 0 {
+			sse.writeField("data", data)
+			break
+		}
+		sse.writeField("data", data[:ind])
+		if data[ind] == '\r' && ind+1 < len(data) && data[ind+1] == '\n' {
+			ind++
+		}
+		data = data[ind+1:]
+	}
+	sse.buf.WriteByte('\n')
+	return sse.flush()
+}
+
+// Retry tells the client to reconnect after the duration if the connection is lost.
+func (sse *SSEWriter) Retry(d time.Duration) error {
+	sse.writeField("retry", utils.B(strconv.FormatInt(int64(d/time.Millisecond), 10)))
+	sse.buf.WriteByte('\n')
+	return sse.flush()
+}
+
+// Comment sends a comment, which is ignored by the client. it is used as heartbeat to keep the connection alive.
+func (sse *SSEWriter) Comment(text string) error {
+	for _, line := range bytes.Split(utils.B(text), []byte{'\n'}) {
+		sse.buf.WriteByte(':')
+		sse.buf.Write(bytes.TrimSuffix(line, []byte{'\r'}))
+		sse.buf.WriteByte('\n')
+	}
+	sse.buf.WriteByte('\n')
+	return sse.flush()
+}
+
+type SSEEvent struct {
+	Event string
+	ID    string
+	Data  []byte
+}
+
+// SSEBroadcaster fans out the published events to all subscribers, the zero value is ready to use.
+// it is also a handler which serves the subscribers as event streams.
+type SSEBroadcaster struct {
+	// the size of the channel of each subscriber, the events are dropped for the subscriber if its channel is full
+	BufferSize int
+	// the interval of the comment heartbeats, zero means no heartbeat
+	Heartbeat time.Duration
+	// called before serving a subscriber, such as sending the missed events after `SSEWriter.LastEventID`
+	OnSubscribe func(ctx *RequestCtx, sse *SSEWriter)
+
+	mutex       sync.Mutex
+	subscribers map[chan SSEEvent]struct{}
+	closed      bool
+}
+
+// Subscribe returns a channel of the events, `unsubscribe` must be called after the subscriber is gone.
+// the channel is closed when the broadcaster is closed.
+func (b *SSEBroadcaster) Subscribe() (events <-chan SSEEvent, unsubscribe func()) {
+	ch := make(chan SSEEvent, b.BufferSize)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subscribers == nil {
+		b.subscribers = map[chan SSEEvent]struct{}{}
+	}
+	b.subscribers[ch] = struct{}{}
+	return ch, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends the event to all subscribers without blocking.
+func (b *SSEBroadcaster) Publish(event SSEEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *SSEBroadcaster) Subscribers() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.subscribers)
+}
+
+// Close closes the channels of all subscribers, the event streams are finished.
+func (b *SSEBroadcaster) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		close(ch)
+	}
+	b.subscribers = nil
+}
+
+// Handle serves the request as a subscriber until the client is disconnected or the broadcaster is closed.
+func (b *SSEBroadcaster) Handle(ctx *RequestCtx) {
+	events, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	sse := ctx.SSE()
+	if b.OnSubscribe != nil {
+		b.OnSubscribe(ctx, sse)
+	}
+
+	var heartbeat <-chan time.Time
+	if b.Heartbeat > 0 {
+		ticker := time.NewTicker(b.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-sse.Done():
+			return
+		case <-heartbeat:
+			if sse.Comment("") != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok || sse.Send(event.Event, event.ID, event.Data) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package sha
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readSSEEvent(t *testing.T, r *bufio.Reader) string {
+	var buf strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteString(line)
+		if line == "\n" {
+			return buf.String()
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 300; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+func TestSSEBroadcaster(t *testing.T) {
+	b := &SSEBroadcaster{
+		BufferSize: 4,
+		OnSubscribe: func(ctx *RequestCtx, sse *SSEWriter) {
+			if id := sse.LastEventID(); len(id) > 0 {
+				_ = sse.Retry(time.Second * 3)
+				_ = sse.Send("missed", id+"+1", []byte("replay"))
+			}
+		},
+	}
+	mux := NewMux(&MuxOptions{AutoHandleDocs: false, AutoCompress: true})
+	mux.HTTP(MethodGet, "/events", b)
+	addr, stop := startHTTP11TestServer(t, mux, nil)
+	defer stop()
+
+	subscribe := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest(MethodGet, "http://"+addr+"/events", nil)
+		req.Header.Set(HeaderAcceptEncoding, "gzip")
+		if len(lastEventID) > 0 {
+			req.Header.Set(HeaderLastEventID, lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Header.Get(HeaderContentType) != MIMEEventStream || len(res.Header.Get(HeaderContentEncoding)) > 0 {
+			t.Fatalf("unexpected header %v", res.Header)
+		}
+		return res, bufio.NewReader(res.Body)
+	}
+
+	res1, r1 := subscribe("")
+	res2, r2 := subscribe("7")
+	if e := readSSEEvent(t, r2); e != "retry: 3000\n\n" {
+		t.Fatalf("unexpected event %q", e)
+	}
+	if e := readSSEEvent(t, r2); e != "event: missed\nid: 7+1\ndata: replay\n\n" {
+		t.Fatalf("unexpected event %q", e)
+	}
+	waitFor(t, func() bool { return b.Subscribers() == 2 })
+
+	b.Publish(SSEEvent{Event: "update", ID: "8", Data: []byte("a\nb\r\nc")})
+	for _, r := range []*bufio.Reader{r1, r2} {
+		if e := readSSEEvent(t, r); e != "event: update\nid: 8\ndata: a\ndata: b\ndata: c\n\n" {
+			t.Fatalf("unexpected event %q", e)
+		}
+	}
+
+	_ = res1.Body.Close() // the disconnected subscriber is removed without publishing
+	waitFor(t, func() bool { return b.Subscribers() == 1 })
+
+	b.Close()
+	if _, err := ioutil.ReadAll(r2); err != nil {
+		t.Fatal(err)
+	}
+	_ = res2.Body.Close()
+}
+
+func TestSSEWriter_Send(t *testing.T) {
+	addr, stop := startHTTP11TestServer(t, RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		sse := ctx.SSE()
+		if sse.Send("a\nb", "", nil) != ErrBadSSEField {
+			return
+		}
+		_ = sse.Comment("ping")
+		_ = sse.Send("", "", []byte(""))
+	}), nil)
+	defer stop()
+
+	res, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, _ := ioutil.ReadAll(res.Body)
+	if string(data) != ":ping\n\ndata: \n\n" {
+		t.Fatalf("unexpected body %q", data)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"context"
 	"io"
-	"log"
 	"net/http"
 
 	"github.com/zzztttkkk/sha/utils"
@@ -103,7 +102,7 @@ func ToStdHandler(handler RequestCtxHandler) http.Handler {
 			v := recover()
 			if v != nil {
 				writer.WriteHeader(StatusInternalServerError)
-				log.Printf("sha: uncatched error, `%v`", v)
+				rctx.Logger().Error("sha: uncatched error", "err", v)
 				return
 			}
 
@@ -0,0 +1,158 @@
+package sha
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zzztttkkk/sha/trace"
+	"github.com/zzztttkkk/sha/utils"
+)
+
+// Tracing is a middleware which starts a server span for each request, the parent is read from the `traceparent`
+// and `tracestate` headers. the span is stored in the context of the request, so it can be read by
+// `trace.SpanFromContext` from the `RequestCtx` or `RequestCtx.Wrap()`, and the spans started by `trace.Start` are
+// its children.
+// use it with `Mux.Use` for the matched routes, or with `WrapHandler` for all requests.
+type Tracing struct {
+	Tracer *trace.Tracer
+	// returns the name of the span, `<method> <route pattern>` by default
+	SpanName func(ctx *RequestCtx) string
+	// returns true if the request should not be traced
+	Skip func(ctx *RequestCtx) bool
+}
+
+var _ Middleware = (*Tracing)(nil)
+
+type _CtxKeyCliSpan struct{}
+
+// remoteSpanContext returns the span context of the headers, the bad `traceparent` is ignored.
+func remoteSpanContext(header *Header) (trace.SpanContext, bool) {
+	v, ok := header.Get(trace.HeaderTraceparent)
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+	sc, err := trace.ParseTraceparent(utils.S(v))
+	if err != nil {
+		return sc, false
+	}
+	if v, ok = header.Get(trace.HeaderTracestate); ok {
+		sc.State = trace.ParseTracestate(string(v))
+	}
+	return sc, true
+}
+
+func (t *Tracing) Process(ctx *RequestCtx, next func()) {
+	if t.Skip != nil && t.Skip(ctx) {
+		next()
+		return
+	}
+
+	req := &ctx.Request
+	parent := ctx.ctx
+	base := parent
+	if sc, ok := remoteSpanContext(req.Header()); ok {
+		base = trace.ContextWithRemote(parent, sc)
+	}
+	c, span := t.Tracer.Start(base, string(req.Method()), trace.SpanKindServer)
+	ctx.ctx = c
+
+	defer func() {
+		ctx.ctx = parent
+		v := recover()
+
+		if span.IsRecording() {
+			t.finish(ctx, span, v)
+		}
+		span.End()
+		if v != nil {
+			panic(v)
+		}
+	}()
+	next()
+}
+
+// finish records the response, v is the recovered panic. the redirections and the http errors below 500 are not
+// the errors of the span.
+func (t *Tracing) finish(ctx *RequestCtx, span *trace.Span, v interface{}) {
+	req := &ctx.Request
+	name := string(req.Method())
+	if t.SpanName != nil {
+		name = t.SpanName(ctx)
+	} else if route := ctx.RoutePattern(); len(route) > 0 {
+		name += " " + route
+	}
+	span.SetName(name)
+
+	sc := ctx.responseStatusCode(v)
+	span.SetAttributes(
+		"http.request.method", string(req.Method()),
+		"url.path", req.Path(),
+		"http.response.status_code", sc,
+	)
+	if route := ctx.RoutePattern(); len(route) > 0 {
+		span.SetAttributes("http.route", route)
+	}
+	if ip := ctx.ClientIP(); ip != nil {
+		span.SetAttributes("client.address", ip.String())
+	}
+	if v, ok := req.Header().Get(HeaderUserAgent); ok {
+		span.SetAttributes("user_agent.original", string(v))
+	}
+	if v == nil {
+		v = ctx.err
+	}
+	if sc >= 500 {
+		desc := ""
+		if v != nil {
+			desc = fmt.Sprint(v)
+		}
+		span.SetStatus(trace.StatusError, desc)
+	}
+}
+
+// Cli appends the hooks to the client options, which record a client span for each request and inject the
+// `traceparent` and `tracestate` headers. the parent is the span in the context of the `RequestCtx`, such as
+// `AcquireRequestCtx(serverCtx.Wrap())`.
+func (t *Tracing) Cli(opt *CliConnectionOptions) {
+	opt.BeforeSendRequest = append(opt.BeforeSendRequest, t.beforeSend)
+	opt.AfterReceiveResponse = append(opt.AfterReceiveResponse, t.afterReceive)
+}
+
+func (t *Tracing) beforeSend(ctx *RequestCtx, host string) error {
+	parent := ctx.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	method := string(ctx.Request.Method())
+	_, span := t.Tracer.Start(parent, method, trace.SpanKindClient)
+	span.SetAttributes("http.request.method", method, "server.address", host, "url.path", ctx.Request.Path())
+
+	sc := span.Context()
+	header := ctx.Request.Header()
+	header.SetString(trace.HeaderTraceparent, sc.Traceparent())
+	if len(sc.State) > 0 {
+		header.SetString(trace.HeaderTracestate, sc.State)
+	}
+	ctx.UserData.Set(_CtxKeyCliSpan{}, span)
+	return nil
+}
+
+func (t *Tracing) afterReceive(ctx *RequestCtx, err error) {
+	v, _ := ctx.UserData.Get(_CtxKeyCliSpan{})
+	span, _ := v.(*trace.Span)
+	if span == nil {
+		return
+	}
+	ctx.UserData.Set(_CtxKeyCliSpan{}, nil)
+
+	if err != nil {
+		span.SetError(err)
+	} else {
+		sc := ctx.Response.StatusCode()
+		span.SetAttributes("http.response.status_code", sc)
+		if sc >= 400 {
+			span.SetStatus(trace.StatusError, "")
+		}
+	}
+	span.End()
+}
@@ -0,0 +1,216 @@
+package trace
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/zzztttkkk/sha/jsonx"
+)
+
+type _OTLPValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type _OTLPAttribute struct {
+	Key   string     `json:"key"`
+	Value _OTLPValue `json:"value"`
+}
+
+type _OTLPStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type _OTLPSpan struct {
+	TraceID           string           `json:"traceId"`
+	SpanID            string           `json:"spanId"`
+	ParentSpanID      string           `json:"parentSpanId,omitempty"`
+	TraceState        string           `json:"traceState,omitempty"`
+	Flags             uint32           `json:"flags"`
+	Name              string           `json:"name"`
+	Kind              SpanKind         `json:"kind"`
+	StartTimeUnixNano string           `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string           `json:"endTimeUnixNano"`
+	Attributes        []_OTLPAttribute `json:"attributes,omitempty"`
+	Status            _OTLPStatus      `json:"status"`
+}
+
+type _OTLPScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []_OTLPSpan `json:"spans"`
+}
+
+type _OTLPResourceSpans struct {
+	Resource struct {
+		Attributes []_OTLPAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []_OTLPScopeSpans `json:"scopeSpans"`
+}
+
+type _OTLPRequest struct {
+	ResourceSpans []_OTLPResourceSpans `json:"resourceSpans"`
+}
+
+func otlpValue(v interface{}) _OTLPValue {
+	var ov _OTLPValue
+	switch rv := v.(type) {
+	case string:
+		ov.StringValue = &rv
+	case bool:
+		ov.BoolValue = &rv
+	case int:
+		s := strconv.FormatInt(int64(rv), 10)
+		ov.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(rv, 10)
+		ov.IntValue = &s
+	case int32:
+		s := strconv.FormatInt(int64(rv), 10)
+		ov.IntValue = &s
+	case uint32:
+		s := strconv.FormatUint(uint64(rv), 10)
+		ov.IntValue = &s
+	case float64:
+		ov.DoubleValue = &rv
+	case float32:
+		f := float64(rv)
+		ov.DoubleValue = &f
+	default:
+		s := toString(v)
+		ov.StringValue = &s
+	}
+	return ov
+}
+
+func toString(v interface{}) string {
+	switch rv := v.(type) {
+	case error:
+		return rv.Error()
+	case interface{ String() string }:
+		return rv.String()
+	default:
+		data, _ := jsonx.Marshal(v)
+		return string(data)
+	}
+}
+
+// MarshalOTLPJSON encodes the span as an OTLP/JSON `ExportTraceServiceRequest`.
+func MarshalOTLPJSON(d *SpanData) ([]byte, error) {
+	span := _OTLPSpan{
+		TraceID:           d.SpanContext.TraceID.String(),
+		SpanID:            d.SpanContext.SpanID.String(),
+		TraceState:        d.SpanContext.State,
+		Flags:             uint32(d.SpanContext.Flags),
+		Name:              d.Name,
+		Kind:              d.Kind,
+		StartTimeUnixNano: strconv.FormatInt(d.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(d.End.UnixNano(), 10),
+		Status:            _OTLPStatus{Code: d.Status, Message: d.StatusMessage},
+	}
+	if d.Parent.IsValid() {
+		span.ParentSpanID = d.Parent.String()
+	}
+	for _, a := range d.Attributes {
+		span.Attributes = append(span.Attributes, _OTLPAttribute{Key: a.Key, Value: otlpValue(a.Value)})
+	}
+
+	var rs _OTLPResourceSpans
+	if len(d.Service) > 0 {
+		rs.Resource.Attributes = []_OTLPAttribute{{Key: "service.name", Value: otlpValue(d.Service)}}
+	} else {
+		rs.Resource.Attributes = []_OTLPAttribute{}
+	}
+	scope := _OTLPScopeSpans{Spans: []_OTLPSpan{span}}
+	scope.Scope.Name = "github.com/zzztttkkk/sha"
+	rs.ScopeSpans = []_OTLPScopeSpans{scope}
+	return jsonx.Marshal(_OTLPRequest{ResourceSpans: []_OTLPResourceSpans{rs}})
+}
+
+// OTLPJSONExporter writes a line of OTLP/JSON for each span, the same as the file exporter of the OpenTelemetry
+// collector, so the files can be replayed by its `otlpjsonfile` receiver.
+type OTLPJSONExporter struct {
+	mutex sync.Mutex
+	w     io.Writer
+	buf   []byte
+}
+
+func NewOTLPJSONExporter(w io.Writer) *OTLPJSONExporter { return &OTLPJSONExporter{w: w} }
+
+// NewOTLPJSONFileExporter appends the spans to the file, the file is closed by `OTLPJSONExporter.Close`.
+func NewOTLPJSONFileExporter(fp string) (*OTLPJSONExporter, error) {
+	f, err := os.OpenFile(fp, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewOTLPJSONExporter(f), nil
+}
+
+// Stdout writes the spans to the stdout as OTLP/JSON lines.
+var Stdout Exporter = NewOTLPJSONExporter(os.Stdout)
+
+func (e *OTLPJSONExporter) Export(span *SpanData) error {
+	data, err := MarshalOTLPJSON(span)
+	if err != nil {
+		return err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.buf = append(append(e.buf[:0], data...), '\n')
+	_, err = e.w.Write(e.buf)
+	return err
+}
+
+// Close closes the writer if it is an `io.Closer`.
+func (e *OTLPJSONExporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if c, ok := e.w.(io.Closer); ok && e.w != os.Stdout && e.w != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+// MemoryExporter keeps the spans in memory, for the tests.
+type MemoryExporter struct {
+	mutex sync.Mutex
+	spans []*SpanData
+}
+
+func (e *MemoryExporter) Export(span *SpanData) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans returns the exported spans in the order of ending.
+func (e *MemoryExporter) Spans() []*SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
+
+// Find returns the first exported span of the name.
+func (e *MemoryExporter) Find(name string) *SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, s := range e.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (e *MemoryExporter) Reset() {
+	e.mutex.Lock()
+	e.spans = nil
+	e.mutex.Unlock()
+}
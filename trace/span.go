@@ -0,0 +1,271 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zzztttkkk/sha/logx"
+)
+
+// SpanKind is the same as the OTLP enum.
+type SpanKind int
+
+const (
+	SpanKindInternal = SpanKind(iota + 1)
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	case SpanKindProducer:
+		return "producer"
+	case SpanKindConsumer:
+		return "consumer"
+	default:
+		return "internal"
+	}
+}
+
+// StatusCode is the same as the OTLP enum.
+type StatusCode int
+
+const (
+	StatusUnset = StatusCode(iota)
+	StatusOK
+	StatusError
+)
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanData is the snapshot of the ended span.
+type SpanData struct {
+	Service       string
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Attribute returns the value of the attribute.
+func (d *SpanData) Attribute(key string) (interface{}, bool) {
+	for _, a := range d.Attributes {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Span is a unit of work. all the methods are nil-safe, the nil span is used if the work is not traced.
+type Span struct {
+	mutex     sync.Mutex
+	tracer    *Tracer
+	recording bool
+	ended     bool
+	data      SpanData
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// IsRecording reports whether the span is sampled and not ended.
+func (s *Span) IsRecording() bool {
+	if s == nil {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.recording && !s.ended
+}
+
+// SetAttributes sets the attributes, the `kvs` are alternating keys and values, such as `"http.route", "/users/{id}"`.
+func (s *Span) SetAttributes(kvs ...interface{}) {
+	if s == nil || !s.recording {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ended {
+		return
+	}
+	for i := 0; i+1 < len(kvs); i += 2 {
+		key := fmt.Sprint(kvs[i])
+		replaced := false
+		for j := range s.data.Attributes {
+			if s.data.Attributes[j].Key == key {
+				s.data.Attributes[j].Value = kvs[i+1]
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: kvs[i+1]})
+		}
+	}
+}
+
+// SetName replaces the name, such as naming the server span after the route is matched.
+func (s *Span) SetName(name string) {
+	if s == nil || !s.recording {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended {
+		s.data.Name = name
+	}
+}
+
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil || !s.recording {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended {
+		s.data.Status = code
+		s.data.StatusMessage = msg
+	}
+}
+
+// SetError sets the error status, nil is ignored.
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End ends the span and exports it if it is sampled, the later calls are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mutex.Unlock()
+
+	if s.recording && s.tracer.Exporter != nil {
+		if err := s.tracer.Exporter.Export(&data); err != nil {
+			logx.Or(s.tracer.Logger).Error("sha.trace: export failed", "err", err)
+		}
+	}
+}
+
+type Exporter interface {
+	Export(span *SpanData) error
+}
+
+// Tracer creates the spans, the zero value samples all the spans and discards them.
+type Tracer struct {
+	// the `service.name` of the exported spans
+	Service  string
+	Exporter Exporter
+	// `AlwaysSample` by default
+	Sampler Sampler
+	// the logger of the export errors, nil means `logx.Default()`
+	Logger logx.Logger
+}
+
+type _CtxKey int
+
+const (
+	ctxKeySpan = _CtxKey(iota)
+	ctxKeyRemote
+)
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, ctxKeySpan, span)
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(ctxKeySpan).(*Span)
+	return span
+}
+
+// ContextWithRemote stores the span context parsed from the headers, it is the parent of the next span.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, ctxKeyRemote, sc)
+}
+
+func parentOf(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	if span := SpanFromContext(ctx); span != nil {
+		return span.Context()
+	}
+	sc, _ := ctx.Value(ctxKeyRemote).(SpanContext)
+	return sc
+}
+
+// Start starts a span as the child of the span in ctx, or the remote span context, or as a root span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	parent := parentOf(ctx)
+	span := &Span{tracer: t}
+	sc := &span.data.SpanContext
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.State = parent.State
+		span.data.Parent = parent.SpanID
+	} else {
+		sc.TraceID = newTraceID()
+	}
+	sc.SpanID = newSpanID()
+
+	sampler := t.Sampler
+	if sampler == nil {
+		sampler = AlwaysSample
+	}
+	if sampler(parent, sc.TraceID) {
+		sc.Flags |= FlagSampled
+		span.recording = true
+	}
+	span.data.Service = t.Service
+	span.data.Name = name
+	span.data.Kind = kind
+	span.data.Start = time.Now()
+	return ContextWithSpan(ctx, span), span
+}
+
+// Start starts a child span by the tracer of the span in ctx, or returns the nil span if ctx is not traced.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
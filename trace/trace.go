@@ -0,0 +1,143 @@
+// Package trace implements the spans with the W3C Trace Context propagation, see `https://www.w3.org/TR/trace-context/`.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+const FlagSampled = byte(0x01)
+
+// SpanContext is the propagated part of the span.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	State   string // the raw `tracestate` header
+	Remote  bool   // parsed from the headers
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+func (sc SpanContext) IsSampled() bool { return sc.Flags&FlagSampled != 0 }
+
+// Traceparent returns the value of the `traceparent` header, such as
+// `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`.
+func (sc SpanContext) Traceparent() string {
+	var buf [55]byte
+	copy(buf[:], "00-")
+	hex.Encode(buf[3:35], sc.TraceID[:])
+	buf[35] = '-'
+	hex.Encode(buf[36:52], sc.SpanID[:])
+	buf[52] = '-'
+	hex.Encode(buf[53:55], []byte{sc.Flags})
+	return string(buf[:])
+}
+
+var ErrBadTraceparent = errors.New("sha.trace: bad traceparent")
+
+func decodeLowerHex(dist []byte, src string) bool {
+	for i := 0; i < len(src); i++ {
+		if c := src[i]; !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+			return false
+		}
+	}
+	_, err := hex.Decode(dist, []byte(src))
+	return err == nil
+}
+
+// ParseTraceparent parses the `traceparent` header, the unknown future versions are parsed as the version `00`.
+func ParseTraceparent(v string) (SpanContext, error) {
+	var sc SpanContext
+	v = strings.TrimSpace(v)
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return sc, ErrBadTraceparent
+	}
+	var version [1]byte
+	if !decodeLowerHex(version[:], v[:2]) || version[0] == 0xff {
+		return sc, ErrBadTraceparent
+	}
+	if len(v) > 55 && (version[0] == 0 || v[55] != '-') {
+		return sc, ErrBadTraceparent
+	}
+	var flags [1]byte
+	if !decodeLowerHex(sc.TraceID[:], v[3:35]) || !decodeLowerHex(sc.SpanID[:], v[36:52]) || !decodeLowerHex(flags[:], v[53:55]) {
+		return sc, ErrBadTraceparent
+	}
+	if !sc.IsValid() {
+		return sc, ErrBadTraceparent
+	}
+	sc.Flags = flags[0]
+	sc.Remote = true
+	return sc, nil
+}
+
+// MaxTracestateSize is the max length of the propagated `tracestate` header, the longer one is dropped.
+const MaxTracestateSize = 512
+
+// ParseTracestate returns the trimmed `tracestate` header, or empty if it is too long.
+func ParseTracestate(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > MaxTracestateSize {
+		return ""
+	}
+	return v
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+// Sampler decides whether the new trace or span is recorded and exported.
+type Sampler func(parent SpanContext, traceID TraceID) bool
+
+// AlwaysSample samples all the root spans, and follows the sampled flag of the parents.
+func AlwaysSample(parent SpanContext, _ TraceID) bool {
+	return !parent.IsValid() || parent.IsSampled()
+}
+
+// RatioSample samples the root spans by the ratio of the trace ids, and follows the sampled flag of the parents.
+func RatioSample(ratio float64) Sampler {
+	bound := uint64(ratio * (1 << 63))
+	return func(parent SpanContext, traceID TraceID) bool {
+		if parent.IsValid() {
+			return parent.IsSampled()
+		}
+		if ratio >= 1 {
+			return true
+		}
+		return binary.BigEndian.Uint64(traceID[8:])>>1 < bound
+	}
+}
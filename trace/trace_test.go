@@ -0,0 +1,126 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const v = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" ||
+		!sc.IsSampled() || !sc.Remote || sc.Traceparent() != v {
+		t.Fatalf("unexpected %+v", sc)
+	}
+	if _, err = ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-what-ever"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, err = ParseTraceparent(bad); err != ErrBadTraceparent {
+			t.Fatalf("%q should be bad", bad)
+		}
+	}
+}
+
+func TestTracer_Start(t *testing.T) {
+	var exporter MemoryExporter
+	tracer := &Tracer{Service: "test", Exporter: &exporter}
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	remote.State = "k=v"
+	ctx, root := tracer.Start(ContextWithRemote(context.Background(), remote), "root", SpanKindServer)
+	_, child := Start(ctx, "child", SpanKindInternal)
+	child.SetAttributes("n", 1, "n", 2, "dangling")
+	child.SetError(errors.New("oops"))
+	child.End()
+	child.SetName("ignored")
+	root.End()
+
+	if _, span := Start(context.Background(), "untraced", SpanKindInternal); span != nil {
+		t.Fatal("expected nil span")
+	} else {
+		span.SetAttributes("k", "v")
+		span.End()
+	}
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+	c, r := spans[0], spans[1]
+	if r.SpanContext.TraceID != remote.TraceID || r.Parent != remote.SpanID || r.SpanContext.State != "k=v" {
+		t.Fatalf("unexpected root %+v", r)
+	}
+	if c.Name != "child" || c.Parent != r.SpanContext.SpanID || c.Status != StatusError || len(c.Attributes) != 1 {
+		t.Fatalf("unexpected child %+v", c)
+	}
+	if v, _ := c.Attribute("n"); v != 2 {
+		t.Fatalf("unexpected attribute %v", v)
+	}
+
+	exporter.Reset()
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracer.Start(ContextWithRemote(context.Background(), unsampled), "unsampled", SpanKindServer)
+	if span.IsRecording() || span.Context().IsSampled() {
+		t.Fatal("expected not recording")
+	}
+	span.End()
+	if len(exporter.Spans()) != 0 {
+		t.Fatal("unexpected exported span")
+	}
+}
+
+func TestRatioSample(t *testing.T) {
+	never, always := RatioSample(0), RatioSample(1)
+	for i := 0; i < 100; i++ {
+		id := newTraceID()
+		if never(SpanContext{}, id) || !always(SpanContext{}, id) {
+			t.Fatal("unexpected sampling")
+		}
+	}
+	parent := SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Flags: FlagSampled}
+	if !never(parent, parent.TraceID) {
+		t.Fatal("expected following the parent")
+	}
+}
+
+func TestOTLPJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := &Tracer{Service: "svc", Exporter: NewOTLPJSONExporter(&buf)}
+	_, span := tracer.Start(context.Background(), "op", SpanKindClient)
+	span.SetAttributes("s", "v", "i", 3, "b", true, "f", 1.5)
+	span.End()
+
+	line := buf.String()
+	for _, part := range []string{
+		`{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"svc"}}]}`,
+		`"traceId":"` + span.Context().TraceID.String() + `"`,
+		`"name":"op","kind":3`,
+		`{"key":"i","value":{"intValue":"3"}}`,
+		`{"key":"b","value":{"boolValue":true}}`,
+		`{"key":"f","value":{"doubleValue":1.5}}`,
+	} {
+		if !strings.Contains(line, part) {
+			t.Fatalf("missing %q in %s", part, line)
+		}
+	}
+	if !strings.HasSuffix(line, "}\n") || strings.Count(line, "\n") != 1 {
+		t.Fatalf("unexpected line %q", line)
+	}
+}
@@ -0,0 +1,128 @@
+package sha
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/zzztttkkk/sha/logx"
+	"github.com/zzztttkkk/sha/trace"
+)
+
+func TestTracing(t *testing.T) {
+	var exporter trace.MemoryExporter
+	tracing := &Tracing{Tracer: &trace.Tracer{Service: "test", Exporter: &exporter}}
+
+	downstream := NewMux(nil)
+	downstream.Use(tracing)
+	downstream.HTTP(MethodGet, "/item/{id}", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_ = ctx.WriteString(trace.SpanFromContext(ctx).Context().TraceID.String())
+	}))
+	downstreamAddr, stopDownstream := startHTTP11TestServer(t, downstream, nil)
+	defer stopDownstream()
+	// the rules cache of the validator is not safe for preparing two muxes concurrently
+	if res, err := http.Get("http://" + downstreamAddr + "/item/0"); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = res.Body.Close()
+	}
+	exporter.Reset()
+
+	var cliOpt CliOptions
+	tracing.Cli(&cliOpt.CliConnectionOptions)
+	cli := NewCli(&cliOpt)
+	defer cli.Close()
+
+	upstream := NewMux(nil)
+	upstream.Use(tracing)
+	upstream.HTTP(MethodGet, "/", RequestCtxHandlerFunc(func(ctx *RequestCtx) {
+		_, span := trace.Start(ctx.Wrap(), "internal", trace.SpanKindInternal)
+		span.End()
+
+		cctx := AcquireRequestCtx(ctx.Wrap())
+		defer ReleaseRequestCtx(cctx)
+		cctx.Request.SetMethod(MethodGet)
+		cctx.Request.SetPathString("/item/1")
+		if err := cli.Send(cctx, downstreamAddr); err != nil {
+			ctx.SetError(err)
+			return
+		}
+		_, _ = ctx.Write(cctx.Response.Body().Bytes())
+	}))
+	upstreamAddr, stopUpstream := startHTTP11TestServer(t, upstream, nil)
+	defer stopUpstream()
+
+	req, _ := http.NewRequest(MethodGet, "http://"+upstreamAddr+"/", nil)
+	req.Header.Set(trace.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(trace.HeaderTracestate, "vendor=1")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != StatusOK {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+
+	server, internal := exporter.Find("GET /"), exporter.Find("internal")
+	client, downstreamSpan := exporter.Find("GET"), exporter.Find("GET /item/{id}")
+	if server == nil || internal == nil || client == nil || downstreamSpan == nil {
+		t.Fatalf("missing spans %v", exporter.Spans())
+	}
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, s := range []*trace.SpanData{server, internal, client, downstreamSpan} {
+		if s.SpanContext.TraceID.String() != traceID || s.SpanContext.State != "vendor=1" {
+			t.Fatalf("unexpected trace %+v", s)
+		}
+	}
+	if server.Parent.String() != "00f067aa0ba902b7" || server.Kind != trace.SpanKindServer {
+		t.Fatalf("unexpected server span %+v", server)
+	}
+	if internal.Parent != server.SpanContext.SpanID || client.Parent != server.SpanContext.SpanID {
+		t.Fatal("unexpected parents of the children")
+	}
+	if downstreamSpan.Parent != client.SpanContext.SpanID || client.Kind != trace.SpanKindClient {
+		t.Fatal("unexpected parent of the downstream span")
+	}
+	if v, _ := downstreamSpan.Attribute("http.route"); v != "/item/{id}" {
+		t.Fatalf("unexpected route %v", v)
+	}
+	if v, _ := client.Attribute("http.response.status_code"); v != StatusOK {
+		t.Fatalf("unexpected status %v", v)
+	}
+}
+
+func TestTracing_Errors(t *testing.T) {
+	var exporter trace.MemoryExporter
+	mux := NewMux(&MuxOptions{Logger: logx.Discard})
+	mux.Use(&Tracing{Tracer: &trace.Tracer{Service: "test", Exporter: &exporter}})
+	mux.HTTP(MethodGet, "/redirect", RequestCtxHandlerFunc(func(ctx *RequestCtx) { RedirectTemporarily("/") }))
+	mux.HTTP(MethodGet, "/bad", RequestCtxHandlerFunc(func(ctx *RequestCtx) { ctx.SetError(StatusError(StatusBadRequest)) }))
+	mux.HTTP(MethodGet, "/panic", RequestCtxHandlerFunc(func(ctx *RequestCtx) { panic("oops") }))
+	addr, stop := startHTTP11TestServer(t, mux, nil)
+	defer stop()
+
+	cli := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }}
+	for _, c := range []struct {
+		path   string
+		status int
+		err    bool
+	}{
+		{"/redirect", StatusFound, false},
+		{"/bad", StatusBadRequest, false},
+		{"/panic", StatusInternalServerError, true},
+	} {
+		res, err := cli.Get("http://" + addr + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+
+		span := exporter.Find("GET " + c.path)
+		if res.StatusCode != c.status || span == nil {
+			t.Fatalf("%s: unexpected response %d %v", c.path, res.StatusCode, exporter.Spans())
+		}
+		if v, _ := span.Attribute("http.response.status_code"); v != c.status || (span.Status == trace.StatusError) != c.err {
+			t.Fatalf("%s: unexpected span %+v", c.path, span)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator generates the ULIDs, such as `01ARZ3NDEKTSV4RRFFQ69G5FAV`, which are sortable by the time.
+type ULIDGenerator struct{}
+
+func (ULIDGenerator) Size() int { return 26 }
+
+// Generate writes a ULID to v, the length of v must be 26.
+func (ULIDGenerator) Generate(v []byte) {
+	var id [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	id[0], id[1], id[2], id[3], id[4], id[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	_, _ = rand.Read(id[6:])
+
+	// 128 bits as 26 characters of 5 bits, the first character holds the highest 3 bits
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	for i := 25; i > 0; i-- {
+		v[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	v[0] = crockfordBase32[lo&0x1f]
+}
+
+// UUIDv7Generator generates the version 7 UUIDs of RFC 9562, such as `01890a5d-ac96-774b-bcce-b302099a8057`.
+type UUIDv7Generator struct{}
+
+func (UUIDv7Generator) Size() int { return 36 }
+
+// Generate writes a UUID to v, the length of v must be 36.
+func (UUIDv7Generator) Generate(v []byte) {
+	var id [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	id[0], id[1], id[2], id[3], id[4], id[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	_, _ = rand.Read(id[6:])
+	id[6] = id[6]&0x0f | 0x70
+	id[8] = id[8]&0x3f | 0x80
+
+	hex.Encode(v[0:8], id[0:4])
+	v[8] = '-'
+	hex.Encode(v[9:13], id[4:6])
+	v[13] = '-'
+	hex.Encode(v[14:18], id[6:8])
+	v[18] = '-'
+	hex.Encode(v[19:23], id[8:10])
+	v[23] = '-'
+	hex.Encode(v[24:], id[10:])
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestULIDGenerator(t *testing.T) {
+	var g ULIDGenerator
+	a, b := make([]byte, g.Size()), make([]byte, g.Size())
+	g.Generate(a)
+	g.Generate(b)
+	re := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	if !re.Match(a) || !re.Match(b) || string(a) == string(b) {
+		t.Fatalf("unexpected ulids %s %s", a, b)
+	}
+	if string(a[:6]) > string(b[:6]) {
+		t.Fatalf("unexpected order %s %s", a, b)
+	}
+}
+
+func TestUUIDv7Generator(t *testing.T) {
+	var g UUIDv7Generator
+	v := make([]byte, g.Size())
+	g.Generate(v)
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).Match(v) {
+		t.Fatalf("unexpected uuid %s", v)
+	}
+}
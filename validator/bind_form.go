@@ -63,6 +63,10 @@ func htmlEscape(p []byte) []byte {
 }
 
 func (rule *_Rule) bindOne(former Former, filed *reflect.Value) *Error {
+	if rule.rtype == _File {
+		return rule.bindFile(former, filed)
+	}
+
 	fv, ok := rule.peekOne(former, rule.formName)
 	if !ok {
 		if rule.where != _WhereURLParams {
@@ -122,6 +126,10 @@ func (rule *_Rule) bindOne(former Former, filed *reflect.Value) *Error {
 }
 
 func (rule *_Rule) bindMany(former Former, field *reflect.Value) *Error {
+	if rule.rtype == _FileSlice {
+		return rule.bindFiles(former, field)
+	}
+
 	var ret interface{}
 	formVals := rule.peekAll(former, rule.formName)
 	if len(formVals) < 1 {
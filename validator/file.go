@@ -0,0 +1,122 @@
+package validator
+
+import (
+	"reflect"
+
+	"github.com/zzztttkkk/sqlx/reflectx"
+)
+
+// FormFile is the uploaded file of multipart form, such as `*sha.FormFile`
+type FormFile interface {
+	Size() int64
+}
+
+// FileFormer is the optional interface of `Former` which provides the uploaded files, such as the former of
+// `sha.RequestCtx`. the file fields are missing if the former does not implement it.
+type FileFormer interface {
+	FileValue(name string) (FormFile, bool)
+	FileValues(name string) []FormFile
+}
+
+var formFileType = reflect.TypeOf((*FormFile)(nil)).Elem()
+
+func isFileType(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr && t.Implements(formFileType)
+}
+
+func isFileField(rule *_Rule, t reflect.Type) bool {
+	if isFileType(t) {
+		rule.rtype = _File
+		return true
+	}
+	if t.Kind() == reflect.Slice && isFileType(t.Elem()) {
+		rule.rtype = _FileSlice
+		rule.isSlice = true
+		return true
+	}
+	return false
+}
+
+// the fields of file struct are not form fields
+func isInFileField(f *reflectx.FieldInfo) bool {
+	for p := f.Parent; p != nil; p = p.Parent {
+		if p.Field.Type != nil && (isFileType(p.Field.Type) || (p.Field.Type.Kind() == reflect.Slice && isFileType(p.Field.Type.Elem()))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *_Rule) checkFile(file FormFile) bool {
+	if !rule.checkFileSize {
+		return true
+	}
+	size := file.Size()
+	if rule.minFileSize != nil && size < *rule.minFileSize {
+		return false
+	}
+	if rule.maxFileSize != nil && size > *rule.maxFileSize {
+		return false
+	}
+	return true
+}
+
+func (rule *_Rule) bindFile(former Former, field *reflect.Value) *Error {
+	var file FormFile
+	ff, ok := former.(FileFormer)
+	if ok {
+		file, ok = ff.FileValue(rule.formName)
+	}
+	if !ok {
+		if rule.isRequired {
+			return &Error{FormName: rule.formName, Type: MissingRequired}
+		}
+		return nil
+	}
+	if !rule.checkFile(file) {
+		return &Error{FormName: rule.formName, Type: BadValue}
+	}
+	fv := reflect.ValueOf(file)
+	if !fv.Type().AssignableTo(rule.fieldType) {
+		return &Error{FormName: rule.formName, Type: BadValue}
+	}
+	field.Set(fv)
+	return nil
+}
+
+func (rule *_Rule) bindFiles(former Former, field *reflect.Value) *Error {
+	var files []FormFile
+	if ff, ok := former.(FileFormer); ok {
+		files = ff.FileValues(rule.formName)
+	}
+	if len(files) < 1 {
+		if rule.isRequired {
+			return &Error{FormName: rule.formName, Type: MissingRequired}
+		}
+		return nil
+	}
+
+	if rule.checkListSize {
+		if rule.minSliceSize != nil && len(files) < *rule.minSliceSize {
+			return &Error{FormName: rule.formName, Type: BadValue}
+		}
+		if rule.maxSliceSize != nil && len(files) > *rule.maxSliceSize {
+			return &Error{FormName: rule.formName, Type: BadValue}
+		}
+	}
+
+	sliceV := reflect.MakeSlice(rule.fieldType, 0, len(files))
+	eleT := rule.fieldType.Elem()
+	for _, file := range files {
+		if !rule.checkFile(file) {
+			return &Error{FormName: rule.formName, Type: BadValue}
+		}
+		fv := reflect.ValueOf(file)
+		if !fv.Type().AssignableTo(eleT) {
+			return &Error{FormName: rule.formName, Type: BadValue}
+		}
+		sliceV = reflect.Append(sliceV, fv)
+	}
+	field.Set(sliceV)
+	return nil
+}
@@ -0,0 +1,40 @@
+package validator
+
+import "testing"
+
+// _NoFileFormer does not implement `FileFormer`
+type _NoFileFormer struct{}
+
+func (_NoFileFormer) URLParam(name string) ([]byte, bool)    { return nil, false }
+func (_NoFileFormer) QueryValue(name string) ([]byte, bool)  { return nil, false }
+func (_NoFileFormer) QueryValues(name string) [][]byte       { return nil }
+func (_NoFileFormer) BodyValue(name string) ([]byte, bool)   { return []byte("sha"), true }
+func (_NoFileFormer) BodyValues(name string) [][]byte        { return [][]byte{[]byte("sha")} }
+func (_NoFileFormer) FormValue(name string) ([]byte, bool)   { return []byte("sha"), true }
+func (_NoFileFormer) FormValues(name string) [][]byte        { return [][]byte{[]byte("sha")} }
+func (_NoFileFormer) HeaderValue(name string) ([]byte, bool) { return nil, false }
+func (_NoFileFormer) HeaderValues(name string) [][]byte      { return nil }
+func (_NoFileFormer) CookieValue(name string) ([]byte, bool) { return nil, false }
+
+type _TestFile struct{ size int64 }
+
+func (f *_TestFile) Size() int64 { return f.size }
+
+func TestBindFile_WithoutFileFormer(t *testing.T) {
+	type Form struct {
+		Name  string       `vld:"name"`
+		Files []*_TestFile `vld:"files,optional"`
+	}
+	var form Form
+	if err := BindAndValidateForm(_NoFileFormer{}, &form); err != nil || form.Name != "sha" || len(form.Files) != 0 {
+		t.Fatalf("unexpected result %v %v", form, err)
+	}
+
+	type RequiredForm struct {
+		File *_TestFile `vld:"file"`
+	}
+	var required RequiredForm
+	if err := BindAndValidateForm(_NoFileFormer{}, &required); err == nil || err.Type != MissingRequired {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -153,14 +153,16 @@ func fieldInfoToRule(t reflect.Type, f *reflectx.FieldInfo, defaultF func() inte
 	}
 
 	ft := f.Field.Type
-	isCustomField(rule, ft)
-	if rule.rtype != _CustomType {
-		if ft.Kind() == reflect.Ptr {
-			ft = ft.Elem()
-			rule.isPtr = true
-		}
-		if !setType(rule, ft) {
-			return nil
+	if !isFileField(rule, ft) {
+		isCustomField(rule, ft)
+		if rule.rtype != _CustomType {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+				rule.isPtr = true
+			}
+			if !setType(rule, ft) {
+				return nil
+			}
 		}
 	}
 
@@ -292,6 +294,25 @@ func fieldInfoToRule(t reflect.Type, f *reflectx.FieldInfo, defaultF func() inte
 					),
 				)
 			}
+		case "fs", "filesize", "file-size":
+			rule.checkFileSize = true
+			minV, maxV, minVF, maxVF := internal.ParseIntRange(val)
+			if minVF {
+				rule.minFileSize = new(int64)
+				*rule.minFileSize = minV
+			}
+			if maxVF {
+				rule.maxFileSize = new(int64)
+				*rule.maxFileSize = maxV
+			}
+			if (rule.minFileSize == nil && rule.maxFileSize == nil) || (rule.rtype != _File && rule.rtype != _FileSlice) {
+				panic(
+					fmt.Errorf(
+						"sha.validator: bad file size range or file size range on non-file field, field: `%s:%s.%s`, tag value: `%s`",
+						t.PkgPath(), t.Name(), f.Field.Name, val,
+					),
+				)
+			}
 		case "l", "length", "len":
 			rule.checkFieldBytesSize = true
 			minV, maxV, minVF, maxVF := internal.ParseIntRange(val)
@@ -314,6 +335,10 @@ func fieldInfoToRule(t reflect.Type, f *reflectx.FieldInfo, defaultF func() inte
 		}
 	}
 
+	if rule.rtype == _File || rule.rtype == _FileSlice {
+		rule.where = _WhereFile
+	}
+
 	if rule.where == _WhereForm {
 		rule.peekOne = func(former Former, name string) ([]byte, bool) { return former.FormValue(name) }
 		rule.peekAll = func(former Former, name string) [][]byte { return former.FormValues(name) }
@@ -362,6 +387,9 @@ func fieldInfoToRule(t reflect.Type, f *reflectx.FieldInfo, defaultF func() inte
 
 		length/len/l
 			bytes length range
+
+		filesize/fs
+			file size range of the uploaded file, the field type should be `*sha.FormFile` or `[]*sha.FormFile`
 */
 func GetRules(t reflect.Type) Rules {
 	v, ok := CacheMap[t]
@@ -379,6 +407,10 @@ func GetRules(t reflect.Type) Rules {
 	var rules Rules
 	fMap := ReflectMapper.TypeMap(t)
 	for _, f := range fMap.Index {
+		if isInFileField(f) {
+			continue
+		}
+
 		var ed func() interface{}
 		if isD {
 			ed = defaulter.Default(f.Field.Name)
@@ -30,6 +30,9 @@ const (
 	_BytesSlice
 
 	_CustomType
+
+	_File
+	_FileSlice
 )
 
 var typeNames = []string{
@@ -48,6 +51,9 @@ var typeNames = []string{
 	"StringArray",
 
 	"CustomType",
+
+	"File",
+	"FileArray",
 }
 
 const (
@@ -57,6 +63,7 @@ const (
 	_WhereBody
 	_WhereCookie
 	_WhereHeader
+	_WhereFile
 )
 
 type _Rule struct {
@@ -91,6 +98,10 @@ type _Rule struct {
 	minFieldBytesSize   *int
 	maxFieldBytesSize   *int
 
+	checkFileSize bool
+	minFileSize   *int64
+	maxFileSize   *int64
+
 	notEscapeHtml bool
 	notTrimSpace  bool
 
@@ -157,6 +168,8 @@ func (rule *_Rule) String() string {
 		m["name"] = fmt.Sprintf("Query{%s}", rule.formName)
 	case _WhereURLParams:
 		m["name"] = fmt.Sprintf("URLParams{%s}", rule.formName)
+	case _WhereFile:
+		m["name"] = fmt.Sprintf("File{%s}", rule.formName)
 	}
 
 	if rule.checkListSize {
@@ -183,6 +196,14 @@ func (rule *_Rule) String() string {
 		} else {
 			m["lrange"] = "/"
 		}
+	} else if rule.checkFileSize {
+		if rule.minFileSize != nil && rule.maxFileSize != nil {
+			m["lrange"] = fmt.Sprintf("%d-%d", *rule.minFileSize, *rule.maxFileSize)
+		} else if rule.minFileSize != nil {
+			m["lrange"] = fmt.Sprintf("%d-", *rule.minFileSize)
+		} else {
+			m["lrange"] = fmt.Sprintf("-%d", *rule.maxFileSize)
+		}
 	} else {
 		m["lrange"] = "/"
 	}